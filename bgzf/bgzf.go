@@ -0,0 +1,111 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bgzf implements reading and writing of BGZF files.
+//
+// BGZF (Blocked GNU Zip Format) is used by BAM, VCF and tabix files.
+// A BGZF file is a series of gzip members, each containing at most 64KB of compressed data.
+// The compressed size of each member is stored in a "BC" subfield of the gzip extra field,
+// which makes it possible to find blocks without decompressing the file.
+// Any gzip reader can decompress BGZF files.
+//
+// Positions in BGZF files are given as virtual offsets,
+// which combine the offset of a block in the compressed file and the offset inside the uncompressed block.
+//
+// The specification is available at https://samtools.github.io/hts-specs/SAMv1.pdf
+package bgzf
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// MaxBlockSize is the maximum size of a block, including header and trailer.
+	MaxBlockSize = 64 << 10
+
+	// BlockSize is the maximum number of uncompressed bytes written to a block.
+	// This ensures the block can always be stored in MaxBlockSize bytes.
+	BlockSize = 0xff00
+
+	// headerSize is the size of a block header with only the BC subfield.
+	headerSize = 18
+
+	// trailerSize is the size of the CRC32 and size after the compressed data.
+	trailerSize = 8
+)
+
+var (
+	// ErrCorrupt is returned when the input is not valid BGZF.
+	ErrCorrupt = errors.New("bgzf: corrupt input")
+
+	// ErrNoSeek is returned by Seek if the input does not implement io.Seeker.
+	ErrNoSeek = errors.New("bgzf: input does not support seeking")
+
+	errClosed = errors.New("bgzf: use of closed Reader or Writer")
+)
+
+// eofBlock is the empty block written at the end of BGZF files.
+var eofBlock = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00,
+	0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// bcExtra is the extra field with a BC subfield.
+// The block size minus 1 is stored in the last two bytes.
+var bcExtra = []byte{'B', 'C', 2, 0, 0, 0}
+
+// Offset is a virtual file offset.
+// The upper 48 bits contain the offset of a block in the compressed file,
+// and the lower 16 bits contain the offset in the uncompressed block.
+type Offset uint64
+
+// NewOffset returns the virtual offset of position pos in the block
+// starting at offset block in the compressed file.
+func NewOffset(block int64, pos int) Offset {
+	return Offset(uint64(block)<<16 | uint64(uint16(pos)))
+}
+
+// Block returns the offset of the block in the compressed file.
+func (o Offset) Block() int64 {
+	return int64(o >> 16)
+}
+
+// Pos returns the offset in the uncompressed block.
+func (o Offset) Pos() int {
+	return int(o & 0xffff)
+}
+
+// blockSize returns the size of the block given its header,
+// which must be at least 12 bytes and contain the complete extra field.
+// The size of the header is also returned.
+func blockSize(hdr []byte) (size, hdrSize int, err error) {
+	if hdr[0] != 0x1f || hdr[1] != 0x8b || hdr[2] != 8 || hdr[3]&0x04 == 0 {
+		return 0, 0, ErrCorrupt
+	}
+	xlen := int(binary.LittleEndian.Uint16(hdr[10:]))
+	hdrSize = 12 + xlen
+	if hdrSize > MaxBlockSize {
+		return 0, 0, ErrCorrupt
+	}
+	if len(hdr) < hdrSize {
+		return 0, hdrSize, nil
+	}
+	extra := hdr[12:hdrSize]
+	for len(extra) >= 4 {
+		slen := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+slen {
+			break
+		}
+		if extra[0] == 'B' && extra[1] == 'C' && slen == 2 {
+			size = int(binary.LittleEndian.Uint16(extra[4:])) + 1
+			if size < hdrSize+trailerSize {
+				break
+			}
+			return size, hdrSize, nil
+		}
+		extra = extra[4+slen:]
+	}
+	return 0, 0, ErrCorrupt
+}
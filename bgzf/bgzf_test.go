@@ -0,0 +1,234 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"bytes"
+	stdgzip "compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func testData(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		if rng.Intn(4) == 0 {
+			b := make([]byte, rng.Intn(100000))
+			rng.Read(b)
+			buf.Write(b)
+			continue
+		}
+		fmt.Fprintf(&buf, "record %d\tvalue %d\n", buf.Len(), rng.Intn(1000))
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := testData(1 << 20)
+	for _, conc := range []int{1, 3, 0} {
+		t.Run(fmt.Sprint("concurrency-", conc), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriterLevel(&buf, 5, conc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			type mark struct {
+				off Offset
+				pos int
+			}
+			var marks []mark
+			rng := rand.New(rand.NewSource(int64(conc)))
+			for pos := 0; pos < len(data); {
+				n := rng.Intn(20000)
+				if pos+n > len(data) {
+					n = len(data) - pos
+				}
+				if rng.Intn(5) == 0 {
+					off, err := w.Offset()
+					if err != nil {
+						t.Fatal(err)
+					}
+					marks = append(marks, mark{off: off, pos: pos})
+				}
+				if _, err := w.Write(data[pos : pos+n]); err != nil {
+					t.Fatal(err)
+				}
+				pos += n
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			compressed := buf.Bytes()
+			if !bytes.HasSuffix(compressed, eofBlock) {
+				t.Fatal("missing EOF block")
+			}
+
+			// Check block sizes.
+			for b := compressed; len(b) > 0; {
+				size, _, err := blockSize(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > MaxBlockSize || size > len(b) {
+					t.Fatalf("invalid block size %d", size)
+				}
+				b = b[size:]
+			}
+
+			// Any gzip reader must be able to read the output.
+			sr, err := stdgzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(sr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("stdlib output mismatch")
+			}
+
+			r, err := NewReader(bytes.NewReader(compressed), conc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("output mismatch")
+			}
+
+			for _, m := range marks {
+				if err := r.Seek(m.off); err != nil {
+					t.Fatal(err)
+				}
+				if r.Offset() != m.off {
+					t.Fatalf("offset after seek: got %x, want %x", r.Offset(), m.off)
+				}
+				want := data[m.pos:]
+				if len(want) > 100000 {
+					want = want[:100000]
+				}
+				got := make([]byte, len(want))
+				if _, err := io.ReadFull(r, got); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("mismatch after seek to %x", m.off)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderOffset(t *testing.T) {
+	data := testData(300000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []Offset
+	chunk := make([]byte, 7777)
+	for {
+		offsets = append(offsets, r.Offset())
+		_, err := io.ReadFull(r, chunk)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, off := range offsets {
+		if err := r.Seek(off); err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(chunk[:n], data[i*len(chunk):i*len(chunk)+n]) {
+			t.Fatalf("mismatch at chunk %d", i)
+		}
+	}
+}
+
+func TestReaderCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write(testData(100000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compressed := buf.Bytes()
+	for _, pos := range []int{0, 12, 16, 100, len(compressed) - len(eofBlock) - 8} {
+		b := append([]byte{}, compressed...)
+		b[pos] ^= 0x55
+		r, err := NewReader(bytes.NewReader(b), 2)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if err == nil {
+			t.Errorf("no error with corruption at %d", pos)
+		}
+	}
+	// Extra field larger than a block.
+	if _, err := NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff}), 2); err != ErrCorrupt {
+		t.Errorf("large extra field: got %v, want ErrCorrupt", err)
+	}
+	r, err := NewReader(bytes.NewReader(compressed[:len(compressed)-100]), 2)
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated input: got %v", err)
+	}
+	r, err = NewReader(io.MultiReader(bytes.NewReader(compressed)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Seek(0); err != ErrNoSeek {
+		t.Errorf("got %v, want ErrNoSeek", err)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
+
+func TestWriterError(t *testing.T) {
+	w, err := NewWriterLevel(failWriter{}, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first block is pending, the second fails writing the first.
+	n, err := w.Write(testData(3 * BlockSize))
+	if err != io.ErrShortWrite {
+		t.Fatalf("got error %v, want %v", err, io.ErrShortWrite)
+	}
+	if n != 2*BlockSize {
+		t.Fatalf("got %d bytes consumed, want %d", n, 2*BlockSize)
+	}
+	if _, err := w.Write([]byte("x")); err != io.ErrShortWrite {
+		t.Fatalf("got error %v after failure", err)
+	}
+}
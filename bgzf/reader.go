@@ -0,0 +1,243 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// Reader reads BGZF files.
+// Blocks are decompressed concurrently ahead of the reads.
+type Reader struct {
+	r           io.Reader
+	concurrency int
+
+	next   int64 // Offset of the next block read from r.
+	rawErr error // Error reading the next block from r.
+	queue  []*readBlock
+	cur    *readBlock
+	pos    int
+	err    error
+}
+
+// readBlock is a block that is decompressed concurrently.
+type readBlock struct {
+	off  int64
+	in   []byte
+	out  []byte
+	err  error
+	done chan struct{}
+}
+
+// NewReader returns a new Reader that reads BGZF from r.
+// Up to concurrency blocks are decompressed at once.
+// If concurrency is <= 0, GOMAXPROCS is used.
+// If r implements io.Seeker, Seek can be used.
+// The header of the first block is read and validated.
+func NewReader(r io.Reader, concurrency int) (*Reader, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	z := &Reader{r: r, concurrency: concurrency}
+	z.fill()
+	if len(z.queue) == 0 && z.rawErr != io.EOF {
+		return nil, z.rawErr
+	}
+	return z, nil
+}
+
+// Read implements io.Reader.
+func (z *Reader) Read(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if z.cur != nil && z.pos < len(z.cur.out) {
+			c := copy(p, z.cur.out[z.pos:])
+			z.pos += c
+			n += c
+			p = p[c:]
+			continue
+		}
+		if n > 0 {
+			break
+		}
+		if err := z.nextBlock(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// nextBlock makes the next block current.
+func (z *Reader) nextBlock() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.fill()
+	if len(z.queue) == 0 {
+		z.err = z.rawErr
+		return z.err
+	}
+	b := z.queue[0]
+	<-b.done
+	n := copy(z.queue, z.queue[1:])
+	z.queue[n] = nil
+	z.queue = z.queue[:n]
+	if b.err != nil {
+		z.err = b.err
+		return z.err
+	}
+	z.cur, z.pos = b, 0
+	z.fill()
+	return nil
+}
+
+// fill reads blocks from the input and starts decompressing them,
+// until concurrency blocks are queued or no more blocks can be read.
+func (z *Reader) fill() {
+	for len(z.queue) < z.concurrency && z.rawErr == nil {
+		b, err := z.readRaw()
+		if err != nil {
+			z.rawErr = err
+			return
+		}
+		z.queue = append(z.queue, b)
+		go b.decompress()
+	}
+}
+
+// readRaw reads the next compressed block from the input.
+// io.EOF is returned if the input ends before a block.
+func (z *Reader) readRaw() (*readBlock, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(z.r, hdr[:]); err != nil {
+		return nil, err
+	}
+	_, hdrSize, err := blockSize(hdr[:])
+	if err != nil {
+		return nil, err
+	}
+	in := make([]byte, hdrSize, MaxBlockSize)
+	copy(in, hdr[:])
+	if _, err := io.ReadFull(z.r, in[12:]); err != nil {
+		return nil, noEOF(err)
+	}
+	size, _, err := blockSize(in)
+	if err != nil {
+		return nil, err
+	}
+	n := len(in)
+	in = in[:size]
+	if _, err := io.ReadFull(z.r, in[n:]); err != nil {
+		return nil, noEOF(err)
+	}
+	b := &readBlock{off: z.next, in: in, done: make(chan struct{})}
+	z.next += int64(size)
+	return b, nil
+}
+
+// Offset returns the virtual offset of the next byte read.
+func (z *Reader) Offset() Offset {
+	if z.cur != nil && z.pos < len(z.cur.out) {
+		return NewOffset(z.cur.off, z.pos)
+	}
+	if len(z.queue) > 0 {
+		return NewOffset(z.queue[0].off, 0)
+	}
+	return NewOffset(z.next, 0)
+}
+
+// Seek moves to the virtual offset off,
+// which must have been returned by Offset on a Reader or Writer of the same file.
+// ErrNoSeek is returned if the input does not implement io.Seeker.
+func (z *Reader) Seek(off Offset) error {
+	rs, ok := z.r.(io.Seeker)
+	if !ok {
+		return ErrNoSeek
+	}
+	if z.err == errClosed {
+		return z.err
+	}
+	if _, err := rs.Seek(off.Block(), io.SeekStart); err != nil {
+		return err
+	}
+	z.next = off.Block()
+	z.rawErr, z.err = nil, nil
+	z.queue, z.cur, z.pos = nil, nil, 0
+	if err := z.nextBlock(); err != nil {
+		if err == io.EOF && off.Pos() == 0 {
+			return nil
+		}
+		return noEOF(err)
+	}
+	if off.Pos() > len(z.cur.out) {
+		z.err = ErrCorrupt
+		return z.err
+	}
+	z.pos = off.Pos()
+	return nil
+}
+
+// Close stops reading. It does not close the underlying reader.
+func (z *Reader) Close() error {
+	z.queue, z.cur = nil, nil
+	z.err = errClosed
+	return nil
+}
+
+// gzipReaderPool contains gzip readers for decompressing blocks.
+var gzipReaderPool sync.Pool
+
+// decompress the block and verify its checksum.
+func (b *readBlock) decompress() {
+	defer close(b.done)
+	isize := binary.LittleEndian.Uint32(b.in[len(b.in)-4:])
+	if isize > MaxBlockSize {
+		b.err = ErrCorrupt
+		return
+	}
+	br := bytes.NewReader(b.in)
+	zr, _ := gzipReaderPool.Get().(*gzip.Reader)
+	if zr == nil {
+		zr = new(gzip.Reader)
+	}
+	defer gzipReaderPool.Put(zr)
+	if b.err = zr.Reset(br); b.err != nil {
+		b.err = noEOF(b.err)
+		return
+	}
+	zr.Multistream(false)
+	b.out = make([]byte, isize)
+	if _, b.err = io.ReadFull(zr, b.out); b.err != nil {
+		b.err = noEOF(b.err)
+		return
+	}
+	// Reading to the end verifies the checksum and size.
+	var tmp [1]byte
+	if n, err := zr.Read(tmp[:]); n != 0 || err != io.EOF {
+		if err == nil || err == io.EOF {
+			err = ErrCorrupt
+		}
+		b.err = err
+		return
+	}
+	if br.Len() != 0 {
+		b.err = ErrCorrupt
+	}
+	b.in = nil
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bgzf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// Writer writes BGZF files.
+// Blocks are compressed concurrently.
+type Writer struct {
+	w           io.Writer
+	level       int
+	concurrency int
+
+	cur     *writeBlock
+	pending []*writeBlock
+	written int64
+	err     error
+	closed  bool
+}
+
+// writeBlock is a block that is compressed concurrently.
+type writeBlock struct {
+	in   []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+var writeBlockPool = sync.Pool{New: func() interface{} {
+	return &writeBlock{in: make([]byte, 0, BlockSize)}
+}}
+
+// NewWriter returns a new Writer that writes BGZF to w,
+// using the default compression level and up to GOMAXPROCS concurrent blocks.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, gzip.DefaultCompression, 0)
+	return z
+}
+
+// NewWriterLevel returns a new Writer that writes BGZF to w,
+// compressing at the given gzip level.
+// Up to concurrency blocks are compressed at once.
+// If concurrency is <= 0, GOMAXPROCS is used.
+func NewWriterLevel(w io.Writer, level, concurrency int) (*Writer, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, errors.New("bgzf: invalid compression level")
+	}
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	return &Writer{w: w, level: level, concurrency: concurrency}, nil
+}
+
+// Write writes p to the current block.
+// Full blocks are compressed in the background.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if z.cur == nil {
+			z.cur = writeBlockPool.Get().(*writeBlock)
+			z.cur.in = z.cur.in[:0]
+		}
+		b := z.cur
+		c := copy(b.in[len(b.in):BlockSize], p)
+		b.in = b.in[:len(b.in)+c]
+		p = p[c:]
+		if len(b.in) == BlockSize {
+			if z.err = z.startBlock(); z.err != nil {
+				return n - len(p), z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// startBlock starts compressing the current block.
+// If the maximum number of blocks is being compressed, the oldest is written first.
+func (z *Writer) startBlock() error {
+	b := z.cur
+	z.cur = nil
+	b.err = nil
+	b.done = make(chan struct{})
+	if len(z.pending) >= z.concurrency {
+		if err := z.writeOldest(); err != nil {
+			return err
+		}
+	}
+	z.pending = append(z.pending, b)
+	go b.compress(z.level)
+	return nil
+}
+
+// writeOldest waits for the oldest pending block and writes it.
+func (z *Writer) writeOldest() error {
+	b := z.pending[0]
+	<-b.done
+	n := copy(z.pending, z.pending[1:])
+	z.pending[n] = nil
+	z.pending = z.pending[:n]
+	defer writeBlockPool.Put(b)
+	if b.err != nil {
+		return b.err
+	}
+	n, err := z.w.Write(b.out.Bytes())
+	z.written += int64(n)
+	return err
+}
+
+// Flush ends the current block and writes all pending blocks to the underlying writer.
+// If no data has been written since the last block, Flush does nothing.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return errClosed
+	}
+	if z.cur != nil && len(z.cur.in) > 0 {
+		if z.err = z.startBlock(); z.err != nil {
+			return z.err
+		}
+	}
+	for len(z.pending) > 0 {
+		if z.err = z.writeOldest(); z.err != nil {
+			return z.err
+		}
+	}
+	return nil
+}
+
+// Offset returns the virtual offset of the next byte written.
+//
+// Offset blocks until all pending blocks have been compressed and written
+// to the underlying writer, since the compressed offset of the current block
+// is not known before that. Calling Offset for every record will therefore
+// make compression mostly sequential. When many offsets are needed,
+// call Offset as rarely as possible, for example once per BlockSize bytes written.
+func (z *Writer) Offset() (Offset, error) {
+	for len(z.pending) > 0 && z.err == nil {
+		z.err = z.writeOldest()
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	pos := 0
+	if z.cur != nil {
+		pos = len(z.cur.in)
+	}
+	return NewOffset(z.written, pos), nil
+}
+
+// Close writes any pending data followed by the BGZF end-of-file marker.
+// It does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	if err := z.Flush(); err != nil {
+		return err
+	}
+	z.closed = true
+	n, err := z.w.Write(eofBlock)
+	z.written += int64(n)
+	z.err = err
+	return err
+}
+
+// Reset discards the writer's state and makes it equivalent to the result of NewWriterLevel,
+// with the same settings, writing to w.
+func (z *Writer) Reset(w io.Writer) {
+	for _, b := range z.pending {
+		<-b.done
+	}
+	*z = Writer{w: w, level: z.level, concurrency: z.concurrency}
+}
+
+// gzipWriterPools contains gzip writers for each level from HuffmanOnly to BestCompression.
+var gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// compress the block as a gzip member with a BC subfield.
+func (b *writeBlock) compress(level int) {
+	defer close(b.done)
+	b.out.Reset()
+	b.err = compressBlock(&b.out, b.in, level)
+	if b.err == nil && b.out.Len() > MaxBlockSize {
+		// Incompressible data. Stored blocks always fit.
+		b.out.Reset()
+		b.err = compressBlock(&b.out, b.in, gzip.NoCompression)
+	}
+	if b.err == nil {
+		binary.LittleEndian.PutUint16(b.out.Bytes()[headerSize-2:], uint16(b.out.Len()-1))
+	}
+}
+
+func compressBlock(dst *bytes.Buffer, in []byte, level int) error {
+	pool := &gzipWriterPools[level-gzip.HuffmanOnly]
+	gw, _ := pool.Get().(*gzip.Writer)
+	if gw == nil {
+		var err error
+		if gw, err = gzip.NewWriterLevel(dst, level); err != nil {
+			return err
+		}
+	} else {
+		gw.Reset(dst)
+	}
+	defer pool.Put(gw)
+	gw.Header = gzip.Header{Extra: bcExtra, ModTime: time.Unix(0, 0), OS: 255}
+	if _, err := gw.Write(in); err != nil {
+		return err
+	}
+	return gw.Close()
+}
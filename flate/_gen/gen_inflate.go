@@ -124,6 +124,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -218,7 +222,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -251,10 +255,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -30,6 +30,11 @@ const (
 	HuffmanOnly         = -2
 	ConstantCompression = HuffmanOnly // compatibility alias.
 
+	// MinWindowBits and MaxWindowBits are the limits of the window size
+	// accepted by NewWriterWindow and NewReaderWindow.
+	MinWindowBits = 8
+	MaxWindowBits = logWindowSize
+
 	logWindowSize    = 15
 	windowSize       = 1 << logWindowSize
 	windowMask       = windowSize - 1
@@ -122,9 +127,11 @@ type compressor struct {
 	tokens tokens
 	fast   fastEnc
 	state  *advancedState
+	opt    *optimalState
 
 	sync          bool // requesting flush
 	byteAvailable bool // if true, still need to process window[index-1].
+	maxOffset     int  // largest match offset
 }
 
 func (d *compressor) fillDeflate(b []byte) int {
@@ -215,6 +222,14 @@ func (d *compressor) fillWindow(b []byte) {
 	if d.level <= 0 {
 		return
 	}
+	if d.opt != nil {
+		if len(b) > windowSize {
+			b = b[len(b)-windowSize:]
+		}
+		d.windowEnd = copy(d.window, b)
+		d.blockStart = d.windowEnd
+		return
+	}
 	if d.fast != nil {
 		// encode the last data, but discard the result
 		if len(b) > maxMatchOffset {
@@ -288,7 +303,7 @@ func (d *compressor) findMatch(pos int, prevHead int, lookahead int) (length, of
 
 	wEnd := win[pos+length]
 	wPos := win[pos:]
-	minIndex := pos - windowSize
+	minIndex := pos - d.maxOffset
 	if minIndex < 0 {
 		minIndex = 0
 	}
@@ -480,7 +495,7 @@ func (d *compressor) deflateLazy() {
 		prevOffset := s.offset
 		s.length = minMatchLength - 1
 		s.offset = 0
-		minIndex := s.index - windowSize
+		minIndex := s.index - d.maxOffset
 		if minIndex < 0 {
 			minIndex = 0
 		}
@@ -807,6 +822,7 @@ func (d *compressor) syncFlush() error {
 
 func (d *compressor) init(w io.Writer, level int) (err error) {
 	d.w = newHuffmanBitWriter(w)
+	d.maxOffset = windowSize
 
 	switch {
 	case level == NoCompression:
@@ -841,11 +857,27 @@ func (d *compressor) init(w io.Writer, level int) (err error) {
 	return nil
 }
 
+// setMaxOffset limits the offset of matches to n bytes.
+func (d *compressor) setMaxOffset(n int) {
+	d.maxOffset = n
+	if d.fast != nil {
+		d.fast.setMaxOffset(int32(n))
+	}
+	if d.opt != nil {
+		d.opt.maxOffset = n
+	}
+}
+
 // reset the state of the compressor.
 func (d *compressor) reset(w io.Writer) {
 	d.w.reset(w)
 	d.sync = false
 	d.err = nil
+	if d.opt != nil {
+		d.windowEnd, d.blockStart = 0, 0
+		d.tokens.Reset()
+		return
+	}
 	// We only need to reset a few things for Snappy.
 	if d.fast != nil {
 		d.fast.Reset()
@@ -930,6 +962,25 @@ func NewWriterDict(w io.Writer, level int, dict []byte) (*Writer, error) {
 	return zw, err
 }
 
+// NewWriterWindow is like NewWriter but limits the distance of matches
+// to a window of 1<<windowBits bytes, so the output can be decompressed
+// by decoders with a smaller window, like zlib with the same windowBits.
+// windowBits must be between 8 and 15. 15 is the default window size.
+//
+// A smaller window reduces the compression of most content.
+// Levels NoCompression and HuffmanOnly do not use a window.
+func NewWriterWindow(w io.Writer, level, windowBits int) (*Writer, error) {
+	if windowBits < MinWindowBits || windowBits > MaxWindowBits {
+		return nil, fmt.Errorf("flate: invalid window bits %d: want value in range [%d, %d]", windowBits, MinWindowBits, MaxWindowBits)
+	}
+	dw, err := NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	dw.d.setMaxOffset(1 << windowBits)
+	return dw, nil
+}
+
 // A Writer takes data written to it and writes the compressed
 // form of that data to an underlying writer (see NewWriter).
 type Writer struct {
@@ -31,6 +31,8 @@ type dictDecoder struct {
 	wrPos int  // Current output position in buffer
 	rdPos int  // Have emitted hist[:rdPos] already
 	full  bool // Has a full window length been written yet?
+
+	flushed int64 // Total bytes returned by readFlush
 }
 
 // init initializes dictDecoder to have a sliding window dictionary of the given
@@ -63,6 +65,14 @@ func (dd *dictDecoder) histSize() int {
 	return dd.wrPos
 }
 
+// history appends the history to dst, oldest first.
+func (dd *dictDecoder) history(dst []byte) []byte {
+	if dd.full {
+		dst = append(dst, dd.hist[dd.wrPos:]...)
+	}
+	return append(dst, dd.hist[:dd.wrPos]...)
+}
+
 // availRead reports the number of bytes that can be flushed by readFlush.
 func (dd *dictDecoder) availRead() int {
 	return dd.wrPos - dd.rdPos
@@ -175,6 +185,7 @@ loop:
 // before calling any other dictDecoder methods.
 func (dd *dictDecoder) readFlush() []byte {
 	toRead := dd.hist[dd.rdPos:dd.wrPos]
+	dd.flushed += int64(len(toRead))
 	dd.rdPos = dd.wrPos
 	if dd.wrPos == len(dd.hist) {
 		dd.wrPos, dd.rdPos = 0, 0
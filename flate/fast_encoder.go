@@ -14,22 +14,23 @@ import (
 type fastEnc interface {
 	Encode(dst *tokens, src []byte)
 	Reset()
+	setMaxOffset(n int32)
 }
 
 func newFastEnc(level int) fastEnc {
 	switch level {
 	case 1:
-		return &fastEncL1{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL1{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	case 2:
-		return &fastEncL2{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL2{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	case 3:
-		return &fastEncL3{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL3{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	case 4:
-		return &fastEncL4{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL4{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	case 5:
-		return &fastEncL5{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL5{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	case 6:
-		return &fastEncL6{fastGen: fastGen{cur: maxStoreBlockSize}}
+		return &fastEncL6{fastGen: fastGen{cur: maxStoreBlockSize, maxOffset: maxMatchOffset}}
 	default:
 		panic("invalid level specified")
 	}
@@ -74,8 +75,14 @@ type tableEntry struct {
 // and the previous byte block for level 2.
 // This is the generic implementation.
 type fastGen struct {
-	hist []byte
-	cur  int32
+	hist      []byte
+	cur       int32
+	maxOffset int32 // The largest match offset emitted.
+}
+
+// setMaxOffset limits the offset of matches.
+func (e *fastGen) setMaxOffset(n int32) {
+	e.maxOffset = n
 }
 
 func (e *fastGen) addBlock(src []byte) int32 {
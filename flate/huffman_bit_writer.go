@@ -126,6 +126,14 @@ type huffmanBitWriter struct {
 
 	// codegen must have an extra space for the final symbol.
 	codegen [literalCount + offsetCodeCount + 1]uint8
+
+	// inspect is called with information about each block, if set.
+	// The output is then counted by counter.
+	inspect   func(BlockInfo)
+	counter   countWriter
+	inBlock   bool
+	info      BlockInfo
+	infoStart int64
 }
 
 // Huffman reuse.
@@ -159,6 +167,10 @@ func newHuffmanBitWriter(w io.Writer) *huffmanBitWriter {
 
 func (w *huffmanBitWriter) reset(writer io.Writer) {
 	w.writer = writer
+	if w.inspect != nil {
+		w.counter = countWriter{w: writer}
+		w.writer = &w.counter
+	}
 	w.bits, w.nbits, w.nbytes, w.err = 0, 0, 0, nil
 	w.lastHeader = 0
 	w.lastHuffMan = false
@@ -467,6 +479,9 @@ func (w *huffmanBitWriter) writeDynamicHeader(numLiterals int, numOffsets int, n
 	if w.err != nil {
 		return
 	}
+	if w.inspect != nil {
+		w.inspectHeader(BlockDynamic, isEof)
+	}
 	var firstBits int32 = 4
 	if isEof {
 		firstBits = 5
@@ -511,6 +526,13 @@ func (w *huffmanBitWriter) writeStoredHeader(length int, isEof bool) {
 	if w.err != nil {
 		return
 	}
+	if w.inspect != nil {
+		if !w.inBlock {
+			w.beginBlock()
+			defer w.endStored(length)
+		}
+		w.inspectHeader(BlockStored, isEof)
+	}
 	if w.lastHeader > 0 {
 		// We owe an EOB
 		w.writeCode(w.literalEncoding.codes[endBlockMarker])
@@ -545,6 +567,9 @@ func (w *huffmanBitWriter) writeFixedHeader(isEof bool) {
 		w.writeCode(w.literalEncoding.codes[endBlockMarker])
 		w.lastHeader = 0
 	}
+	if w.inspect != nil {
+		w.inspectHeader(BlockFixed, isEof)
+	}
 
 	// Indicate that we are a fixed Huffman block
 	var value int32 = 2
@@ -563,6 +588,10 @@ func (w *huffmanBitWriter) writeBlock(tokens *tokens, eof bool, input []byte) {
 	if w.err != nil {
 		return
 	}
+	if w.inspect != nil {
+		w.beginBlock()
+		defer w.endBlock(tokens, input)
+	}
 
 	tokens.AddEOB()
 	if w.lastHeader > 0 {
@@ -629,6 +658,10 @@ func (w *huffmanBitWriter) writeBlockDynamic(tokens *tokens, eof bool, input []b
 	if w.err != nil {
 		return
 	}
+	if w.inspect != nil {
+		w.beginBlock()
+		defer w.endBlock(tokens, input)
+	}
 
 	sync = sync || eof
 	if sync {
@@ -1000,6 +1033,10 @@ func (w *huffmanBitWriter) writeBlockHuff(eof bool, input []byte, sync bool) {
 	if w.err != nil {
 		return
 	}
+	if w.inspect != nil {
+		w.beginBlock()
+		defer w.endBlock(nil, input)
+	}
 
 	// Clear histogram
 	for i := range w.literalFreq[:] {
@@ -10,6 +10,7 @@ package flate
 import (
 	"bufio"
 	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
 	"math/bits"
@@ -26,6 +27,10 @@ const (
 	maxNumDist = 30
 	numCodes   = 19 // number of codes in Huffman meta-code
 
+	// Deflate64 uses distance codes 30 and 31 for a 64KB window.
+	maxNumDist64 = 32
+	windowSize64 = 1 << 16
+
 	debugDecode = false
 )
 
@@ -295,9 +300,12 @@ type decompressor struct {
 	h1, h2 huffmanDecoder
 
 	// Length arrays used to define Huffman codes.
-	bits     *[maxNumLit + maxNumDist]int
+	bits     *[maxNumLit + maxNumDist64]int
 	codebits *[numCodes]int
 
+	// Number of literal/length and distance codes in bits.
+	nlit, ndist int
+
 	// Output history, buffer.
 	dict dictDecoder
 
@@ -319,9 +327,48 @@ type decompressor struct {
 
 	nb    uint
 	final bool
+
+	// deflate64 enables Deflate64 (enhanced deflate) decoding.
+	deflate64 bool
+
+	// maxDist limits the window size, if not zero.
+	maxDist int
+
+	// Checkpoint callback, minimum distance and output offset of the last checkpoint.
+	checkpoint     func(Checkpoint)
+	checkpointSpan int64
+	lastCheckpoint int64
+	window         []byte
+
+	// Number of bits to skip before the first block.
+	skipBits uint
+
+	// blockStart is called at the start of each block, if set.
+	blockStart func(BlockPosition)
+
+	// Output limits and the output counted against them.
+	limits   ReaderLimits
+	limitOut int64
+}
+
+// Checkpoint contains the decoder state at the start of a deflate block.
+// Decoding can be resumed from a checkpoint using NewReaderBits.
+type Checkpoint struct {
+	// In is the offset of the block in bits from the start of the input.
+	In int64
+
+	// Out is the offset of the block in the output.
+	Out int64
+
+	// Window contains the output preceding the block, up to the window size.
+	Window []byte
 }
 
 func (f *decompressor) nextBlock() {
+	if f.checkpoint != nil {
+		f.doCheckpoint()
+	}
+	start := f.roffset*8 - int64(f.nb)
 	for f.nb < 1+2 {
 		if f.err = f.moreBits(); f.err != nil {
 			return
@@ -332,6 +379,14 @@ func (f *decompressor) nextBlock() {
 	typ := f.b & 3
 	f.b >>= 2
 	f.nb -= 1 + 2
+	if f.blockStart != nil && typ < 3 {
+		f.blockStart(BlockPosition{
+			Type:  BlockType(typ),
+			Final: f.final,
+			Start: start,
+			Out:   f.dict.flushed + int64(f.dict.availRead()),
+		})
+	}
 	switch typ {
 	case 0:
 		f.dataBlock()
@@ -366,6 +421,34 @@ func (f *decompressor) nextBlock() {
 	}
 }
 
+// doCheckpoint calls the checkpoint function
+// if at least checkpointSpan bytes have been output since the last checkpoint.
+func (f *decompressor) doCheckpoint() {
+	out := f.dict.flushed + int64(f.dict.availRead())
+	if out == 0 || out-f.lastCheckpoint < f.checkpointSpan {
+		return
+	}
+	f.lastCheckpoint = out
+	f.window = f.dict.history(f.window[:0])
+	f.checkpoint(Checkpoint{
+		In:     f.roffset*8 - int64(f.nb),
+		Out:    out,
+		Window: f.window,
+	})
+}
+
+// skipStart skips the first bits of the input and continues with the first block.
+func (f *decompressor) skipStart() {
+	for f.nb < f.skipBits {
+		if f.err = f.moreBits(); f.err != nil {
+			return
+		}
+	}
+	f.b >>= f.skipBits
+	f.nb -= f.skipBits
+	f.step = (*decompressor).nextBlock
+}
+
 func (f *decompressor) Read(b []byte) (int, error) {
 	for {
 		if len(f.toRead) > 0 {
@@ -383,6 +466,7 @@ func (f *decompressor) Read(b []byte) (int, error) {
 		if f.err != nil && len(f.toRead) == 0 {
 			f.toRead = f.dict.readFlush() // Flush what's left in case of error
 		}
+		f.limitOutput()
 	}
 }
 
@@ -416,6 +500,7 @@ func (f *decompressor) WriteTo(w io.Writer) (int64, error) {
 			f.toRead = f.dict.readFlush() // Flush what's left in case of error
 			flushed = true
 		}
+		f.limitOutput()
 	}
 }
 
@@ -447,7 +532,7 @@ func (f *decompressor) readHuffman() error {
 	}
 	f.b >>= 5
 	ndist := int(f.b&0x1F) + 1
-	if ndist > maxNumDist {
+	if ndist > maxNumDist && !f.deflate64 {
 		if debugDecode {
 			fmt.Println("ndist > maxNumDist", ndist)
 		}
@@ -542,12 +627,19 @@ func (f *decompressor) readHuffman() error {
 		}
 	}
 
+	return f.initHuffman(nlit, ndist)
+}
+
+// initHuffman initializes the literal/length and distance decoders
+// from the first nlit+ndist code lengths in f.bits.
+func (f *decompressor) initHuffman(nlit, ndist int) error {
 	if !f.h1.init(f.bits[0:nlit]) || !f.h2.init(f.bits[nlit:nlit+ndist]) {
 		if debugDecode {
 			fmt.Println("init2 failed")
 		}
 		return CorruptInputError(f.roffset)
 	}
+	f.nlit, f.ndist = nlit, ndist
 
 	// As an optimization, we can initialize the maxRead bits to read at a time
 	// for the HLIT tree to the length of the EOB marker since we know that
@@ -581,7 +673,6 @@ func (f *decompressor) dataBlock() {
 	f.buf[2] = uint8(f.b >> 16)
 	f.buf[3] = uint8(f.b >> 24)
 
-	f.roffset += int64(offBytes)
 	f.nb, f.b = 0, 0
 
 	// Length then ones-complement of length.
@@ -741,18 +832,33 @@ func fixedHuffmanDecoderInit() {
 
 func (f *decompressor) Reset(r io.Reader, dict []byte) error {
 	*f = decompressor{
-		r:        makeReader(r),
-		bits:     f.bits,
-		codebits: f.codebits,
-		h1:       f.h1,
-		h2:       f.h2,
-		dict:     f.dict,
-		step:     (*decompressor).nextBlock,
-	}
-	f.dict.init(maxMatchOffset, dict)
+		r:         makeReader(r),
+		bits:      f.bits,
+		codebits:  f.codebits,
+		h1:        f.h1,
+		h2:        f.h2,
+		dict:      f.dict,
+		step:      (*decompressor).nextBlock,
+		deflate64: f.deflate64,
+		maxDist:   f.maxDist,
+
+		checkpoint:     f.checkpoint,
+		checkpointSpan: f.checkpointSpan,
+		window:         f.window,
+		limits:         f.limits,
+	}
+	f.dict.init(f.windowSize(), dict)
 	return nil
 }
 
+// windowSize returns the size of the history.
+func (f *decompressor) windowSize() int {
+	if f.deflate64 {
+		return windowSize64
+	}
+	return maxMatchOffset
+}
+
 // NewReader returns a new ReadCloser that can be used
 // to read the uncompressed version of r.
 // If r does not also implement io.ByteReader,
@@ -761,12 +867,20 @@ func (f *decompressor) Reset(r io.Reader, dict []byte) error {
 // when finished reading.
 //
 // The ReadCloser returned by NewReader also implements Resetter.
+//
+// It also implements encoding.BinaryMarshaler and encoding.BinaryUnmarshaler,
+// so decompression can be stopped and resumed, possibly in another process.
+// The state contains the history, pending output and input bits and the current block.
+// UnmarshalBinary keeps the current input, which must continue where the
+// input of the marshaled reader stopped.
+// Use an input that implements io.ByteReader to make sure no more input
+// is read than what has been consumed by the decompressor.
 func NewReader(r io.Reader) io.ReadCloser {
 	fixedHuffmanDecoderInit()
 
 	var f decompressor
 	f.r = makeReader(r)
-	f.bits = new([maxNumLit + maxNumDist]int)
+	f.bits = new([maxNumLit + maxNumDist64]int)
 	f.codebits = new([numCodes]int)
 	f.step = (*decompressor).nextBlock
 	f.dict.init(maxMatchOffset, nil)
@@ -785,9 +899,83 @@ func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
 
 	var f decompressor
 	f.r = makeReader(r)
-	f.bits = new([maxNumLit + maxNumDist]int)
+	f.bits = new([maxNumLit + maxNumDist64]int)
 	f.codebits = new([numCodes]int)
 	f.step = (*decompressor).nextBlock
 	f.dict.init(maxMatchOffset, dict)
 	return &f
 }
+
+// NewReader64 returns a new ReadCloser that can be used to read
+// the uncompressed version of r, compressed with Deflate64,
+// also known as enhanced deflate.
+// Deflate64 is used by zip files with method 9.
+// It extends deflate with a 64KB window, distance codes 30 and 31
+// and length code 285 with 16 extra bits.
+// Regular deflate streams that only use distance codes 0 to 29 and lengths
+// below 258 decode the same with both formats.
+//
+// The ReadCloser returned by NewReader64 also implements Resetter.
+func NewReader64(r io.Reader) io.ReadCloser {
+	fixedHuffmanDecoderInit()
+
+	var f decompressor
+	f.r = makeReader(r)
+	f.bits = new([maxNumLit + maxNumDist64]int)
+	f.codebits = new([numCodes]int)
+	f.step = (*decompressor).nextBlock
+	f.deflate64 = true
+	f.dict.init(windowSize64, nil)
+	return &f
+}
+
+// NewReaderCheckpoints returns a new ReadCloser like NewReader,
+// which calls fn with the decoder state at the start of deflate blocks.
+// fn is called at the first block starting at least span bytes
+// after the previous checkpoint or the start of the output.
+// The Window of the checkpoint is only valid until fn returns.
+//
+// The ReadCloser returned by NewReaderCheckpoints also implements Resetter.
+// The checkpoint function is kept when the reader is reset.
+func NewReaderCheckpoints(r io.Reader, span int64, fn func(Checkpoint)) io.ReadCloser {
+	f := NewReader(r).(*decompressor)
+	f.checkpoint = fn
+	f.checkpointSpan = span
+	return f
+}
+
+// NewReaderWindow returns a new ReadCloser like NewReaderDict,
+// which only accepts streams with match distances within a window of 1<<windowBits bytes.
+// Streams referring further back return a CorruptInputError.
+// This can be used to check that a stream can be decompressed by a decoder with a smaller window.
+// windowBits must be between 8 and 15.
+//
+// The ReadCloser returned by NewReaderWindow also implements Resetter.
+func NewReaderWindow(r io.Reader, windowBits int, dict []byte) io.ReadCloser {
+	f := NewReaderDict(r, dict).(*decompressor)
+	if windowBits < MinWindowBits || windowBits > MaxWindowBits {
+		f.err = fmt.Errorf("flate: invalid window bits %d: want value in range [%d, %d]", windowBits, MinWindowBits, MaxWindowBits)
+		return f
+	}
+	f.maxDist = 1 << windowBits
+	return f
+}
+
+// NewReaderBits returns a new ReadCloser like NewReaderDict,
+// which skips the first bits (0 to 7) of r before decoding.
+// This allows decoding to resume at a Checkpoint,
+// by reading from byte In/8 with In%8 bits skipped and the Window as dictionary.
+// Decoding continues until the final block.
+//
+// The ReadCloser returned by NewReaderBits also implements Resetter.
+// Reset will not skip any bits.
+func NewReaderBits(r io.Reader, bits int, dict []byte) io.ReadCloser {
+	f := NewReaderDict(r, dict).(*decompressor)
+	if bits < 0 || bits > 7 {
+		f.err = errors.New("flate: bits to skip must be between 0 and 7")
+		return f
+	}
+	f.skipBits = uint(bits)
+	f.step = (*decompressor).skipStart
+	return f
+}
@@ -100,6 +100,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -194,7 +198,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -227,10 +231,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -351,6 +355,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -445,7 +453,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -478,10 +486,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -602,6 +610,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -696,7 +708,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -729,10 +741,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -853,6 +865,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -947,7 +963,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -980,10 +996,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -1104,6 +1120,10 @@ readLiteral:
 			length = v - (257 - 3)
 		case v < maxNumLit:
 			val := decCodeToLen[(v - 257)]
+			if v == maxNumLit-1 && f.deflate64 {
+				// Deflate64 length code 285 has 16 extra bits.
+				val = lengthExtra{extra: 16}
+			}
 			length = int(val.length) + 3
 			n := uint(val.extra)
 			for fnb < n {
@@ -1198,7 +1218,7 @@ readLiteral:
 		switch {
 		case dist < 4:
 			dist++
-		case dist < maxNumDist:
+		case dist < maxNumDist, dist < maxNumDist64 && f.deflate64:
 			nb := uint(dist-2) >> 1
 			// have 1 bit in bottom of dist, need nb more.
 			extra := (dist & 1) << (nb & regSizeMaskUint32)
@@ -1231,10 +1251,10 @@ readLiteral:
 		}
 
 		// No check on length; encoding can be prescient.
-		if dist > uint32(dict.histSize()) {
+		if dist > uint32(dict.histSize()) || (f.maxDist > 0 && dist > uint32(f.maxDist)) {
 			f.b, f.nb = fb, fnb
 			if debugDecode {
-				fmt.Println("dist > dict.histSize():", dist, dict.histSize())
+				fmt.Println("dist > dict.histSize():", dist, dict.histSize(), f.maxDist)
 			}
 			f.err = CorruptInputError(f.roffset)
 			return
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 	"testing"
@@ -279,3 +280,153 @@ func TestWriteTo(t *testing.T) {
 		t.Fatal("output did not match input")
 	}
 }
+
+// deflate64Stream returns a Deflate64 stream with a stored block containing data,
+// followed by a fixed Huffman block with a copy of length 1000 at distance 40000.
+func deflate64Stream(data []byte) []byte {
+	var out []byte
+	var bits uint64
+	var nbits uint
+	writeBits := func(v uint64, n uint) {
+		bits |= v << nbits
+		nbits += n
+		for nbits >= 8 {
+			out = append(out, byte(bits))
+			bits >>= 8
+			nbits -= 8
+		}
+	}
+	// Huffman codes are written most significant bit first.
+	writeCode := func(code uint64, n uint) {
+		var rev uint64
+		for i := uint(0); i < n; i++ {
+			rev = rev<<1 | (code>>i)&1
+		}
+		writeBits(rev, n)
+	}
+
+	// Stored block, not final.
+	writeBits(0, 3)
+	writeBits(0, 5)
+	out = append(out, byte(len(data)), byte(len(data)>>8), ^byte(len(data)), ^byte(len(data)>>8))
+	out = append(out, data...)
+
+	// Fixed Huffman block, final.
+	writeBits(1, 1)
+	writeBits(1, 2)
+	// Length code 285 with 16 extra bits: length 3+997.
+	writeCode(0xc0+285-280, 8)
+	writeBits(997, 16)
+	// Distance code 30 with 14 extra bits: distance 32769+7231.
+	writeCode(30, 5)
+	writeBits(7231, 14)
+	// End of block.
+	writeCode(0, 7)
+	writeBits(0, 7)
+	return out
+}
+
+func TestReader64(t *testing.T) {
+	data := make([]byte, 40000)
+	rand.Read(data)
+	want := append(append([]byte{}, data...), data[:1000]...)
+	stream := deflate64Stream(data)
+
+	r := NewReader64(bytes.NewReader(stream))
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("output mismatch, got %d bytes, want %d", len(got), len(want))
+	}
+
+	// Reset must keep Deflate64 mode.
+	if err := r.(Resetter).Reset(bytes.NewReader(stream), nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("output mismatch after Reset")
+	}
+
+	// Distance code 30 is invalid in regular deflate.
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(stream))); err == nil {
+		t.Fatal("expected error decoding Deflate64 as deflate")
+	}
+
+	// Regular deflate streams without 258 byte matches decode the same.
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, BestSpeed)
+	w.Write(data)
+	w.Close()
+	got, err = io.ReadAll(NewReader64(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("deflate output mismatch")
+	}
+}
+
+func TestReaderCheckpoints(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	data = append(data, data...)
+	for _, level := range []int{NoCompression, BestSpeed, DefaultCompression, HuffmanOnly} {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, level)
+		// Write in parts, so different block types are produced.
+		for in := data; len(in) > 0; {
+			n := 50000
+			if n > len(in) {
+				n = len(in)
+			}
+			w.Write(in[:n])
+			w.Flush()
+			in = in[n:]
+		}
+		w.Close()
+		comp := buf.Bytes()
+
+		var points []Checkpoint
+		const span = 60000
+		r := NewReaderCheckpoints(bytes.NewReader(comp), span, func(c Checkpoint) {
+			c.Window = append([]byte{}, c.Window...)
+			points = append(points, c)
+		})
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("level %d: output mismatch", level)
+		}
+		if len(points) < 2 {
+			t.Fatalf("level %d: got %d checkpoints", level, len(points))
+		}
+		var last int64
+		for i, c := range points {
+			if c.Out-last < span {
+				t.Fatalf("level %d: checkpoint %d at %d, previous at %d", level, i, c.Out, last)
+			}
+			last = c.Out
+			if want := data[:c.Out]; !bytes.HasSuffix(want, c.Window) || len(c.Window) != maxMatchOffset {
+				t.Fatalf("level %d: checkpoint %d: bad window", level, i)
+			}
+			got, err := io.ReadAll(NewReaderBits(bytes.NewReader(comp[c.In/8:]), int(c.In%8), c.Window))
+			if err != nil {
+				t.Fatalf("level %d: checkpoint %d: %v", level, i, err)
+			}
+			if !bytes.Equal(got, data[c.Out:]) {
+				t.Fatalf("level %d: checkpoint %d: output mismatch", level, i)
+			}
+		}
+		t.Logf("level %d: %d checkpoints", level, len(points))
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"io"
+)
+
+// BlockType is the type of a deflate block.
+type BlockType uint8
+
+const (
+	// BlockStored is an uncompressed block.
+	BlockStored BlockType = iota
+	// BlockFixed is a block using the fixed Huffman codes defined by the RFC.
+	BlockFixed
+	// BlockDynamic is a block with its own Huffman codes.
+	BlockDynamic
+)
+
+func (t BlockType) String() string {
+	switch t {
+	case BlockStored:
+		return "stored"
+	case BlockFixed:
+		return "fixed"
+	case BlockDynamic:
+		return "dynamic"
+	}
+	return "invalid"
+}
+
+// BlockInfo describes the output of the compressor.
+// It is reported for each group of tokens written.
+//
+// With dynamic Huffman codes the compressor may continue a block with the
+// next group of tokens, reusing the codes. The following group is then
+// reported with Continued set.
+type BlockInfo struct {
+	// Type is the block type.
+	Type BlockType
+
+	// Continued is set if the tokens continue the previous dynamic block,
+	// so no block header was written.
+	Continued bool
+
+	// Final is set on the last block of the stream.
+	Final bool
+
+	// Size is the number of uncompressed bytes in the block.
+	Size int
+
+	// Literals and Matches are the number of literal and match tokens.
+	// Stored blocks contain no tokens.
+	Literals, Matches int
+
+	// LitLenHist contains the number of times each literal/length symbol is used.
+	// Symbol 256 is the end of block marker, which is only counted if the block ends.
+	// OffsetHist contains the number of times each offset symbol is used.
+	// Both are nil for stored and empty blocks.
+	LitLenHist, OffsetHist []int
+
+	// LitLenBits and OffsetBits are the Huffman code lengths of each symbol.
+	// Unused symbols have length 0. Both are nil for stored and empty blocks.
+	LitLenBits, OffsetBits []uint8
+
+	// Bits is the number of bits written, including the header and
+	// any end of block marker owed by the previous block.
+	Bits int
+}
+
+// SetBlockCallback makes the compressor call fn with information about
+// each block after it has been written.
+// This is intended for analyzing how data is compressed and slows down compression.
+// A nil fn disables the callback.
+// The callback is kept when the Writer is Reset.
+func (w *Writer) SetBlockCallback(fn func(BlockInfo)) {
+	w.d.w.setInspect(fn)
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// setInspect sets the callback for each block written.
+func (w *huffmanBitWriter) setInspect(fn func(BlockInfo)) {
+	if cw, ok := w.writer.(*countWriter); ok && cw == &w.counter {
+		w.writer = cw.w
+	}
+	w.inspect = fn
+	if fn != nil {
+		w.counter = countWriter{w: w.writer}
+		w.writer = &w.counter
+	}
+}
+
+// bitPos returns the number of bits written when inspecting.
+func (w *huffmanBitWriter) bitPos() int64 {
+	return w.counter.n*8 + int64(w.nbytes)*8 + int64(w.nbits)
+}
+
+// beginBlock starts collecting information about a block.
+// Unless a header is written, the block continues the previous.
+func (w *huffmanBitWriter) beginBlock() {
+	w.inBlock = true
+	w.info = BlockInfo{Type: BlockDynamic, Continued: true}
+	w.infoStart = w.bitPos()
+}
+
+// inspectHeader records the header of the block being written.
+func (w *huffmanBitWriter) inspectHeader(t BlockType, eof bool) {
+	w.info.Type, w.info.Final, w.info.Continued = t, eof, false
+}
+
+// endStored reports a stored block of length bytes written without tokens.
+// The data is written after the report.
+func (w *huffmanBitWriter) endStored(length int) {
+	w.inBlock = false
+	if w.err != nil {
+		return
+	}
+	info := w.info
+	info.Size = length
+	info.Bits = int(w.bitPos()-w.infoStart) + length*8
+	w.inspect(info)
+}
+
+// endBlock reports the block written from t or, if t is nil, from literals in input.
+func (w *huffmanBitWriter) endBlock(t *tokens, input []byte) {
+	w.inBlock = false
+	if w.err != nil {
+		return
+	}
+	info := w.info
+	info.Bits = int(w.bitPos() - w.infoStart)
+	if info.Type == BlockStored {
+		info.Size = len(input)
+		w.inspect(info)
+		return
+	}
+
+	info.LitLenHist = make([]int, literalCount)
+	info.OffsetHist = make([]int, offsetCodeCount)
+	if t == nil {
+		for _, b := range input {
+			info.LitLenHist[b]++
+		}
+		if w.lastHeader == 0 {
+			info.LitLenHist[endBlockMarker]++
+		}
+		info.Literals, info.Size = len(input), len(input)
+	} else {
+		for _, tok := range t.Slice() {
+			switch {
+			case tok == endBlockMarker:
+				info.LitLenHist[endBlockMarker]++
+			case tok < matchType:
+				info.LitLenHist[tok.literal()]++
+				info.Literals++
+				info.Size++
+			default:
+				info.LitLenHist[lengthCodesStart+int(lengthCode(tok.length())&31)]++
+				info.OffsetHist[(tok.offset()>>16)&31]++
+				info.Matches++
+				info.Size += int(tok.length()) + baseMatchLength
+			}
+		}
+	}
+
+	litEnc, offEnc := w.literalEncoding, w.offsetEncoding
+	switch {
+	case info.Type == BlockFixed:
+		litEnc, offEnc = fixedLiteralEncoding, fixedOffsetEncoding
+	case t == nil:
+		// Literals only.
+		offEnc = huffOffset
+	}
+	info.LitLenBits = make([]uint8, literalCount)
+	for i := range info.LitLenBits {
+		info.LitLenBits[i] = litEnc.codes[i].len()
+	}
+	info.OffsetBits = make([]uint8, offsetCodeCount)
+	for i := range info.OffsetBits {
+		info.OffsetBits[i] = offEnc.codes[i].len()
+	}
+	w.inspect(info)
+}
+
+// BlockPosition describes a block found by WalkBlocks.
+type BlockPosition struct {
+	// Type is the block type.
+	Type BlockType
+
+	// Final is set on the last block of the stream.
+	Final bool
+
+	// Start is the offset in bits of the block header in the input,
+	// and End is the offset in bits after the block.
+	Start, End int64
+
+	// Out is the offset of the block in the uncompressed output,
+	// and Size is the number of uncompressed bytes in the block.
+	Out, Size int64
+}
+
+// WalkBlocks decompresses the deflate stream in r and calls fn for each block.
+// Decompression stops at the end of the final block.
+// If r does not implement io.ByteReader, more data than necessary may be read from r.
+func WalkBlocks(r io.Reader, fn func(BlockPosition)) error {
+	f := NewReader(r).(*decompressor)
+	var cur BlockPosition
+	started := false
+	f.blockStart = func(b BlockPosition) {
+		if started {
+			cur.End = b.Start
+			cur.Size = b.Out - cur.Out
+			fn(cur)
+		}
+		cur, started = b, true
+	}
+	out, err := io.Copy(io.Discard, f)
+	if err != nil {
+		return err
+	}
+	if started {
+		cur.End = f.roffset*8 - int64(f.nb)
+		cur.Size = out - cur.Out
+		fn(cur)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestBlockCallback(t *testing.T) {
+	text, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	rnd := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(rnd)
+	data := append(append(append([]byte{}, text...), rnd...), text[:50000]...)
+
+	for level := HuffmanOnly; level <= BestCompression+1; level++ {
+		var buf bytes.Buffer
+		var w *Writer
+		if level > BestCompression {
+			w = NewWriterOptimal(&buf, 2)
+		} else {
+			w, _ = NewWriter(&buf, level)
+		}
+		var infos []BlockInfo
+		w.SetBlockCallback(func(b BlockInfo) {
+			infos = append(infos, b)
+		})
+		// Write in pieces with a flush to get several block types.
+		w.Write(data[:len(data)/2])
+		w.Flush()
+		w.Write(data[len(data)/2:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var size, bits int
+		for i, b := range infos {
+			size += b.Size
+			bits += b.Bits
+			if b.Final != (i == len(infos)-1) {
+				t.Errorf("level %d: block %d: final is %v", level, i, b.Final)
+			}
+			if b.Continued && (i == 0 || infos[i-1].Type != BlockDynamic) {
+				t.Errorf("level %d: block %d continues %v block", level, i, infos[i-1].Type)
+			}
+			if b.LitLenHist == nil {
+				continue
+			}
+			lits, matches := 0, 0
+			for sym, n := range b.LitLenHist {
+				if n > 0 && b.LitLenBits[sym] == 0 {
+					t.Fatalf("level %d: block %d: symbol %d used without a code", level, i, sym)
+				}
+				switch {
+				case sym < endBlockMarker:
+					lits += n
+				case sym > endBlockMarker:
+					matches += n
+				}
+			}
+			if lits != b.Literals || matches != b.Matches {
+				t.Errorf("level %d: block %d: histogram mismatch", level, i)
+			}
+		}
+		if size != len(data) {
+			t.Errorf("level %d: total size %d, want %d", level, size, len(data))
+		}
+		if bits > buf.Len()*8 || bits <= buf.Len()*8-16 {
+			t.Errorf("level %d: total bits %d, output is %d bits", level, bits, buf.Len()*8)
+		}
+
+		// Compare with the blocks found by the decoder.
+		var blocks []BlockPosition
+		err := WalkBlocks(bytes.NewReader(buf.Bytes()), func(b BlockPosition) {
+			blocks = append(blocks, b)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var end, out int64
+		i := 0
+		for j, b := range blocks {
+			if b.Start < end || b.Out != out {
+				t.Fatalf("level %d: block %d: start %d, out %d, want %d, %d", level, j, b.Start, b.Out, end, out)
+			}
+			end, out = b.End, b.Out+b.Size
+			if i >= len(infos) || infos[i].Type != b.Type || infos[i].Final != b.Final || infos[i].Continued {
+				t.Fatalf("level %d: block %d does not match", level, j)
+			}
+			size := int64(infos[i].Size)
+			for i++; i < len(infos) && infos[i].Continued; i++ {
+				size += int64(infos[i].Size)
+			}
+			if size != b.Size {
+				t.Errorf("level %d: block %d: size %d, want %d", level, j, b.Size, size)
+			}
+		}
+		if i != len(infos) || out != int64(len(data)) || end > int64(buf.Len())*8 || end <= int64(buf.Len()-1)*8 {
+			t.Errorf("level %d: walked %d of %d blocks, %d bytes, end %d bits", level, i, len(infos), out, end)
+		}
+	}
+}
+
+func TestWalkBlocksCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, 5)
+	w.Write(bytes.Repeat([]byte("hello world "), 1000))
+	w.Close()
+	b := buf.Bytes()
+	err := WalkBlocks(bytes.NewReader(b[:len(b)/2]), func(BlockPosition) {})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestBlockCallbackState(t *testing.T) {
+	data := bytes.Repeat([]byte("block callback state "), 10000)
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, BestSpeed)
+	var size int
+	w.SetBlockCallback(func(b BlockInfo) {
+		size += b.Size
+	})
+	w.Write(data[:len(data)/2])
+	w.Flush()
+	state, err := w.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UnmarshalBinary(state); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data[len(data)/2:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size != len(data) {
+		t.Errorf("callback got %d bytes, want %d", size, len(data))
+	}
+	got, err := io.ReadAll(NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("output mismatch")
+	}
+}
@@ -88,7 +88,7 @@ func (e *fastEncL2) Encode(dst *tokens, src []byte) {
 			nextHash = hashLen(now, bTableBits, hashBytes)
 
 			offset := s - (candidate.offset - e.cur)
-			if offset < maxMatchOffset && uint32(cv) == load3232(src, candidate.offset-e.cur) {
+			if offset < e.maxOffset && uint32(cv) == load3232(src, candidate.offset-e.cur) {
 				e.table[nextHash] = tableEntry{offset: nextS + e.cur}
 				break
 			}
@@ -102,7 +102,7 @@ func (e *fastEncL2) Encode(dst *tokens, src []byte) {
 			e.table[nextHash] = tableEntry{offset: s + e.cur}
 
 			offset = s - (candidate.offset - e.cur)
-			if offset < maxMatchOffset && uint32(cv) == load3232(src, candidate.offset-e.cur) {
+			if offset < e.maxOffset && uint32(cv) == load3232(src, candidate.offset-e.cur) {
 				break
 			}
 			cv = now
@@ -194,7 +194,7 @@ func (e *fastEncL2) Encode(dst *tokens, src []byte) {
 			e.table[currHash] = tableEntry{offset: o + 2}
 
 			offset := s - (candidate.offset - e.cur)
-			if offset > maxMatchOffset || uint32(x>>16) != load3232(src, candidate.offset-e.cur) {
+			if offset > e.maxOffset || uint32(x>>16) != load3232(src, candidate.offset-e.cur) {
 				cv = x >> 24
 				s++
 				break
@@ -86,7 +86,7 @@ func (e *fastEncL3) Encode(dst *tokens, src []byte) {
 			now := load6432(src, nextS)
 
 			// Safe offset distance until s + 4...
-			minOffset := e.cur + s - (maxMatchOffset - 4)
+			minOffset := e.cur + s - (e.maxOffset - 4)
 			e.table[nextHash] = tableEntryPrev{Prev: candidates.Cur, Cur: tableEntry{offset: s + e.cur}}
 
 			// Check both candidates
@@ -210,7 +210,7 @@ func (e *fastEncL3) Encode(dst *tokens, src []byte) {
 
 			// Check both candidates
 			candidate = candidates.Cur
-			minOffset := e.cur + s - (maxMatchOffset - 4)
+			minOffset := e.cur + s - (e.maxOffset - 4)
 
 			if candidate.offset > minOffset {
 				if uint32(cv) == load3232(src, candidate.offset-e.cur) {
@@ -110,7 +110,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 			nextHashL = hash7(next, tableBits)
 
 			t = lCandidate.Cur.offset - e.cur
-			if s-t < maxMatchOffset {
+			if s-t < e.maxOffset {
 				if uint32(cv) == load3232(src, lCandidate.Cur.offset-e.cur) {
 					// Store the next match
 					e.table[nextHashS] = tableEntry{offset: nextS + e.cur}
@@ -118,7 +118,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 					eLong.Cur, eLong.Prev = tableEntry{offset: nextS + e.cur}, eLong.Cur
 
 					t2 := lCandidate.Prev.offset - e.cur
-					if s-t2 < maxMatchOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
+					if s-t2 < e.maxOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
 						l = e.matchlen(s+4, t+4, src) + 4
 						ml1 := e.matchlen(s+4, t2+4, src) + 4
 						if ml1 > l {
@@ -130,7 +130,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 					break
 				}
 				t = lCandidate.Prev.offset - e.cur
-				if s-t < maxMatchOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
+				if s-t < e.maxOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
 					// Store the next match
 					e.table[nextHashS] = tableEntry{offset: nextS + e.cur}
 					eLong := &e.bTable[nextHashL]
@@ -140,7 +140,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 			}
 
 			t = sCandidate.offset - e.cur
-			if s-t < maxMatchOffset && uint32(cv) == load3232(src, sCandidate.offset-e.cur) {
+			if s-t < e.maxOffset && uint32(cv) == load3232(src, sCandidate.offset-e.cur) {
 				// Found a 4 match...
 				l = e.matchlen(s+4, t+4, src) + 4
 				lCandidate = e.bTable[nextHashL]
@@ -152,7 +152,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 
 				// If the next long is a candidate, use that...
 				t2 := lCandidate.Cur.offset - e.cur
-				if nextS-t2 < maxMatchOffset {
+				if nextS-t2 < e.maxOffset {
 					if load3232(src, lCandidate.Cur.offset-e.cur) == uint32(next) {
 						ml := e.matchlen(nextS+4, t2+4, src) + 4
 						if ml > l {
@@ -164,7 +164,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 					}
 					// If the previous long is a candidate, use that...
 					t2 = lCandidate.Prev.offset - e.cur
-					if nextS-t2 < maxMatchOffset && load3232(src, lCandidate.Prev.offset-e.cur) == uint32(next) {
+					if nextS-t2 < e.maxOffset && load3232(src, lCandidate.Prev.offset-e.cur) == uint32(next) {
 						ml := e.matchlen(nextS+4, t2+4, src) + 4
 						if ml > l {
 							t = t2
@@ -202,7 +202,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 			t2 := eLong - e.cur - l + skipBeginning
 			s2 := s + skipBeginning
 			off := s2 - t2
-			if t2 >= 0 && off < maxMatchOffset && off > 0 {
+			if t2 >= 0 && off < e.maxOffset && off > 0 {
 				if l2 := e.matchlenLong(s2, t2, src); l2 > l {
 					t = t2
 					l = l2
@@ -232,7 +232,7 @@ func (e *fastEncL5) Encode(dst *tokens, src []byte) {
 			if t >= s {
 				panic(fmt.Sprintln("s-t", s, t))
 			}
-			if (s - t) > maxMatchOffset {
+			if (s - t) > e.maxOffset {
 				panic(fmt.Sprintln("mmo", s-t))
 			}
 			if l < baseMatchLength {
@@ -112,7 +112,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 			nextHashL = hash7(next, tableBits)
 
 			t = lCandidate.Cur.offset - e.cur
-			if s-t < maxMatchOffset {
+			if s-t < e.maxOffset {
 				if uint32(cv) == load3232(src, lCandidate.Cur.offset-e.cur) {
 					// Long candidate matches at least 4 bytes.
 
@@ -123,7 +123,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 
 					// Check the previous long candidate as well.
 					t2 := lCandidate.Prev.offset - e.cur
-					if s-t2 < maxMatchOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
+					if s-t2 < e.maxOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
 						l = e.matchlen(s+4, t+4, src) + 4
 						ml1 := e.matchlen(s+4, t2+4, src) + 4
 						if ml1 > l {
@@ -136,7 +136,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 				}
 				// Current value did not match, but check if previous long value does.
 				t = lCandidate.Prev.offset - e.cur
-				if s-t < maxMatchOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
+				if s-t < e.maxOffset && uint32(cv) == load3232(src, lCandidate.Prev.offset-e.cur) {
 					// Store the next match
 					e.table[nextHashS] = tableEntry{offset: nextS + e.cur}
 					eLong := &e.bTable[nextHashL]
@@ -146,7 +146,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 			}
 
 			t = sCandidate.offset - e.cur
-			if s-t < maxMatchOffset && uint32(cv) == load3232(src, sCandidate.offset-e.cur) {
+			if s-t < e.maxOffset && uint32(cv) == load3232(src, sCandidate.offset-e.cur) {
 				// Found a 4 match...
 				l = e.matchlen(s+4, t+4, src) + 4
 
@@ -174,7 +174,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 
 				// If the next long is a candidate, use that...
 				t2 = lCandidate.Cur.offset - e.cur
-				if nextS-t2 < maxMatchOffset {
+				if nextS-t2 < e.maxOffset {
 					if load3232(src, lCandidate.Cur.offset-e.cur) == uint32(next) {
 						ml := e.matchlen(nextS+4, t2+4, src) + 4
 						if ml > l {
@@ -186,7 +186,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 					}
 					// If the previous long is a candidate, use that...
 					t2 = lCandidate.Prev.offset - e.cur
-					if nextS-t2 < maxMatchOffset && load3232(src, lCandidate.Prev.offset-e.cur) == uint32(next) {
+					if nextS-t2 < e.maxOffset && load3232(src, lCandidate.Prev.offset-e.cur) == uint32(next) {
 						ml := e.matchlen(nextS+4, t2+4, src) + 4
 						if ml > l {
 							t = t2
@@ -225,7 +225,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 			t2 := eLong.Cur.offset - e.cur - l + skipBeginning
 			s2 := s + skipBeginning
 			off := s2 - t2
-			if off < maxMatchOffset {
+			if off < e.maxOffset {
 				if off > 0 && t2 >= 0 {
 					if l2 := e.matchlenLong(s2, t2, src); l2 > l {
 						t = t2
@@ -236,7 +236,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 				// Test next:
 				t2 = eLong.Prev.offset - e.cur - l + skipBeginning
 				off := s2 - t2
-				if off > 0 && off < maxMatchOffset && t2 >= 0 {
+				if off > 0 && off < e.maxOffset && t2 >= 0 {
 					if l2 := e.matchlenLong(s2, t2, src); l2 > l {
 						t = t2
 						l = l2
@@ -267,7 +267,7 @@ func (e *fastEncL6) Encode(dst *tokens, src []byte) {
 			if t >= s {
 				panic(fmt.Sprintln("s-t", s, t))
 			}
-			if (s - t) > maxMatchOffset {
+			if (s - t) > e.maxOffset {
 				panic(fmt.Sprintln("mmo", s-t))
 			}
 			if l < baseMatchLength {
@@ -0,0 +1,107 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+// ratioMinOutput is the output allowed regardless of ReaderLimits.MaxRatio.
+const ratioMinOutput = 1 << 20
+
+// ReaderLimits limits the output of a decompressor.
+// This protects against decompression bombs,
+// small inputs which decompress to huge outputs.
+// Zero values disable the limits.
+//
+// The same limits are used by the gzip, zlib and zip packages.
+type ReaderLimits struct {
+	// MaxSize is the maximum number of bytes output.
+	MaxSize int64
+
+	// MaxRatio is the maximum number of output bytes per input byte.
+	// Since small inputs can have high ratios, the ratio
+	// is only checked when the output exceeds 1MB.
+	MaxRatio int64
+
+	// MaxMembers is the maximum number of members in a gzip stream.
+	// It is ignored by other formats.
+	MaxMembers int
+}
+
+// Limit names used by LimitError.
+const (
+	LimitSize    = "size"
+	LimitRatio   = "ratio"
+	LimitMembers = "members"
+)
+
+// A LimitError is returned when the output exceeds the ReaderLimits.
+// The output up to the limit is returned before the error.
+type LimitError struct {
+	Limit string // LimitSize, LimitRatio or LimitMembers.
+	Value int64  // The value of the exceeded limit.
+}
+
+func (e *LimitError) Error() string {
+	return "flate: decompression " + e.Limit + " limit of " + strconv.FormatInt(e.Value, 10) + " exceeded"
+}
+
+// Allow returns how many of n bytes can be output after out bytes
+// have been output from in bytes of input.
+// If the limits do not allow all n bytes, a *LimitError is returned as well.
+func (l ReaderLimits) Allow(in, out int64, n int) (int, error) {
+	end := out + int64(n)
+	if l.MaxSize > 0 && end > l.MaxSize {
+		return allowed(l.MaxSize - out), &LimitError{Limit: LimitSize, Value: l.MaxSize}
+	}
+	if l.MaxRatio > 0 && end > ratioMinOutput && in <= math.MaxInt64/l.MaxRatio {
+		max := in * l.MaxRatio
+		if max < ratioMinOutput {
+			max = ratioMinOutput
+		}
+		if end > max {
+			return allowed(max - out), &LimitError{Limit: LimitRatio, Value: l.MaxRatio}
+		}
+	}
+	return n, nil
+}
+
+// allowed returns n clamped to 0.
+func allowed(n int64) int {
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// NewReaderLimits returns a new ReadCloser like NewReaderDict,
+// which returns a *LimitError when the output exceeds limits.
+// The input and output are counted from the start of the stream.
+//
+// The ReadCloser returned by NewReaderLimits also implements Resetter.
+// The limits are kept when the reader is reset.
+// The output counted against the limits is part of the state saved by MarshalBinary,
+// while the limits themselves are those of the reader calling UnmarshalBinary.
+func NewReaderLimits(r io.Reader, limits ReaderLimits, dict []byte) io.ReadCloser {
+	f := NewReaderDict(r, dict).(*decompressor)
+	f.limits = limits
+	return f
+}
+
+// limitOutput applies the limits to the output in f.toRead.
+func (f *decompressor) limitOutput() {
+	if len(f.toRead) == 0 || f.limits == (ReaderLimits{}) {
+		return
+	}
+	n, err := f.limits.Allow(f.roffset, f.limitOut, len(f.toRead))
+	f.limitOut += int64(n)
+	if err != nil {
+		f.toRead = f.toRead[:n]
+		f.err = err
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReaderLimits(t *testing.T) {
+	data := bytes.Repeat([]byte("limits "), 1<<20)
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, BestSpeed)
+	w.Write(data)
+	w.Close()
+	ratio := int64(len(data)) / int64(buf.Len())
+
+	for _, tc := range []struct {
+		name   string
+		limits ReaderLimits
+		want   int64
+		limit  string
+	}{
+		{name: "none", want: int64(len(data))},
+		{name: "size", limits: ReaderLimits{MaxSize: 100000}, want: 100000, limit: LimitSize},
+		{name: "size-exact", limits: ReaderLimits{MaxSize: int64(len(data))}, want: int64(len(data))},
+		{name: "ratio", limits: ReaderLimits{MaxRatio: ratio / 2}, want: -1, limit: LimitRatio},
+		{name: "ratio-ok", limits: ReaderLimits{MaxRatio: ratio * 2}, want: int64(len(data))},
+		{name: "members", limits: ReaderLimits{MaxMembers: 1}, want: int64(len(data))},
+	} {
+		for _, writeTo := range []bool{false, true} {
+			r := NewReaderLimits(bytes.NewReader(buf.Bytes()), tc.limits, nil)
+			var got bytes.Buffer
+			var err error
+			if writeTo {
+				_, err = r.(io.WriterTo).WriteTo(&got)
+			} else {
+				_, err = io.Copy(&got, struct{ io.Reader }{r})
+			}
+			if !bytes.Equal(got.Bytes(), data[:got.Len()]) {
+				t.Fatalf("%s: output mismatch", tc.name)
+			}
+			var lerr *LimitError
+			if tc.limit == "" {
+				if err != nil || int64(got.Len()) != tc.want {
+					t.Errorf("%s: got %d bytes, err %v", tc.name, got.Len(), err)
+				}
+				continue
+			}
+			if !errors.As(err, &lerr) || lerr.Limit != tc.limit {
+				t.Errorf("%s: got error %v, want %s limit", tc.name, err, tc.limit)
+			}
+			if tc.want >= 0 && int64(got.Len()) != tc.want {
+				t.Errorf("%s: got %d bytes, want %d", tc.name, got.Len(), tc.want)
+			}
+			if r.Close() != err {
+				t.Errorf("%s: Close did not return the limit error", tc.name)
+			}
+
+			// Limits are kept when resetting.
+			r.(Resetter).Reset(bytes.NewReader(buf.Bytes()), nil)
+			if _, err2 := io.Copy(io.Discard, r); err2 == nil || err2.Error() != err.Error() {
+				t.Errorf("%s: after reset: got error %v, want %v", tc.name, err2, err)
+			}
+		}
+	}
+}
+
+func TestReaderLimitsState(t *testing.T) {
+	data := bytes.Repeat([]byte("limits "), 100000)
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, BestSpeed)
+	w.Write(data)
+	w.Close()
+	limits := ReaderLimits{MaxSize: 300000}
+
+	// Read part of the output, then continue in a new reader.
+	in := bytes.NewReader(buf.Bytes())
+	r := NewReaderLimits(in, limits, nil)
+	got := make([]byte, 200000)
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	state, err := r.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = NewReaderLimits(in, limits, nil)
+	if err := r.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitSize {
+		t.Fatalf("got error %v, want %s limit", err, LimitSize)
+	}
+	if int64(len(got)+len(rest)) != limits.MaxSize || !bytes.Equal(rest, data[len(got):limits.MaxSize]) {
+		t.Fatalf("got %d bytes after resuming, want %d", len(rest), limits.MaxSize-int64(len(got)))
+	}
+}
@@ -0,0 +1,483 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"io"
+	"math"
+)
+
+const (
+	// optimalChunkSize is the amount of input that is parsed and split into blocks at the time.
+	// It must be possible to represent a chunk as tokens including an EOB.
+	optimalChunkSize = maxStoreBlockSize - 1
+
+	// optimalChain is the maximum number of hash chain entries checked for each position.
+	optimalChain = 1024
+
+	// optimalIterations is the default number of iterations.
+	optimalIterations = 15
+
+	optimalHashBits = 16
+)
+
+// NewWriterOptimal returns a new Writer that searches for the smallest
+// possible output, similar to Zopfli.
+//
+// Matches are chosen by iteratively finding the cheapest path through the
+// input, using the symbol costs of the previous iteration,
+// and blocks are split where it reduces the output size.
+// The output is regular DEFLATE, but compression is very slow,
+// typically 100x slower than BestCompression.
+// This is intended for content that is compressed once and decompressed many times.
+//
+// More iterations will typically give slightly smaller output.
+// If iterations is <= 0, 15 iterations are used.
+func NewWriterOptimal(w io.Writer, iterations int) *Writer {
+	var dw Writer
+	dw.d.initOptimal(w, iterations)
+	return &dw
+}
+
+// optimalState contains state for optimal compression.
+type optimalState struct {
+	iterations int
+	maxOffset  int
+
+	// Hash chains for the window.
+	head [1 << optimalHashBits]int32
+	prev []int32
+
+	// Match candidates for each position in the current chunk.
+	// matches[mIdx[i]:mIdx[i+1]] contains length<<16 | offset for position i,
+	// with increasing lengths and offsets.
+	mIdx    []int32
+	matches []uint32
+
+	// Greedy parse of the chunk used for block splitting,
+	// and the window position of each token.
+	greedy []token
+	tpos   []int32
+	splits []int
+
+	costs  []float32
+	choice []uint32
+	toks   []token
+	best   []token
+	lits   []token
+
+	litCost  [literalCount]float32
+	lenCost  [maxMatchLength + 1]float32
+	distCost [offsetCodeCount]float32
+
+	// Used for estimating block sizes.
+	est    *huffmanBitWriter
+	estTok tokens
+}
+
+func (d *compressor) initOptimal(w io.Writer, iterations int) {
+	if iterations <= 0 {
+		iterations = optimalIterations
+	}
+	d.w = newHuffmanBitWriter(w)
+	d.opt = &optimalState{
+		iterations: iterations,
+		maxOffset:  windowSize,
+		est:        newHuffmanBitWriter(nil),
+	}
+	d.maxOffset = windowSize
+	d.window = make([]byte, windowSize+optimalChunkSize)
+	d.fill = (*compressor).fillBlock
+	d.step = (*compressor).deflateOptimal
+	d.level = BestCompression
+}
+
+// deflateOptimal compresses full chunks, or all pending input when flushing.
+// Up to windowSize bytes are kept as history.
+func (d *compressor) deflateOptimal() {
+	for d.windowEnd-d.blockStart >= optimalChunkSize || d.sync && d.windowEnd > d.blockStart {
+		end := d.blockStart + optimalChunkSize
+		if end > d.windowEnd {
+			end = d.windowEnd
+		}
+		if d.err = d.optimalChunk(d.blockStart, end); d.err != nil {
+			return
+		}
+		d.blockStart = end
+	}
+	if d.blockStart > windowSize {
+		delta := d.blockStart - windowSize
+		copy(d.window, d.window[delta:d.windowEnd])
+		d.windowEnd -= delta
+		d.blockStart -= delta
+	}
+}
+
+// optimalChunk compresses window[start:end] and writes the blocks.
+func (d *compressor) optimalChunk(start, end int) error {
+	o := d.opt
+	histStart := start - windowSize
+	if histStart < 0 {
+		histStart = 0
+	}
+	win := d.window[:end]
+	o.findMatches(win, histStart, start)
+	o.greedyParse(win, start)
+	ts := 0
+	for _, te := range o.splitBlocks(win) {
+		bs, be := int(o.tpos[ts]), int(o.tpos[te])
+		d.tokens.indexTokens(o.optimize(win, start, bs, be, o.greedy[ts:te]))
+		d.w.writeBlock(&d.tokens, false, win[bs:be])
+		if d.w.err != nil {
+			return d.w.err
+		}
+		ts = te
+	}
+	d.tokens.Reset()
+	return nil
+}
+
+func hash3(b []byte) uint32 {
+	return (uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16) * prime4bytes >> (32 - optimalHashBits)
+}
+
+// findMatches finds match candidates for all positions from start to the end of win.
+// Matches may reference data from histStart.
+func (o *optimalState) findMatches(win []byte, histStart, start int) {
+	end := len(win)
+	if cap(o.prev) < end {
+		o.prev = make([]int32, end)
+	}
+	prev := o.prev[:end]
+	for i := range o.head {
+		o.head[i] = -1
+	}
+	for p := histStart; p < start && p+baseMatchLength <= end; p++ {
+		h := hash3(win[p:])
+		prev[p] = o.head[h]
+		o.head[h] = int32(p)
+	}
+
+	o.mIdx = o.mIdx[:0]
+	o.matches = o.matches[:0]
+	for p := start; p < end; p++ {
+		o.mIdx = append(o.mIdx, int32(len(o.matches)))
+		if p+baseMatchLength > end {
+			continue
+		}
+		maxLen := end - p
+		if maxLen > maxMatchLength {
+			maxLen = maxMatchLength
+		}
+		h := hash3(win[p:])
+		best := baseMatchLength - 1
+		chain := optimalChain
+		for c := int(o.head[h]); c >= 0 && p-c <= o.maxOffset && chain > 0; c = int(prev[c]) {
+			chain--
+			if win[c+best] != win[p+best] {
+				continue
+			}
+			l := matchLen(win[p:p+maxLen], win[c:])
+			if l > best {
+				best = l
+				o.matches = append(o.matches, uint32(l)<<16|uint32(p-c))
+				if l == maxLen {
+					break
+				}
+			}
+		}
+		prev[p] = o.head[h]
+		o.head[h] = int32(p)
+	}
+	o.mIdx = append(o.mIdx, int32(len(o.matches)))
+}
+
+// longest returns the longest match at position i of the chunk.
+func (o *optimalState) longest(i int) (length, offset int) {
+	if m := o.matches[o.mIdx[i]:o.mIdx[i+1]]; len(m) > 0 {
+		return int(m[len(m)-1] >> 16), int(m[len(m)-1] & 0xffff)
+	}
+	return 0, 0
+}
+
+// greedyParse parses the chunk from start using the longest match with one step lazy matching.
+func (o *optimalState) greedyParse(win []byte, start int) {
+	o.greedy = o.greedy[:0]
+	o.tpos = o.tpos[:0]
+	for p := start; p < len(win); {
+		l, offset := o.longest(p - start)
+		if l > 0 && p+1 < len(win) {
+			if next, _ := o.longest(p + 1 - start); next > l+1 {
+				l = 0
+			}
+		}
+		o.tpos = append(o.tpos, int32(p))
+		if l > 0 {
+			o.greedy = append(o.greedy, matchToken(l, offset))
+			p += l
+		} else {
+			o.greedy = append(o.greedy, token(win[p]))
+			p++
+		}
+	}
+	o.tpos = append(o.tpos, int32(len(win)))
+}
+
+// splitBlocks splits the greedy parse into blocks where it reduces the estimated size.
+// The token index of the end of each block is returned.
+func (o *optimalState) splitBlocks(win []byte) []int {
+	o.splits = o.splits[:0]
+	o.splitRange(win, 0, len(o.greedy))
+	return append(o.splits, len(o.greedy))
+}
+
+// splitRange recursively splits greedy tokens s to e.
+func (o *optimalState) splitRange(win []byte, s, e int) {
+	if e-s < 10 {
+		return
+	}
+	p, cost := o.findSplit(win, s, e)
+	if cost >= o.greedyBits(win, s, e) {
+		return
+	}
+	o.splitRange(win, s, p)
+	o.splits = append(o.splits, p)
+	o.splitRange(win, p, e)
+}
+
+// findSplit returns the split point between s and e with the lowest estimated size,
+// by repeatedly narrowing the search around the best of a number of evenly spaced points.
+func (o *optimalState) findSplit(win []byte, s, e int) (pos, cost int) {
+	const points = 9
+	cost = math.MaxInt32
+	try := func(p int) int {
+		return o.greedyBits(win, s, p) + o.greedyBits(win, p, e)
+	}
+	lo, hi := s+1, e
+	for hi-lo > points {
+		var p, c [points]int
+		step := (hi - lo) / (points + 1)
+		best := 0
+		for i := range p {
+			p[i] = lo + (i+1)*step
+			c[i] = try(p[i])
+			if c[i] < c[best] {
+				best = i
+			}
+		}
+		if c[best] >= cost {
+			return pos, cost
+		}
+		pos, cost = p[best], c[best]
+		if best > 0 {
+			lo = p[best-1]
+		}
+		if best < points-1 {
+			hi = p[best+1]
+		}
+	}
+	for p := lo; p < hi; p++ {
+		if c := try(p); c < cost {
+			pos, cost = p, c
+		}
+	}
+	return pos, cost
+}
+
+// greedyBits returns the estimated size of greedy tokens s to e.
+func (o *optimalState) greedyBits(win []byte, s, e int) int {
+	return o.blockBits(o.greedy[s:e], win[o.tpos[s]:o.tpos[e]])
+}
+
+// blockBits returns the size in bits of the smallest encoding
+// huffmanBitWriter.writeBlock will use for the tokens.
+func (o *optimalState) blockBits(toks []token, input []byte) int {
+	t := &o.estTok
+	t.indexTokens(toks)
+	t.AddEOB()
+	w := o.est
+	numLiterals, numOffsets := w.indexTokens(t, false)
+	w.generate()
+	extraBits := w.extraBitSize()
+	size := math.MaxInt32
+	if t.n < maxPredefinedTokens {
+		size = w.fixedSize(extraBits)
+	}
+	w.generateCodegen(numLiterals, numOffsets, w.literalEncoding, w.offsetEncoding)
+	w.codegenEncoding.generate(w.codegenFreq[:], 7)
+	if dynamicSize, _ := w.dynamicSize(w.literalEncoding, w.offsetEncoding, extraBits); dynamicSize < size {
+		size = dynamicSize
+	}
+	if storedSize, storable := w.storedSize(input); storable && storedSize <= size {
+		size = storedSize
+	}
+	return size
+}
+
+// optimize returns the tokens with the smallest size found for window[start:end].
+// Iterations are started both from the symbol statistics of seed
+// and from statistics of literals only, since matches may not pay off.
+func (o *optimalState) optimize(win []byte, chunkStart, start, end int, seed []token) []token {
+	input := win[start:end]
+	best := append(o.best[:0], seed...)
+	bestBits := o.blockBits(best, input)
+	lits := o.lits[:0]
+	for _, b := range input {
+		lits = append(lits, token(b))
+	}
+	o.lits = lits
+	if bits := o.blockBits(lits, input); bits < bestBits {
+		best = append(best[:0], lits...)
+		bestBits = bits
+	}
+	for _, stats := range [][]token{seed, lits} {
+		lastBits := -1
+		for i := 0; i < o.iterations; i++ {
+			o.setCosts(stats)
+			o.toks = o.parse(win, chunkStart, start, end)
+			bits := o.blockBits(o.toks, input)
+			if bits < bestBits {
+				best = append(best[:0], o.toks...)
+				bestBits = bits
+			}
+			if bits == lastBits {
+				// Converged.
+				break
+			}
+			lastBits = bits
+			stats = o.toks
+		}
+	}
+	o.best = best
+	return best
+}
+
+// setCosts sets the cost of each symbol based on the statistics of the tokens.
+func (o *optimalState) setCosts(toks []token) {
+	var lits [literalCount]int
+	var offs [offsetCodeCount]int
+	for _, t := range toks {
+		if t < matchType {
+			lits[t]++
+			continue
+		}
+		lits[lengthCodesStart+int(lengthCode(t.length()))]++
+		offs[(t.offset()>>16)&31]++
+	}
+	lits[endBlockMarker]++
+	symbolCosts(lits[:], o.litCost[:])
+	symbolCosts(offs[:], o.distCost[:])
+	for l := baseMatchLength; l <= maxMatchLength; l++ {
+		code := lengthCode(uint8(l - baseMatchLength))
+		o.lenCost[l] = o.litCost[lengthCodesStart+int(code)] + float32(lengthExtraBits[code])
+	}
+	for i := range o.distCost {
+		o.distCost[i] += float32(offsetExtraBits[i])
+	}
+}
+
+// symbolCosts sets the cost in bits of each symbol given the symbol counts.
+// Unused symbols are given the cost of a symbol used once.
+func symbolCosts(counts []int, costs []float32) {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		for i := range costs {
+			costs[i] = float32(math.Log2(float64(len(costs))))
+		}
+		return
+	}
+	log2Total := math.Log2(float64(total))
+	for i, c := range counts {
+		if c == 0 {
+			costs[i] = float32(log2Total)
+		} else {
+			costs[i] = float32(log2Total - math.Log2(float64(c)))
+		}
+	}
+}
+
+// parse returns the cheapest tokens for window[start:end] with the current costs.
+func (o *optimalState) parse(win []byte, chunkStart, start, end int) []token {
+	n := end - start
+	if cap(o.costs) <= n {
+		o.costs = make([]float32, n+1)
+		o.choice = make([]uint32, n+1)
+	}
+	costs, choice := o.costs[:n+1], o.choice[:n+1]
+	costs[0] = 0
+	for i := range costs[1:] {
+		costs[i+1] = math.MaxFloat32
+	}
+
+	// choice contains length<<16 | offset of the match ending at each position,
+	// or 0 for a literal.
+	for i := 0; i < n; i++ {
+		ci := costs[i]
+		if ci == math.MaxFloat32 {
+			continue
+		}
+		p := start + i
+		idx := p - chunkStart
+		if l, offset := o.longest(idx); l == maxMatchLength && i >= maxMatchLength && i+2*maxMatchLength < n {
+			if prev, _ := o.longest(idx - maxMatchLength); prev == maxMatchLength {
+				// Inside a long repetition, only consider the longest match.
+				if c := ci + o.distCost[offsetCode(uint32(offset-baseMatchOffset))] + o.lenCost[l]; c < costs[i+l] {
+					costs[i+l] = c
+					choice[i+l] = uint32(l)<<16 | uint32(offset)
+				}
+				continue
+			}
+		}
+		if c := ci + o.litCost[win[p]]; c < costs[i+1] {
+			costs[i+1] = c
+			choice[i+1] = 0
+		}
+		prevLen := baseMatchLength - 1
+		for _, m := range o.matches[o.mIdx[idx]:o.mIdx[idx+1]] {
+			l, offset := int(m>>16), int(m&0xffff)
+			if l > n-i {
+				l = n - i
+			}
+			if l <= prevLen {
+				break
+			}
+			oc := ci + o.distCost[offsetCode(uint32(offset-baseMatchOffset))]
+			for length := prevLen + 1; length <= l; length++ {
+				if c := oc + o.lenCost[length]; c < costs[i+length] {
+					costs[i+length] = c
+					choice[i+length] = uint32(length)<<16 | uint32(offset)
+				}
+			}
+			prevLen = l
+		}
+	}
+
+	// Trace back the cheapest path.
+	toks := o.toks[:0]
+	for i := n; i > 0; {
+		ch := choice[i]
+		if ch == 0 {
+			i--
+			toks = append(toks, token(win[start+i]))
+			continue
+		}
+		length := int(ch >> 16)
+		i -= length
+		toks = append(toks, matchToken(length, int(ch&0xffff)))
+	}
+	for i, j := 0, len(toks)-1; i < j; i, j = i+1, j-1 {
+		toks[i], toks[j] = toks[j], toks[i]
+	}
+	return toks
+}
+
+// matchToken returns a match token for the given length and offset.
+func matchToken(length, offset int) token {
+	xoffset := uint32(offset - baseMatchOffset)
+	return token(matchType | uint32(length-baseMatchLength)<<lengthShift | offsetCode(xoffset)<<16 | xoffset)
+}
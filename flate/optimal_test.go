@@ -0,0 +1,100 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestWriterOptimal(t *testing.T) {
+	rnd := make([]byte, 70000)
+	rand.New(rand.NewSource(0)).Read(rnd)
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"small":  []byte("hello, hello, hello world"),
+		"zeros":  make([]byte, 100000),
+		"random": rnd,
+	}
+	for _, name := range []string{"Mark.Twain-Tom.Sawyer.txt", "html.txt", "pngdata.bin", "e.txt"} {
+		data, err := os.ReadFile("../testdata/" + name)
+		if err != nil {
+			t.Skip(err)
+		}
+		inputs[name] = data
+	}
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var best bytes.Buffer
+			w, _ := NewWriter(&best, BestCompression)
+			w.Write(data)
+			w.Close()
+
+			var buf bytes.Buffer
+			w = NewWriterOptimal(&buf, 0)
+			// Write in two parts with a flush in between.
+			half := len(data) / 2
+			if _, err := w.Write(data[:half]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data[half:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(flate.NewReader(bytes.NewReader(buf.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("output mismatch")
+			}
+			t.Logf("%d -> %d bytes, level 9: %d bytes", len(data), buf.Len(), best.Len())
+			if len(data) > 1000 && buf.Len() > best.Len()+best.Len()/100 {
+				t.Errorf("output %d bytes is bigger than level 9 with %d bytes", buf.Len(), best.Len())
+			}
+
+			// Reset with a dictionary.
+			if len(data) > 0 {
+				dict := data[:len(data)/3]
+				buf.Reset()
+				w.ResetDict(&buf, dict)
+				w.Write(data)
+				w.Close()
+				got, err := io.ReadAll(flate.NewReaderDict(bytes.NewReader(buf.Bytes()), dict))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatal("dictionary output mismatch")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriterOptimal(b *testing.B) {
+	data, err := os.ReadFile("../testdata/html.txt")
+	if err != nil {
+		b.Skip(err)
+	}
+	w := NewWriterOptimal(io.Discard, 0)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset(io.Discard)
+		w.Write(data)
+		w.Close()
+	}
+}
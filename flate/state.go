@@ -0,0 +1,614 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Serialized state starts with a magic string including the version.
+const (
+	writerStateMagic = "flateW\x01"
+	readerStateMagic = "flateR\x01"
+)
+
+var errCorruptState = errors.New("flate: corrupt state")
+
+// MarshalBinary returns the state of the writer,
+// so compression can be resumed by UnmarshalBinary, possibly in another process.
+//
+// The state contains the history, hash tables, pending input,
+// and output that has not yet been written to the underlying writer.
+// Resuming from the state produces the same output as if the writer had not been interrupted.
+// Depending on the level the state is up to about 1MB.
+func (w *Writer) MarshalBinary() ([]byte, error) {
+	e := stateEncoder{b: []byte(writerStateMagic)}
+	e.bytes(w.dict)
+	if err := w.d.marshal(&e); err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+// UnmarshalBinary restores a state returned by MarshalBinary.
+// The compression level and dictionary are restored from the state.
+// Output continues to the underlying writer of w,
+// so the Writer must have been created with NewWriter or similar.
+// A callback set by SetBlockCallback is kept.
+func (w *Writer) UnmarshalBinary(b []byte) error {
+	if len(b) < len(writerStateMagic) || string(b[:len(writerStateMagic)]) != writerStateMagic {
+		return errCorruptState
+	}
+	dec := stateDecoder{b: b[len(writerStateMagic):]}
+	dict := dec.bytes(math.MaxInt32)
+	var dst io.Writer
+	var inspect func(BlockInfo)
+	if w.d.w != nil {
+		dst, inspect = w.d.w.writer, w.d.w.inspect
+		if cw, ok := dst.(*countWriter); ok && cw == &w.d.w.counter {
+			dst = cw.w
+		}
+	}
+	d := new(compressor)
+	if err := d.unmarshal(&dec, dst); err != nil {
+		return err
+	}
+	if dec.err == nil && len(dec.b) > 0 {
+		return errCorruptState
+	}
+	w.d = *d
+	w.d.w.setInspect(inspect)
+	w.dict = append([]byte{}, dict...)
+	return nil
+}
+
+func (d *compressor) marshal(e *stateEncoder) error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.w.err != nil {
+		return d.w.err
+	}
+	iterations := 0
+	if d.opt != nil {
+		iterations = d.opt.iterations
+	}
+	e.int(d.level)
+	e.int(iterations)
+	e.int(d.maxOffset)
+	e.bytes(d.window[:d.windowEnd])
+	e.int(d.blockStart)
+	e.bool(d.byteAvailable)
+	e.int(int(d.tokens.n))
+	for _, t := range d.tokens.tokens[:d.tokens.n] {
+		e.uint32(uint32(t))
+	}
+	d.w.marshal(e)
+
+	switch {
+	case d.fast != nil:
+		var g *fastGen
+		switch f := d.fast.(type) {
+		case *fastEncL1:
+			g = &f.fastGen
+			e.tableEntries(f.table[:])
+		case *fastEncL2:
+			g = &f.fastGen
+			e.tableEntries(f.table[:])
+		case *fastEncL3:
+			g = &f.fastGen
+			e.tableEntriesPrev(f.table[:])
+		case *fastEncL4:
+			g = &f.fastGen
+			e.tableEntries(f.table[:])
+			e.tableEntries(f.bTable[:])
+		case *fastEncL5:
+			g = &f.fastGen
+			e.tableEntries(f.table[:])
+			e.tableEntriesPrev(f.bTable[:])
+		case *fastEncL6:
+			g = &f.fastGen
+			e.tableEntries(f.table[:])
+			e.tableEntriesPrev(f.bTable[:])
+		}
+		e.int(int(g.cur))
+		e.bytes(g.hist)
+	case d.state != nil:
+		s := d.state
+		e.int(s.length)
+		e.int(s.offset)
+		e.int(s.maxInsertIndex)
+		e.int(s.chainHead)
+		e.int(s.hashOffset)
+		e.int(int(s.ii))
+		e.int(s.index)
+		e.int(s.estBitsPerByte)
+		for _, v := range s.hashHead[:] {
+			e.uint32(v)
+		}
+		for _, v := range s.hashPrev[:] {
+			e.uint32(v)
+		}
+	}
+	return nil
+}
+
+// unmarshal initializes d from a serialized state, writing output to w.
+func (d *compressor) unmarshal(dec *stateDecoder, w io.Writer) error {
+	level := dec.int()
+	iterations := dec.int()
+	maxOffset := dec.int()
+	if dec.err != nil {
+		return dec.err
+	}
+	if iterations > 0 {
+		if level != BestCompression {
+			return errCorruptState
+		}
+		d.initOptimal(w, iterations)
+	} else if iterations < 0 || d.init(w, level) != nil {
+		return errCorruptState
+	}
+	if maxOffset < 1<<MinWindowBits || maxOffset > windowSize || maxOffset&(maxOffset-1) != 0 {
+		return errCorruptState
+	}
+	d.setMaxOffset(maxOffset)
+
+	d.windowEnd = copy(d.window, dec.bytes(len(d.window)))
+	d.blockStart = dec.int()
+	if d.blockStart < 0 {
+		return errCorruptState
+	}
+	d.byteAvailable = dec.bool()
+	n := dec.int()
+	if n < 0 || n > maxStoreBlockSize {
+		return errCorruptState
+	}
+	toks := make([]token, n)
+	for i := range toks {
+		toks[i] = token(dec.uint32())
+	}
+	d.tokens.indexTokens(toks)
+	d.w.unmarshal(dec)
+
+	switch {
+	case d.fast != nil:
+		var g *fastGen
+		var tables [][]tableEntry
+		var prevTables [][]tableEntryPrev
+		switch f := d.fast.(type) {
+		case *fastEncL1:
+			g, tables = &f.fastGen, [][]tableEntry{f.table[:]}
+		case *fastEncL2:
+			g, tables = &f.fastGen, [][]tableEntry{f.table[:]}
+		case *fastEncL3:
+			g, prevTables = &f.fastGen, [][]tableEntryPrev{f.table[:]}
+		case *fastEncL4:
+			g, tables = &f.fastGen, [][]tableEntry{f.table[:], f.bTable[:]}
+		case *fastEncL5:
+			g, tables, prevTables = &f.fastGen, [][]tableEntry{f.table[:]}, [][]tableEntryPrev{f.bTable[:]}
+		case *fastEncL6:
+			g, tables, prevTables = &f.fastGen, [][]tableEntry{f.table[:]}, [][]tableEntryPrev{f.bTable[:]}
+		}
+		// Entries are checked once the history has been read.
+		for _, t := range tables {
+			dec.tableEntries(t)
+		}
+		for _, t := range prevTables {
+			dec.tableEntriesPrev(t)
+		}
+		cur := dec.int()
+		if cur < 0 || cur > bufferReset+allocHistory {
+			return errCorruptState
+		}
+		g.cur = int32(cur)
+		hist := dec.bytes(allocHistory)
+		g.hist = append(make([]byte, 0, allocHistory), hist...)
+
+		// Entries may not point beyond the history.
+		limit := g.cur + int32(len(g.hist))
+		for _, t := range tables {
+			for _, v := range t {
+				if v.offset > limit {
+					return errCorruptState
+				}
+			}
+		}
+		for _, t := range prevTables {
+			for _, v := range t {
+				if v.Cur.offset > limit || v.Prev.offset > limit {
+					return errCorruptState
+				}
+			}
+		}
+	case d.state != nil:
+		s := d.state
+		s.length = dec.int()
+		s.offset = dec.int()
+		s.maxInsertIndex = dec.int()
+		s.chainHead = dec.int()
+		s.hashOffset = dec.int()
+		s.ii = uint16(dec.int())
+		s.index = dec.int()
+		s.estBitsPerByte = dec.int()
+		if s.length < 0 || s.length > maxMatchLength || s.offset < 0 || s.offset > windowSize ||
+			s.index < 0 || s.index > d.windowEnd ||
+			s.hashOffset < 1 || s.hashOffset > maxHashOffset+windowSize {
+			return errCorruptState
+		}
+		limit := uint32(s.hashOffset + d.windowEnd)
+		if s.chainHead > int(limit) {
+			return errCorruptState
+		}
+		for i := range s.hashHead[:] {
+			s.hashHead[i] = dec.uint32()
+			if s.hashHead[i] > limit {
+				return errCorruptState
+			}
+		}
+		for i := range s.hashPrev[:] {
+			s.hashPrev[i] = dec.uint32()
+			if s.hashPrev[i] > limit {
+				return errCorruptState
+			}
+		}
+	}
+	return dec.err
+}
+
+func (w *huffmanBitWriter) marshal(e *stateEncoder) {
+	e.uint64(w.bits)
+	e.int(int(w.nbits))
+	e.bytes(w.bytes[:w.nbytes])
+	e.bool(w.lastHuffMan)
+	e.int(w.lastHeader)
+	for _, c := range w.literalEncoding.codes {
+		e.uint32(uint32(c))
+	}
+	for _, c := range w.offsetEncoding.codes {
+		e.uint32(uint32(c))
+	}
+	for _, v := range w.literalFreq[:] {
+		e.int(int(v))
+	}
+	for _, v := range w.offsetFreq[:] {
+		e.int(int(v))
+	}
+}
+
+func (w *huffmanBitWriter) unmarshal(dec *stateDecoder) {
+	w.bits = dec.uint64()
+	nbits := dec.int()
+	if nbits < 0 || nbits >= 48 {
+		dec.fail()
+		return
+	}
+	w.nbits = uint8(nbits)
+	w.nbytes = uint8(copy(w.bytes[:bufferFlushSize], dec.bytes(bufferFlushSize)))
+	w.lastHuffMan = dec.bool()
+	w.lastHeader = dec.int()
+	if w.lastHeader < 0 {
+		dec.fail()
+		return
+	}
+	for i := range w.literalEncoding.codes {
+		w.literalEncoding.codes[i] = hcode(dec.uint32())
+	}
+	for i := range w.offsetEncoding.codes {
+		w.offsetEncoding.codes[i] = hcode(dec.uint32())
+	}
+	for i := range w.literalFreq[:] {
+		w.literalFreq[i] = uint16(dec.int())
+	}
+	for i := range w.offsetFreq[:] {
+		w.offsetFreq[i] = uint16(dec.int())
+	}
+}
+
+// Decompressor steps, as serialized.
+const (
+	stepNextBlock = iota
+	stepHuffman
+	stepCopyData
+	stepSkipStart
+)
+
+// MarshalBinary returns the state of the decompressor.
+func (f *decompressor) MarshalBinary() ([]byte, error) {
+	if f.err != nil && f.err != io.EOF {
+		return nil, f.err
+	}
+	e := stateEncoder{b: []byte(readerStateMagic)}
+	var step int
+	switch reflect.ValueOf(f.step).Pointer() {
+	case reflect.ValueOf((*decompressor).nextBlock).Pointer():
+		step = stepNextBlock
+	case reflect.ValueOf((*decompressor).copyData).Pointer():
+		step = stepCopyData
+	case reflect.ValueOf((*decompressor).skipStart).Pointer():
+		step = stepSkipStart
+	default:
+		step = stepHuffman
+	}
+	e.int(step)
+	e.int(f.stepState)
+	e.int(f.copyLen)
+	e.int(f.copyDist)
+	e.bool(f.err == io.EOF)
+	e.int64(f.roffset)
+	e.int64(f.limitOut)
+	e.uint32(f.b)
+	e.int(int(f.nb))
+	e.bool(f.final)
+	e.bool(f.deflate64)
+	e.int(f.maxDist)
+	e.int(int(f.skipBits))
+	if step == stepHuffman {
+		dynamic := f.hl == &f.h1
+		e.bool(dynamic)
+		if dynamic {
+			e.int(f.nlit)
+			e.int(f.ndist)
+			for _, v := range f.bits[:f.nlit+f.ndist] {
+				e.int(v)
+			}
+		}
+	}
+
+	dd := &f.dict
+	e.bytes(dd.hist)
+	e.int(dd.wrPos)
+	e.int(dd.rdPos)
+	e.bool(dd.full)
+	e.int64(dd.flushed)
+	// Pending output is always a part of the history.
+	e.int(len(dd.hist) - cap(f.toRead))
+	e.int(len(f.toRead))
+	return e.b, nil
+}
+
+// UnmarshalBinary restores a state returned by MarshalBinary.
+// The current input reader is kept.
+func (f *decompressor) UnmarshalBinary(b []byte) error {
+	if len(b) < len(readerStateMagic) || string(b[:len(readerStateMagic)]) != readerStateMagic {
+		return errCorruptState
+	}
+	dec := &stateDecoder{b: b[len(readerStateMagic):]}
+	fixedHuffmanDecoderInit()
+	r := decompressor{
+		r:              f.r,
+		bits:           f.bits,
+		codebits:       f.codebits,
+		h1:             f.h1,
+		h2:             f.h2,
+		dict:           f.dict,
+		checkpoint:     f.checkpoint,
+		checkpointSpan: f.checkpointSpan,
+		window:         f.window,
+		limits:         f.limits,
+	}
+	if r.bits == nil {
+		r.bits = new([maxNumLit + maxNumDist64]int)
+		r.codebits = new([numCodes]int)
+	}
+	step := dec.int()
+	r.stepState = dec.int()
+	r.copyLen = dec.int()
+	r.copyDist = dec.int()
+	if dec.bool() {
+		r.err = io.EOF
+	}
+	r.roffset = dec.int64()
+	r.limitOut = dec.int64()
+	r.b = dec.uint32()
+	nb := dec.int()
+	r.final = dec.bool()
+	r.deflate64 = dec.bool()
+	r.maxDist = dec.int()
+	if r.maxDist != 0 && (r.maxDist < 1<<MinWindowBits || r.maxDist > maxMatchOffset || r.maxDist&(r.maxDist-1) != 0 || r.deflate64) {
+		return errCorruptState
+	}
+	skip := dec.int()
+	if nb < 0 || nb > 32 || skip < 0 || skip > 7 || r.stepState < 0 || r.stepState > 1 ||
+		r.copyLen < 0 || r.copyLen > math.MaxUint16+3 || r.copyDist < 0 || r.roffset < 0 || r.limitOut < 0 {
+		return errCorruptState
+	}
+	r.nb, r.skipBits = uint(nb), uint(skip)
+
+	var dynamic bool
+	switch step {
+	case stepNextBlock:
+		r.step = (*decompressor).nextBlock
+	case stepCopyData:
+		r.step = (*decompressor).copyData
+	case stepSkipStart:
+		r.step = (*decompressor).skipStart
+	case stepHuffman:
+		r.step = func(f *decompressor) { f.huffmanBlockDecoder()() }
+		r.hl = &fixedHuffmanDecoder
+		if dynamic = dec.bool(); dynamic {
+			nlit, ndist := dec.int(), dec.int()
+			if nlit < 257 || nlit > maxNumLit || ndist < 1 || ndist > maxNumDist64 {
+				return errCorruptState
+			}
+			for i := range r.bits[:nlit+ndist] {
+				r.bits[i] = dec.int()
+				if r.bits[i] < 0 || r.bits[i] > 15 {
+					return errCorruptState
+				}
+			}
+			if r.initHuffman(nlit, ndist) != nil {
+				return errCorruptState
+			}
+		}
+	default:
+		return errCorruptState
+	}
+
+	hist := dec.bytes(windowSize64)
+	if dec.err != nil {
+		return dec.err
+	}
+	r.dict.init(r.windowSize(), nil)
+	if len(hist) != len(r.dict.hist) {
+		return errCorruptState
+	}
+	copy(r.dict.hist, hist)
+	dd := &r.dict
+	dd.wrPos = dec.int()
+	dd.rdPos = dec.int()
+	dd.full = dec.bool()
+	dd.flushed = dec.int64()
+	readPos, readLen := dec.int(), dec.int()
+	if dec.err != nil || len(dec.b) > 0 {
+		return errCorruptState
+	}
+	if dd.rdPos < 0 || dd.rdPos > dd.wrPos || dd.wrPos > len(dd.hist) || dd.flushed < 0 ||
+		readPos < 0 || readLen < 0 || readPos+readLen > len(dd.hist) ||
+		(r.copyDist > dd.histSize() || r.maxDist > 0 && r.copyDist > r.maxDist) && r.copyLen > 0 && step == stepHuffman {
+		return errCorruptState
+	}
+	r.toRead = dd.hist[readPos : readPos+readLen]
+	*f = r
+	if dynamic {
+		f.hl, f.hd = &f.h1, &f.h2
+	}
+	return nil
+}
+
+// stateEncoder serializes state.
+type stateEncoder struct {
+	b []byte
+}
+
+func (e *stateEncoder) int(v int) {
+	e.int64(int64(v))
+}
+
+func (e *stateEncoder) int64(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	e.b = append(e.b, tmp[:n]...)
+}
+
+func (e *stateEncoder) bool(v bool) {
+	if v {
+		e.b = append(e.b, 1)
+	} else {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *stateEncoder) uint32(v uint32) {
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *stateEncoder) uint64(v uint64) {
+	e.uint32(uint32(v))
+	e.uint32(uint32(v >> 32))
+}
+
+func (e *stateEncoder) bytes(b []byte) {
+	e.int(len(b))
+	e.b = append(e.b, b...)
+}
+
+func (e *stateEncoder) tableEntries(t []tableEntry) {
+	for _, v := range t {
+		e.uint32(uint32(v.offset))
+	}
+}
+
+func (e *stateEncoder) tableEntriesPrev(t []tableEntryPrev) {
+	for _, v := range t {
+		e.uint32(uint32(v.Cur.offset))
+		e.uint32(uint32(v.Prev.offset))
+	}
+}
+
+// stateDecoder reads serialized state.
+// After the first error all values returned are zero.
+type stateDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *stateDecoder) fail() {
+	d.b = nil
+	d.err = errCorruptState
+}
+
+// int returns an int in the int32 range.
+func (d *stateDecoder) int() int {
+	v := d.int64()
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		d.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (d *stateDecoder) int64() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *stateDecoder) bool() bool {
+	if len(d.b) < 1 || d.b[0] > 1 {
+		d.fail()
+		return false
+	}
+	v := d.b[0] == 1
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *stateDecoder) uint32() uint32 {
+	if len(d.b) < 4 {
+		d.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *stateDecoder) uint64() uint64 {
+	return uint64(d.uint32()) | uint64(d.uint32())<<32
+}
+
+// bytes returns up to max bytes. The returned slice references the input.
+func (d *stateDecoder) bytes(max int) []byte {
+	n := d.int()
+	if n < 0 || n > max || n > len(d.b) {
+		d.fail()
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *stateDecoder) tableEntries(t []tableEntry) {
+	for i := range t {
+		t[i].offset = int32(d.uint32())
+	}
+}
+
+func (d *stateDecoder) tableEntriesPrev(t []tableEntryPrev) {
+	for i := range t {
+		t[i].Cur.offset = int32(d.uint32())
+		t[i].Prev.offset = int32(d.uint32())
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+import (
+	"bytes"
+	"encoding"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestWriterState(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	rnd := make([]byte, 50000)
+	rand.New(rand.NewSource(0)).Read(rnd)
+	data = append(append(data[:150000:150000], rnd...), data[:100000]...)
+	dict := data[1000:5000]
+
+	for level := HuffmanOnly; level <= BestCompression+1; level++ {
+		newWriter := func(w io.Writer) *Writer {
+			if level > BestCompression {
+				return NewWriterOptimal(w, 2)
+			}
+			zw, _ := NewWriterDict(w, level, dict)
+			return zw
+		}
+		// Write in parts with a flush in the middle.
+		write := func(w *Writer, i int) {
+			in := data[i*10000:]
+			if len(in) > 10000 {
+				in = in[:10000]
+			}
+			if _, err := w.Write(in); err != nil {
+				t.Fatal(err)
+			}
+			if i == 20 {
+				w.Flush()
+			}
+		}
+		parts := (len(data) + 9999) / 10000
+
+		var want bytes.Buffer
+		w := newWriter(&want)
+		for i := 0; i < parts; i++ {
+			write(w, i)
+		}
+		w.Close()
+
+		var got bytes.Buffer
+		var out bytes.Buffer
+		w = newWriter(&out)
+		for i := 0; i < parts; i++ {
+			write(w, i)
+			if i%3 != 0 {
+				continue
+			}
+			// Continue with a new writer.
+			state, err := w.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.Write(out.Bytes())
+			out.Reset()
+			w, _ = NewWriter(&out, BestSpeed)
+			if err := w.UnmarshalBinary(state); err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+			if i == 3 {
+				t.Logf("level %d: state is %d bytes", level, len(state))
+			}
+		}
+		w.Close()
+		got.Write(out.Bytes())
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Fatalf("level %d: output mismatch, got %d bytes, want %d", level, got.Len(), want.Len())
+		}
+
+		// Reset must use the restored dictionary.
+		out.Reset()
+		w.Reset(&out)
+		w.Write(data)
+		w.Close()
+		dec, err := io.ReadAll(NewReaderDict(&out, dict))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, data) {
+			t.Fatalf("level %d: output mismatch after Reset", level)
+		}
+	}
+}
+
+func TestReaderState(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	data = append(data, data...)
+	for _, level := range []int{NoCompression, BestSpeed, HuffmanOnly, BestCompression} {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, level)
+		w.Write(data[:len(data)/3])
+		w.Flush()
+		w.Write(data[len(data)/3:])
+		w.Close()
+		comp := buf.Bytes()
+
+		in := bytes.NewReader(comp)
+		r := NewReader(in)
+		var got []byte
+		tmp := make([]byte, 1000)
+		for i := 0; ; i++ {
+			n, err := r.Read(tmp)
+			got = append(got, tmp[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("level %d, read %d: %v", level, i, err)
+			}
+			if i%7 != 0 {
+				continue
+			}
+			state, err := r.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Continue reading in a new reader,
+			// with input starting where the previous stopped.
+			in = bytes.NewReader(comp[len(comp)-in.Len():])
+			r = NewReader(in)
+			if err := r.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+				t.Fatal(err)
+			}
+			if i == 7 {
+				// Truncated and modified state must not panic.
+				for n := 0; n < len(state); n += 61 {
+					NewReader(in).(encoding.BinaryUnmarshaler).UnmarshalBinary(state[:n])
+				}
+				for j := 0; j < 20; j++ {
+					mod := append([]byte{}, state...)
+					mod[rand.Intn(len(mod))] ^= byte(1 + rand.Intn(255))
+					rd := NewReader(bytes.NewReader(comp[len(comp)-in.Len():]))
+					if rd.(encoding.BinaryUnmarshaler).UnmarshalBinary(mod) == nil {
+						io.Copy(io.Discard, rd)
+					}
+				}
+			}
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("level %d: output mismatch", level)
+		}
+	}
+}
@@ -539,3 +539,85 @@ func BenchmarkCompressAllocationsSingle(b *testing.B) {
 		}
 	})
 }
+
+func TestWriterWindow(t *testing.T) {
+	text, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Repeat random data at a distance that needs the full window.
+	rnd := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(rnd)
+	data := append(append(append([]byte{}, rnd...), text[:200000]...), rnd...)
+
+	for bits := MinWindowBits; bits <= MaxWindowBits; bits++ {
+		for level := HuffmanOnly; level <= BestCompression+1; level++ {
+			var buf bytes.Buffer
+			var w *Writer
+			if level > BestCompression {
+				w = NewWriterOptimal(&buf, 2)
+				w.d.setMaxOffset(1 << bits)
+			} else {
+				w, err = NewWriterWindow(&buf, level, bits)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Write twice to check the window is kept on Reset.
+			for i := 0; i < 2; i++ {
+				buf.Reset()
+				w.Reset(&buf)
+				w.Write(data)
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := NewReaderWindow(bytes.NewReader(buf.Bytes()), bits, nil)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("bits %d, level %d: %v", bits, level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("bits %d, level %d: output mismatch", bits, level)
+			}
+		}
+	}
+
+	// A stream with matches further back than the window must be rejected.
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, BestCompression)
+	w.Write(data)
+	w.Close()
+	r := NewReaderWindow(bytes.NewReader(buf.Bytes()), 14, nil)
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("expected error with matches beyond window")
+	}
+
+	// The window also applies to matches in the dictionary.
+	dict := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(dict)
+	buf.Reset()
+	w, _ = NewWriterDict(&buf, BestCompression, dict)
+	w.Write(dict[:1000])
+	w.Close()
+	for bits, ok := range map[int]bool{14: false, 15: true} {
+		r := NewReaderWindow(bytes.NewReader(buf.Bytes()), bits, dict)
+		if n := len(r.(*decompressor).dict.hist); n != maxMatchOffset {
+			t.Errorf("bits %d: history is %d bytes, want %d", bits, n, maxMatchOffset)
+		}
+		got, err := io.ReadAll(r)
+		if ok && (err != nil || !bytes.Equal(got, dict[:1000])) {
+			t.Errorf("bits %d: got error %v", bits, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("bits %d: expected error with dictionary match beyond window", bits)
+		}
+	}
+
+	if _, err := NewWriterWindow(io.Discard, 5, 7); err == nil {
+		t.Error("expected error with window bits 7")
+	}
+	if _, err := io.ReadAll(NewReaderWindow(bytes.NewReader(buf.Bytes()), 16, nil)); err == nil {
+		t.Error("expected error with window bits 16")
+	}
+}
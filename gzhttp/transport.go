@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zstd"
 )
@@ -51,10 +52,21 @@ func TransportEnableGzip(b bool) transportOption {
 	}
 }
 
+// TransportLimits limits the decompressed size of response bodies.
+// When a limit is exceeded, reading the body returns a *flate.LimitError.
+// flate.ReaderLimits.MaxMembers only applies to gzip.
+// By default the size is not limited.
+func TransportLimits(limits flate.ReaderLimits) transportOption {
+	return func(c *gzRoundtripper) {
+		c.limits = limits
+	}
+}
+
 type gzRoundtripper struct {
 	parent             http.RoundTripper
 	acceptEncoding     string
 	withZstd, withGzip bool
+	limits             flate.ReaderLimits
 }
 
 func (g *gzRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -85,14 +97,14 @@ func (g *gzRoundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	// Decompress
 	if g.withGzip && asciiEqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
-		resp.Body = &gzipReader{body: resp.Body}
+		resp.Body = &gzipReader{body: resp.Body, limits: g.limits}
 		resp.Header.Del("Content-Encoding")
 		resp.Header.Del("Content-Length")
 		resp.ContentLength = -1
 		resp.Uncompressed = true
 	}
 	if g.withZstd && asciiEqualFold(resp.Header.Get("Content-Encoding"), "zstd") {
-		resp.Body = &zstdReader{body: resp.Body}
+		resp.Body = &zstdReader{body: resp.Body, limits: g.limits}
 		resp.Header.Del("Content-Encoding")
 		resp.Header.Del("Content-Length")
 		resp.ContentLength = -1
@@ -110,13 +122,17 @@ type gzipReader struct {
 	body io.ReadCloser // underlying HTTP/1 response body framing
 	zr   *gzip.Reader  // lazily-initialized gzip reader
 	zerr error         // any error from gzip.NewReader; sticky
+
+	limits flate.ReaderLimits // limits of the decompressed output
 }
 
 func (gz *gzipReader) Read(p []byte) (n int, err error) {
 	if gz.zr == nil {
 		if gz.zerr == nil {
-			zr, ok := gzReaderPool.Get().(*gzip.Reader)
-			if ok {
+			if gz.limits != (flate.ReaderLimits{}) {
+				// Readers with limits are not pooled.
+				gz.zr, gz.zerr = gzip.NewReaderLimits(gz.body, gz.limits)
+			} else if zr, ok := gzReaderPool.Get().(*gzip.Reader); ok {
 				gz.zr, gz.zerr = zr, zr.Reset(gz.body)
 			} else {
 				gz.zr, gz.zerr = gzip.NewReader(gz.body)
@@ -132,7 +148,9 @@ func (gz *gzipReader) Read(p []byte) (n int, err error) {
 
 func (gz *gzipReader) Close() error {
 	if gz.zr != nil {
-		gzReaderPool.Put(gz.zr)
+		if gz.limits == (flate.ReaderLimits{}) {
+			gzReaderPool.Put(gz.zr)
+		}
 		gz.zr = nil
 	}
 	return gz.body.Close()
@@ -169,6 +187,22 @@ type zstdReader struct {
 	body io.ReadCloser // underlying HTTP/1 response body framing
 	zr   *zstd.Decoder // lazily-initialized gzip reader
 	zerr error         // any error from zstd.NewReader; sticky
+
+	limits flate.ReaderLimits // limits of the decompressed output
+	in     *countReader       // counts body input when limited
+	out    int64              // output counted against limits
+}
+
+// countReader counts the bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 func (zr *zstdReader) Read(p []byte) (n int, err error) {
@@ -177,12 +211,17 @@ func (zr *zstdReader) Read(p []byte) (n int, err error) {
 	}
 	if zr.zr == nil {
 		if zr.zerr == nil {
+			var body io.Reader = zr.body
+			if zr.limits != (flate.ReaderLimits{}) {
+				zr.in = &countReader{r: body}
+				body = zr.in
+			}
 			reader, ok := zstdReaderPool.Get().(*zstd.Decoder)
 			if ok {
-				zr.zerr = reader.Reset(zr.body)
+				zr.zerr = reader.Reset(body)
 				zr.zr = reader
 			} else {
-				zr.zr, zr.zerr = zstd.NewReader(zr.body, zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(32<<20), zstd.WithDecoderConcurrency(1))
+				zr.zr, zr.zerr = zstd.NewReader(body, zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxWindow(32<<20), zstd.WithDecoderConcurrency(1))
 			}
 		}
 		if zr.zerr != nil {
@@ -190,6 +229,13 @@ func (zr *zstdReader) Read(p []byte) (n int, err error) {
 		}
 	}
 	n, err = zr.zr.Read(p)
+	if zr.in != nil {
+		var lerr error
+		if n, lerr = zr.limits.Allow(zr.in.n, zr.out, n); lerr != nil {
+			err = lerr
+		}
+		zr.out += int64(n)
+	}
 	if err != nil {
 		// Usually this will be io.EOF,
 		// stash the decoder and keep the error.
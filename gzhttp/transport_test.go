@@ -6,6 +6,7 @@ package gzhttp
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +14,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/zstd"
 )
@@ -118,6 +120,39 @@ func TestTransportZstd(t *testing.T) {
 	}
 }
 
+func TestTransportLimits(t *testing.T) {
+	bin, err := os.ReadFile("testdata/benchmark.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bin)
+	zw.Close()
+	enc, _ := zstd.NewWriter(nil)
+	defer enc.Close()
+	zsBin := enc.EncodeAll(bin, nil)
+
+	for path, body := range map[string][]byte{"/gzipped": buf.Bytes(), "/zstd": zsBin} {
+		server := httptest.NewServer(newTestHandler(body))
+		c := http.Client{Transport: Transport(http.DefaultTransport, TransportLimits(flate.ReaderLimits{MaxSize: 1000}))}
+		resp, err := c.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		server.Close()
+		var lerr *flate.LimitError
+		if !errors.As(err, &lerr) || lerr.Limit != flate.LimitSize {
+			t.Errorf("%s: got error %v, want size limit", path, err)
+		}
+		if !bytes.Equal(got, bin[:1000]) {
+			t.Errorf("%s: got %d bytes, want 1000", path, len(got))
+		}
+	}
+}
+
 func TestTransportInvalid(t *testing.T) {
 	bin, err := os.ReadFile("testdata/benchmark.json")
 	if err != nil {
@@ -0,0 +1,294 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+)
+
+const (
+	// concDictSize is the size of the history each block is given as dictionary.
+	concDictSize = 32 << 10
+
+	// MinConcurrentBlockSize is the minimum block size accepted by SetConcurrency.
+	MinConcurrentBlockSize = concDictSize
+)
+
+// concBlock is a block that is compressed concurrently.
+type concBlock struct {
+	in   []byte
+	dict []byte
+	out  bytes.Buffer
+	crc  uint32
+	err  error
+	done chan struct{}
+}
+
+var concBlockPool sync.Pool
+
+// concFlatePools contains flate writers for each level from HuffmanOnly to BestCompression.
+var concFlatePools [BestCompression - HuffmanOnly + 1]sync.Pool
+
+// NewWriterConcurrent returns a new Writer compressing at the given level,
+// which compresses blocks of blockSize bytes concurrently,
+// with up to n blocks being compressed at once.
+// See SetConcurrency for details.
+func NewWriterConcurrent(w io.Writer, level, blockSize, n int) (*Writer, error) {
+	z, err := NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := z.SetConcurrency(blockSize, n); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// SetConcurrency makes the writer compress blocks of blockSize bytes concurrently,
+// with up to blocks being compressed at once.
+//
+// Each block is compressed independently, using the previous 32KB of input as dictionary,
+// and ends with a sync flush. The output is a single ordinary gzip member,
+// which is slightly larger than when compressing without concurrency.
+// Up to blockSize*(blocks+1) bytes of input will be buffered.
+//
+// blockSize must be at least MinConcurrentBlockSize. 1MB is a reasonable block size.
+// Setting blocks to 0 disables concurrent compression.
+// The setting is kept when the writer is Reset.
+// SetConcurrency must be called before the first Write, Flush or Close
+// and cannot be used with StatelessCompression.
+func (z *Writer) SetConcurrency(blockSize, blocks int) error {
+	switch {
+	case z.wroteHeader:
+		return errors.New("gzip: SetConcurrency called after first Write")
+	case blocks < 0:
+		return errors.New("gzip: number of blocks cannot be negative")
+	case blocks == 0:
+		z.blockSize, z.blocks = 0, 0
+		return nil
+	case z.level == StatelessCompression:
+		return errors.New("gzip: SetConcurrency cannot be used with StatelessCompression")
+	case blockSize < MinConcurrentBlockSize:
+		return errors.New("gzip: block size must be at least MinConcurrentBlockSize")
+	}
+	z.blockSize, z.blocks = blockSize, blocks
+	return nil
+}
+
+// writeConcurrent adds p to the current block and starts compressing full blocks.
+func (z *Writer) writeConcurrent(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if z.cur == nil {
+			z.cur = newConcBlock(z.blockSize)
+		}
+		c := z.blockSize - len(z.cur.in)
+		if c > len(p) {
+			c = len(p)
+		}
+		z.cur.in = append(z.cur.in, p[:c]...)
+		p = p[c:]
+		if len(z.cur.in) == z.blockSize {
+			if z.err = z.startBlock(); z.err != nil {
+				return 0, z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// startBlock starts compressing the current block.
+// If the maximum number of blocks are being compressed, the oldest is written first.
+func (z *Writer) startBlock() error {
+	b := z.cur
+	z.cur = nil
+	if len(z.pending) >= z.blocks {
+		if err := z.writeOldest(); err != nil {
+			b.release()
+			return err
+		}
+	}
+	b.dict = append(b.dict[:0], z.hist...)
+
+	// Keep the last part of the input as history for the next block.
+	if len(b.in) >= concDictSize {
+		z.hist = append(z.hist[:0], b.in[len(b.in)-concDictSize:]...)
+	} else {
+		z.hist = append(z.hist, b.in...)
+		if len(z.hist) > concDictSize {
+			n := copy(z.hist, z.hist[len(z.hist)-concDictSize:])
+			z.hist = z.hist[:n]
+		}
+	}
+	z.pending = append(z.pending, b)
+	go b.compress(z.level)
+	return nil
+}
+
+// writeOldest waits for the oldest pending block and writes it.
+func (z *Writer) writeOldest() error {
+	b := z.pending[0]
+	<-b.done
+	n := copy(z.pending, z.pending[1:])
+	z.pending[n] = nil
+	z.pending = z.pending[:n]
+	defer b.release()
+	if b.err != nil {
+		return b.err
+	}
+	if _, err := z.w.Write(b.out.Bytes()); err != nil {
+		return err
+	}
+	z.digest = crc32Combine(z.digest, b.crc, int64(len(b.in)))
+	return nil
+}
+
+// flushConcurrent compresses any buffered input and writes all pending blocks.
+func (z *Writer) flushConcurrent() error {
+	if z.cur != nil && len(z.cur.in) > 0 {
+		if err := z.startBlock(); err != nil {
+			return err
+		}
+	}
+	for len(z.pending) > 0 {
+		if err := z.writeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeConcurrent writes all remaining data followed by an empty final block.
+func (z *Writer) closeConcurrent() error {
+	if err := z.flushConcurrent(); err != nil {
+		return err
+	}
+	if z.cur != nil {
+		z.cur.release()
+		z.cur = nil
+	}
+	// All blocks end with a sync flush, so the output is byte aligned.
+	// Write an empty stored block with the final bit set.
+	_, err := z.w.Write([]byte{1, 0, 0, 0xff, 0xff})
+	return err
+}
+
+// releaseBlocks waits for pending blocks and releases all blocks.
+func (z *Writer) releaseBlocks() {
+	for _, b := range z.pending {
+		<-b.done
+		b.release()
+	}
+	if z.cur != nil {
+		z.cur.release()
+	}
+	z.pending, z.cur = nil, nil
+}
+
+func newConcBlock(blockSize int) *concBlock {
+	b, _ := concBlockPool.Get().(*concBlock)
+	if b == nil {
+		b = &concBlock{}
+	}
+	if cap(b.in) < blockSize {
+		b.in = make([]byte, 0, blockSize)
+	}
+	b.in = b.in[:0]
+	b.err = nil
+	b.done = make(chan struct{})
+	return b
+}
+
+func (b *concBlock) release() {
+	b.out.Reset()
+	concBlockPool.Put(b)
+}
+
+// compress the block and calculate the CRC of the input.
+func (b *concBlock) compress(level int) {
+	defer close(b.done)
+	b.out.Reset()
+	pool := &concFlatePools[level-HuffmanOnly]
+	fw, _ := pool.Get().(*flate.Writer)
+	if fw == nil {
+		fw, b.err = flate.NewWriterDict(&b.out, level, b.dict)
+		if b.err != nil {
+			return
+		}
+	} else {
+		fw.ResetDict(&b.out, b.dict)
+	}
+	if _, b.err = fw.Write(b.in); b.err == nil {
+		b.err = fw.Flush()
+	}
+	b.crc = crc32.ChecksumIEEE(b.in)
+	// Don't keep references to the buffers.
+	fw.ResetDict(nil, nil)
+	pool.Put(fw)
+}
+
+// crc32Combine returns the CRC of the concatenation of two inputs,
+// given the CRC of both and the length of the second, as crc32_combine in zlib.
+func crc32Combine(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+	var even, odd [32]uint32
+
+	// Operator for one zero bit in odd.
+	odd[0] = crc32.IEEE
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	// Operator for two and four zero bits.
+	gf2MatrixSquare(&even, &odd)
+	gf2MatrixSquare(&odd, &even)
+
+	// Apply len2 zeros to crc1. The first square gives the operator for one zero byte.
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := range mat {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	stdgzip "compress/gzip"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestCRC32Combine(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 100000)
+	rng.Read(data)
+	for _, split := range []int{0, 1, 7, 1000, 65536, len(data)} {
+		a, b := data[:split], data[split:]
+		got := crc32Combine(crc32.ChecksumIEEE(a), crc32.ChecksumIEEE(b), int64(len(b)))
+		if want := crc32.ChecksumIEEE(data); got != want {
+			t.Errorf("split %d: got %08x, want %08x", split, got, want)
+		}
+	}
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	for len(data) < 1<<20 {
+		data = append(data, data...)
+	}
+	// Add some data that doesn't compress.
+	rnd := make([]byte, 100000)
+	rand.New(rand.NewSource(0)).Read(rnd)
+	data = append(data, rnd...)
+
+	for _, level := range []int{HuffmanOnly, DefaultCompression, NoCompression, BestSpeed, 5, BestCompression} {
+		var buf bytes.Buffer
+		w, err := NewWriterConcurrent(&buf, level, MinConcurrentBlockSize*2, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			buf.Reset()
+			w.Reset(&buf)
+			w.Name = "test.txt"
+			in := data
+			for len(in) > 0 {
+				n := 100000
+				if n > len(in) {
+					n = len(in)
+				}
+				if _, err := w.Write(in[:n]); err != nil {
+					t.Fatal(err)
+				}
+				in = in[n:]
+				if len(in) == len(data)/2 {
+					if err := w.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Check with the stdlib decoder.
+			r, err := stdgzip.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Multistream(false)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("level %d: output mismatch", level)
+			}
+			if r.Name != "test.txt" {
+				t.Fatalf("level %d: got name %q", level, r.Name)
+			}
+		}
+		t.Logf("level %d: %d -> %d bytes", level, len(data), buf.Len())
+	}
+
+	// Empty stream.
+	var buf bytes.Buffer
+	w, err := NewWriterConcurrent(&buf, DefaultCompression, 1<<20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || len(got) != 0 {
+		t.Fatalf("empty stream: got %d bytes, %v", len(got), err)
+	}
+
+	if _, err := NewWriterConcurrent(&buf, DefaultCompression, 1000, 2); err == nil {
+		t.Error("expected error for small block size")
+	}
+	if _, err := NewWriterConcurrent(&buf, StatelessCompression, 1<<20, 2); err == nil {
+		t.Error("expected error for StatelessCompression")
+	}
+}
+
+func BenchmarkWriterConcurrent(b *testing.B) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		b.Skip(err)
+	}
+	for len(data) < 8<<20 {
+		data = append(data, data...)
+	}
+	w, err := NewWriterConcurrent(io.Discard, DefaultCompression, 1<<20, 8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Reset(io.Discard)
+		w.Write(data)
+		w.Close()
+	}
+}
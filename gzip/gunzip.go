@@ -82,6 +82,12 @@ type Reader struct {
 	buf          [512]byte
 	err          error
 	multistream  bool
+
+	// Limits, the counted input and the output and members so far.
+	limits  flate.ReaderLimits
+	in      *countReader
+	out     int64
+	members int
 }
 
 // NewReader creates a new Reader reading the given reader.
@@ -99,6 +105,19 @@ func NewReader(r io.Reader) (*Reader, error) {
 	return z, nil
 }
 
+// NewReaderLimits creates a new Reader like NewReader,
+// which returns a *flate.LimitError when the output exceeds limits.
+// The limits apply to the complete output of multistream files,
+// and the input is counted including headers and trailers.
+// The limits are kept when the Reader is reset.
+func NewReaderLimits(r io.Reader, limits flate.ReaderLimits) (*Reader, error) {
+	z := &Reader{limits: limits}
+	if err := z.Reset(r); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
 // Reset discards the Reader z's state and makes it equivalent to the
 // result of its original state from NewReader, but reading from r instead.
 // This permits reusing a Reader rather than allocating a new one.
@@ -106,6 +125,8 @@ func (z *Reader) Reset(r io.Reader) error {
 	*z = Reader{
 		decompressor: z.decompressor,
 		multistream:  true,
+		limits:       z.limits,
+		in:           z.in,
 	}
 	if rr, ok := r.(flate.Reader); ok {
 		z.r = rr
@@ -118,6 +139,15 @@ func (z *Reader) Reset(r io.Reader) error {
 		}
 		z.r = z.br
 	}
+	if z.limits != (flate.ReaderLimits{}) {
+		if z.in == nil {
+			z.in = &countReader{}
+		}
+		*z.in = countReader{r: z.r}
+		z.r = z.in
+	} else {
+		z.in = nil
+	}
 	z.Header, z.err = z.readHeader()
 	return z.err
 }
@@ -237,6 +267,11 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 		}
 	}
 
+	z.members++
+	if z.limits.MaxMembers > 0 && z.members > z.limits.MaxMembers {
+		return hdr, &flate.LimitError{Limit: flate.LimitMembers, Value: int64(z.limits.MaxMembers)}
+	}
+
 	z.digest = 0
 	if z.decompressor == nil {
 		z.decompressor = flate.NewReader(z.r)
@@ -254,6 +289,13 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 
 	for n == 0 {
 		n, z.err = z.decompressor.Read(p)
+		if z.in != nil {
+			var err error
+			if n, err = z.limits.Allow(z.in.n, z.out, n); err != nil {
+				z.err = err
+			}
+			z.out += int64(n)
+		}
 		z.digest = crc32.Update(z.digest, crc32.IEEETable, p[:n])
 		z.size += uint32(n)
 		if z.err != io.EOF {
@@ -291,7 +333,7 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 // Support the io.WriteTo interface for io.Copy and friends.
 func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 	total := int64(0)
-	crcWriter := crc32.NewIEEE()
+	crcWriter := &digestWriter{z: z}
 	for {
 		if z.err != nil {
 			if z.err == io.EOF {
@@ -301,7 +343,10 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 		}
 
 		// We write both to output and digest.
-		mw := io.MultiWriter(w, crcWriter)
+		var mw io.Writer = io.MultiWriter(w, crcWriter)
+		if z.in != nil {
+			mw = &limitWriter{w: mw, z: z}
+		}
 		n, err := z.decompressor.(io.WriterTo).WriteTo(mw)
 		total += n
 		z.size += uint32(n)
@@ -318,7 +363,6 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 			z.err = err
 			return total, err
 		}
-		z.digest = crcWriter.Sum32()
 		digest := le.Uint32(z.buf[:4])
 		size := le.Uint32(z.buf[4:8])
 		if digest != z.digest || size != z.size {
@@ -331,7 +375,6 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 		if !z.multistream {
 			return total, nil
 		}
-		crcWriter.Reset()
 		z.err = nil // Remove io.EOF
 
 		if _, z.err = z.readHeader(); z.err != nil {
@@ -343,6 +386,32 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 	}
 }
 
+// digestWriter updates the digest of z with the data written.
+type digestWriter struct {
+	z *Reader
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	d.z.digest = crc32.Update(d.z.digest, crc32.IEEETable, p)
+	return len(p), nil
+}
+
+// limitWriter applies the limits of z to the data written to w.
+type limitWriter struct {
+	w io.Writer
+	z *Reader
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	n, err := l.z.limits.Allow(l.z.in.n, l.z.out, len(p))
+	l.z.out += int64(n)
+	n, werr := l.w.Write(p[:n])
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
 // Close closes the Reader. It does not close the underlying io.Reader.
 // In order for the GZIP checksum to be verified, the reader must be
 // fully consumed until the io.EOF.
@@ -0,0 +1,340 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// concDecodeSize is the amount of compressed input read for each goroutine
+// before member boundaries are searched.
+const concDecodeSize = 1 << 20
+
+// concMember is a member decoded speculatively from a candidate header position.
+type concMember struct {
+	next int // Offset after the member in the input.
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// prefixReader reads b before reading from r.
+type prefixReader struct {
+	b []byte
+	r flate.Reader
+}
+
+func (p *prefixReader) Read(b []byte) (int, error) {
+	if len(p.b) == 0 {
+		return p.r.Read(b)
+	}
+	n := copy(b, p.b)
+	p.b = p.b[n:]
+	return n, nil
+}
+
+func (p *prefixReader) ReadByte() (byte, error) {
+	if len(p.b) == 0 {
+		return p.r.ReadByte()
+	}
+	c := p.b[0]
+	p.b = p.b[1:]
+	return c, nil
+}
+
+// DecodeConcurrent writes the remaining uncompressed content to w,
+// decoding the members of multistream files on up to n goroutines.
+// If n is <= 0, GOMAXPROCS is used.
+// The CRC32 and size of each member are checked.
+//
+// The current member is decoded as by WriteTo.
+// The input following it is read in chunks,
+// which are searched for member headers.
+// Members are then decoded concurrently from each candidate header,
+// and the output of the members that follow each other is written to w in order.
+// At most n candidates following the last member written are decoded at once.
+// Members larger than a chunk, or with more than 8MB of output,
+// are decoded without concurrency.
+// Concurrency only helps when the input contains many members,
+// for example when it has been created by appending gzip files or by BGZF.
+//
+// Readers created by NewReaderLimits are decoded sequentially, as by WriteTo.
+//
+// After DecodeConcurrent the Reader is at EOF, or returns the error encountered.
+func (z *Reader) DecodeConcurrent(w io.Writer, n int) (int64, error) {
+	if z.in != nil {
+		return z.WriteTo(w)
+	}
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if z.err != nil {
+		if z.err == io.EOF {
+			return 0, nil
+		}
+		return 0, z.err
+	}
+
+	// Finish the current member.
+	multistream := z.multistream
+	z.multistream = false
+	total, err := z.WriteTo(w)
+	z.multistream = multistream
+	if err != nil {
+		return total, err
+	}
+	z.err = io.EOF
+	if !multistream {
+		return total, nil
+	}
+
+	var buf []byte
+	eof := false
+	for {
+		// Read the next chunk, keeping any input left from the previous.
+		if !eof {
+			next := make([]byte, n*concDecodeSize)
+			copy(next, buf)
+			nr, err := io.ReadFull(z.r, next[len(buf):])
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				eof = true
+			default:
+				z.err = err
+				return total, err
+			}
+			buf = next[:len(buf)+nr]
+		}
+		if len(buf) == 0 {
+			return total, nil
+		}
+
+		c := decodeMembers(buf, n)
+		p := 0
+		large := false
+		for p < len(buf) {
+			m := c.members[p]
+			if m == nil {
+				// Not a header, let the decoder report the error.
+				m = &concMember{}
+				c.decode(m, p)
+			} else {
+				<-m.done
+			}
+			if m.err == errConcTooLarge {
+				large = true
+				break
+			}
+			if m.err == io.ErrUnexpectedEOF && !eof {
+				break
+			}
+			if m.err != nil {
+				c.stop()
+				z.err = m.err
+				return total, m.err
+			}
+			nw, err := w.Write(m.out.Bytes())
+			total += int64(nw)
+			if err != nil {
+				c.stop()
+				z.err = err
+				return total, err
+			}
+			p = m.next
+			c.advance(p)
+		}
+		c.stop()
+		buf = buf[p:]
+		if !large && (p > 0 || len(buf) == 0) {
+			continue
+		}
+
+		// The member is larger than the chunk or has too much output.
+		pr := &prefixReader{b: buf, r: z.r}
+		zr, err := NewReader(pr)
+		if err == nil {
+			zr.Multistream(false)
+			var nw int64
+			nw, err = zr.WriteTo(w)
+			total += nw
+		}
+		if err != nil {
+			z.err = noEOF(err)
+			return total, z.err
+		}
+		buf = pr.b
+	}
+}
+
+// concMembers contains the members decoded concurrently from a chunk.
+type concMembers struct {
+	buf     []byte
+	pos     []int // Candidate header positions.
+	members map[int]*concMember
+	n       int
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	next int // Index in pos of the next candidate to decode.
+
+	chain   int64 // Input position reached by the member chain. Accessed atomically.
+	stopped int32 // Set when decoding should stop. Accessed atomically.
+}
+
+// decodeMembers starts decoding a member at each position in buf that could be a gzip header,
+// using n goroutines.
+// Only candidates within n positions of the member chain are decoded,
+// and candidates passed by the chain are cancelled.
+func decodeMembers(buf []byte, n int) *concMembers {
+	c := &concMembers{buf: buf, n: n}
+	c.cond = sync.NewCond(&c.mu)
+	for i := 0; i < len(buf); i++ {
+		if i > 0 {
+			j := bytes.IndexByte(buf[i:], gzipID1)
+			if j < 0 {
+				break
+			}
+			i += j
+			if len(buf)-i < 4 || buf[i+1] != gzipID2 || buf[i+2] != gzipDeflate || buf[i+3]&0xe0 != 0 {
+				continue
+			}
+		}
+		c.pos = append(c.pos, i)
+	}
+	c.members = make(map[int]*concMember, len(c.pos))
+	for _, p := range c.pos {
+		c.members[p] = &concMember{done: make(chan struct{})}
+	}
+	if n > len(c.pos) {
+		n = len(c.pos)
+	}
+	for i := 0; i < n; i++ {
+		go c.run()
+	}
+	return c
+}
+
+// run decodes candidates until stopped or no candidates are left.
+func (c *concMembers) run() {
+	for {
+		p, ok := c.take()
+		if !ok {
+			return
+		}
+		m := c.members[p]
+		c.decode(m, p)
+		close(m.done)
+	}
+}
+
+// take returns the position of the next candidate to decode.
+// It waits until the candidate is within n positions of the member chain.
+func (c *concMembers) take() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if atomic.LoadInt32(&c.stopped) != 0 || c.next >= len(c.pos) {
+			return 0, false
+		}
+		chain := int(atomic.LoadInt64(&c.chain))
+		// Cancel candidates the chain has passed.
+		for c.next < len(c.pos) && c.pos[c.next] < chain {
+			m := c.members[c.pos[c.next]]
+			m.err = errConcStopped
+			close(m.done)
+			c.next++
+		}
+		if c.next >= len(c.pos) {
+			return 0, false
+		}
+		// Index of the first candidate not passed by the chain.
+		first := c.next
+		for first > 0 && c.pos[first-1] >= chain {
+			first--
+		}
+		if c.next < first+c.n {
+			p := c.pos[c.next]
+			c.next++
+			return p, true
+		}
+		c.cond.Wait()
+	}
+}
+
+// advance moves the member chain to input position p.
+func (c *concMembers) advance(p int) {
+	c.mu.Lock()
+	atomic.StoreInt64(&c.chain, int64(p))
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// stop stops decoding candidates.
+func (c *concMembers) stop() {
+	c.mu.Lock()
+	atomic.StoreInt32(&c.stopped, 1)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// concMaxOutput is the maximum output buffered for a member decoded concurrently.
+// Members with more output are decoded sequentially.
+const concMaxOutput = 8 << 20
+
+// errConcStopped is the error of members that were not decoded.
+var errConcStopped = errors.New("gzip: decoding stopped")
+
+// errConcTooLarge is the error of members with more than concMaxOutput bytes of output.
+var errConcTooLarge = errors.New("gzip: member too large")
+
+// concOutput buffers the output of a member,
+// until it is cancelled or concMaxOutput is exceeded.
+type concOutput struct {
+	c *concMembers
+	m *concMember
+	p int
+}
+
+func (o *concOutput) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&o.c.stopped) != 0 || atomic.LoadInt64(&o.c.chain) > int64(o.p) {
+		return 0, errConcStopped
+	}
+	if o.m.out.Len()+len(b) > concMaxOutput {
+		return 0, errConcTooLarge
+	}
+	return o.m.out.Write(b)
+}
+
+// concReaderPool contains readers for decoding members concurrently.
+var concReaderPool sync.Pool
+
+// decode the member starting at c.buf[p:] into m.
+func (c *concMembers) decode(m *concMember, p int) {
+	buf := c.buf
+	br := bytes.NewReader(buf[p:])
+	z, _ := concReaderPool.Get().(*Reader)
+	if z == nil {
+		z = new(Reader)
+	}
+	defer concReaderPool.Put(z)
+	if m.err = z.Reset(br); m.err != nil {
+		m.err = noEOF(m.err)
+		return
+	}
+	z.Multistream(false)
+	if _, m.err = z.WriteTo(&concOutput{c: c, m: m, p: p}); m.err != nil {
+		m.err = noEOF(m.err)
+		return
+	}
+	m.next = len(buf) - br.Len()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// multiMember returns gzip members of varying sizes, concatenated, and their content.
+func multiMember(t testing.TB) (compressed, data []byte) {
+	text, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for i := 0; i < 120; i++ {
+		var in []byte
+		switch {
+		case i == 50:
+			// Larger than a chunk when decoding with low concurrency.
+			in = make([]byte, 3<<19)
+			rng.Read(in)
+		case i%7 == 0:
+			in = make([]byte, rng.Intn(100000))
+			rng.Read(in)
+		default:
+			start := rng.Intn(len(text))
+			in = text[start : start+rng.Intn(len(text)-start)]
+		}
+		zw, _ := NewWriterLevel(&buf, 1+rng.Intn(9))
+		zw.Name = "member"
+		zw.Write(in)
+		zw.Close()
+		data = append(data, in...)
+	}
+	return buf.Bytes(), data
+}
+
+func TestDecodeConcurrent(t *testing.T) {
+	compressed, data := multiMember(t)
+	for _, n := range []int{1, 2, 8, 0} {
+		zr, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		written, err := zr.DecodeConcurrent(&got, n)
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if written != int64(len(data)) || !bytes.Equal(got.Bytes(), data) {
+			t.Fatalf("n=%d: output mismatch", n)
+		}
+		if _, err := zr.Read(make([]byte, 10)); err != io.EOF {
+			t.Fatalf("n=%d: read after decode: got %v, want io.EOF", n, err)
+		}
+	}
+
+	// Start after a partial read.
+	zr, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, 1000)
+	if _, err := io.ReadFull(zr, first); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if _, err := zr.DecodeConcurrent(&got, 4); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(first, got.Bytes()...), data) {
+		t.Fatal("output mismatch after partial read")
+	}
+}
+
+func TestDecodeConcurrentErrors(t *testing.T) {
+	compressed, _ := multiMember(t)
+	decode := func(b []byte) error {
+		zr, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		_, err = zr.DecodeConcurrent(io.Discard, 4)
+		return err
+	}
+	// Errors must match those returned when reading sequentially.
+	for _, tc := range []struct {
+		name string
+		b    []byte
+	}{
+		{"truncated", compressed[:len(compressed)/2]},
+		{"trailing-garbage", append(append([]byte{}, compressed...), 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)},
+		{"trailing-short", append(append([]byte{}, compressed...), gzipID1, gzipID2)},
+		{"trailer", func() []byte {
+			b := append([]byte{}, compressed...)
+			b[len(b)-5] ^= 1
+			return b
+		}()},
+	} {
+		zr, err := NewReader(bytes.NewReader(tc.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want := io.Copy(io.Discard, zr)
+		if got := decode(tc.b); got != want || got == nil {
+			t.Errorf("%s: got %v, want %v", tc.name, got, want)
+		}
+	}
+
+	// Corruption in the middle must be detected.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		b := append([]byte{}, compressed...)
+		b[len(b)/4+rng.Intn(len(b)/2)] ^= byte(1 + rng.Intn(255))
+		if decode(b) == nil {
+			t.Errorf("corruption %d not detected", i)
+		}
+	}
+}
+
+func BenchmarkDecodeConcurrent(b *testing.B) {
+	compressed, data := multiMember(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zr, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := zr.DecodeConcurrent(io.Discard, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeConcurrentHighRatio(t *testing.T) {
+	// A member with a very high compression ratio between small members.
+	var buf bytes.Buffer
+	var data []byte
+	for i, in := range [][]byte{[]byte("first"), make([]byte, 64<<20), []byte("last")} {
+		zw, _ := NewWriterLevel(&buf, BestCompression)
+		zw.Write(in)
+		zw.Close()
+		data = append(data, in...)
+		if i == 1 && buf.Len() > concMaxOutput/100 {
+			t.Fatalf("compressed size %d too large", buf.Len())
+		}
+	}
+	for _, n := range []int{1, 4} {
+		zr, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got maxWriter
+		if _, err := zr.DecodeConcurrent(&got, n); err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			t.Fatalf("n=%d: output mismatch", n)
+		}
+		// The output must not have been buffered as a whole.
+		if got.max > concMaxOutput {
+			t.Fatalf("n=%d: got write of %d bytes, want at most %d", n, got.max, concMaxOutput)
+		}
+	}
+}
+
+// maxWriter records the largest write.
+type maxWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *maxWriter) Write(b []byte) (int, error) {
+	if len(b) > w.max {
+		w.max = len(b)
+	}
+	return w.Buffer.Write(b)
+}
@@ -8,11 +8,14 @@ import (
 	"bytes"
 	oldgz "compress/gzip"
 	"crypto/rand"
+	"errors"
 	"io"
 	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/flate"
 )
 
 type gunzipTest struct {
@@ -708,3 +711,48 @@ func TestTruncatedGunzip(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderLimits(t *testing.T) {
+	compressed, data := multiMember(t)
+	for _, tc := range []struct {
+		name   string
+		limits flate.ReaderLimits
+		want   int
+		limit  string
+	}{
+		{name: "none", limits: flate.ReaderLimits{MaxMembers: 120}, want: len(data)},
+		{name: "size", limits: flate.ReaderLimits{MaxSize: int64(len(data)) - 1000}, want: len(data) - 1000, limit: flate.LimitSize},
+		{name: "ratio", limits: flate.ReaderLimits{MaxRatio: 2}, want: -1, limit: flate.LimitRatio},
+		{name: "members", limits: flate.ReaderLimits{MaxMembers: 119}, want: -1, limit: flate.LimitMembers},
+	} {
+		for _, mode := range []string{"read", "writeto", "concurrent"} {
+			zr, err := NewReaderLimits(bytes.NewReader(compressed), tc.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			switch mode {
+			case "read":
+				_, err = io.Copy(&got, struct{ io.Reader }{zr})
+			case "writeto":
+				_, err = zr.WriteTo(&got)
+			case "concurrent":
+				_, err = zr.DecodeConcurrent(&got, 4)
+			}
+			if !bytes.Equal(got.Bytes(), data[:got.Len()]) {
+				t.Fatalf("%s/%s: output mismatch", tc.name, mode)
+			}
+			if tc.want >= 0 && got.Len() != tc.want {
+				t.Errorf("%s/%s: got %d bytes, want %d", tc.name, mode, got.Len(), tc.want)
+			}
+			var lerr *flate.LimitError
+			if tc.limit == "" {
+				if err != nil {
+					t.Errorf("%s/%s: %v", tc.name, mode, err)
+				}
+			} else if !errors.As(err, &lerr) || lerr.Limit != tc.limit {
+				t.Errorf("%s/%s: got error %v, want %s limit", tc.name, mode, err, tc.limit)
+			}
+		}
+	}
+}
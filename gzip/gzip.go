@@ -44,6 +44,13 @@ type Writer struct {
 	wroteHeader bool
 	closed      bool
 	buf         [10]byte
+
+	// Concurrent compression, see SetConcurrency.
+	blockSize int
+	blocks    int
+	cur       *concBlock
+	pending   []*concBlock
+	hist      []byte
 }
 
 // NewWriter returns a new Writer.
@@ -82,6 +89,7 @@ func (z *Writer) init(w io.Writer, level int) {
 		}
 	}
 
+	z.releaseBlocks()
 	*z = Writer{
 		Header: Header{
 			OS: 255, // unknown
@@ -89,6 +97,9 @@ func (z *Writer) init(w io.Writer, level int) {
 		w:          w,
 		level:      level,
 		compressor: compressor,
+		blockSize:  z.blockSize,
+		blocks:     z.blocks,
+		hist:       z.hist[:0],
 	}
 }
 
@@ -200,11 +211,14 @@ func (z *Writer) Write(p []byte) (int, error) {
 			}
 		}
 
-		if z.compressor == nil && z.level != StatelessCompression {
+		if z.compressor == nil && z.level != StatelessCompression && z.blocks == 0 {
 			z.compressor, _ = flate.NewWriter(z.w, z.level)
 		}
 	}
 	z.size += uint32(len(p))
+	if z.blocks > 0 {
+		return z.writeConcurrent(p)
+	}
 	z.digest = crc32.Update(z.digest, crc32.IEEETable, p)
 	if z.level == StatelessCompression {
 		return len(p), flate.StatelessDeflate(z.w, p, false, nil)
@@ -234,6 +248,10 @@ func (z *Writer) Flush() error {
 			return z.err
 		}
 	}
+	if z.blocks > 0 {
+		z.err = z.flushConcurrent()
+		return z.err
+	}
 	z.err = z.compressor.Flush()
 	return z.err
 }
@@ -254,7 +272,9 @@ func (z *Writer) Close() error {
 			return z.err
 		}
 	}
-	if z.level == StatelessCompression {
+	if z.blocks > 0 {
+		z.err = z.closeConcurrent()
+	} else if z.level == StatelessCompression {
 		z.err = flate.StatelessDeflate(z.w, nil, true, nil)
 	} else {
 		z.err = z.compressor.Close()
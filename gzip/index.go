@@ -0,0 +1,294 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// Index contains access points of a gzip file,
+// allowing decompression to start at other places than the beginning.
+// An index is created by BuildIndex and used by NewReaderAt.
+type Index struct {
+	// Span is the minimum distance in uncompressed bytes between access points.
+	Span int64
+
+	// Size is the total uncompressed size.
+	Size int64
+
+	// Points contains the access points, ordered by output offset.
+	Points []IndexPoint
+}
+
+// IndexPoint is an access point in a gzip file.
+type IndexPoint struct {
+	// In is the offset in bits of the point in the compressed file.
+	In int64
+
+	// Out is the offset of the point in the uncompressed output.
+	Out int64
+
+	// Window is the up to 32KB of output preceding the point.
+	// If the window is empty, In is at the start of a gzip member.
+	Window []byte
+}
+
+// indexMagic is the start of a serialized index, followed by the version.
+const indexMagic = "gzidx\x00\x01"
+
+// maxIndexWindow is the maximum window size of an access point.
+const maxIndexWindow = 32 << 10
+
+// countReader counts the bytes read.
+type countReader struct {
+	r flate.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// BuildIndex decompresses all of r and returns an index
+// with access points at least span uncompressed bytes apart.
+// Multistream files are supported.
+// Each access point stores up to 32KB of history,
+// so span should be reasonably large, for example 1MB.
+// All checksums are verified.
+func BuildIndex(r io.Reader, span int64) (*Index, error) {
+	if span <= 0 {
+		return nil, errors.New("gzip: index span must be positive")
+	}
+	cr := &countReader{r: bufio.NewReader(r)}
+	idx := &Index{Span: span}
+	var base int64
+	fr := flate.NewReaderCheckpoints(cr, span, func(c flate.Checkpoint) {
+		idx.Points = append(idx.Points, IndexPoint{
+			In:     base*8 + c.In,
+			Out:    idx.Size + c.Out,
+			Window: append([]byte{}, c.Window...),
+		})
+	})
+	z := Reader{r: cr, decompressor: fr}
+	for i := 0; ; i++ {
+		start := cr.n
+		if _, err := z.readHeader(); err != nil {
+			if err == io.EOF && i > 0 {
+				return idx, nil
+			}
+			return nil, err
+		}
+		base = cr.n
+		last := int64(0)
+		if len(idx.Points) > 0 {
+			last = idx.Points[len(idx.Points)-1].Out
+		}
+		if i > 0 && idx.Size-last >= span {
+			idx.Points = append(idx.Points, IndexPoint{In: start * 8, Out: idx.Size})
+		}
+		n, err := z.WriteTo(io.Discard)
+		if err != nil {
+			return nil, err
+		}
+		idx.Size += n
+	}
+}
+
+// MarshalBinary returns a serialized version of the index.
+func (idx *Index) MarshalBinary() ([]byte, error) {
+	dst := append([]byte{}, indexMagic...)
+	dst = appendUvarint(dst, uint64(idx.Span))
+	dst = appendUvarint(dst, uint64(idx.Size))
+	dst = appendUvarint(dst, uint64(len(idx.Points)))
+	var in, out int64
+	for _, p := range idx.Points {
+		if p.In < in || p.Out < out {
+			return nil, errors.New("gzip: index points out of order")
+		}
+		dst = appendUvarint(dst, uint64(p.In-in))
+		dst = appendUvarint(dst, uint64(p.Out-out))
+		dst = appendUvarint(dst, uint64(len(p.Window)))
+		dst = append(dst, p.Window...)
+		in, out = p.In, p.Out
+	}
+	return dst, nil
+}
+
+// UnmarshalBinary reads an index serialized by MarshalBinary.
+func (idx *Index) UnmarshalBinary(b []byte) error {
+	errCorrupt := errors.New("gzip: corrupt index")
+	if len(b) < len(indexMagic) || string(b[:len(indexMagic)]) != indexMagic {
+		return errCorrupt
+	}
+	b = b[len(indexMagic):]
+	readUvarint := func() (int64, bool) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v > 1<<62 {
+			return 0, false
+		}
+		b = b[n:]
+		return int64(v), true
+	}
+	span, ok1 := readUvarint()
+	size, ok2 := readUvarint()
+	n, ok3 := readUvarint()
+	// Each point takes at least 3 bytes.
+	if !ok1 || !ok2 || !ok3 || n > int64(len(b)/3) {
+		return errCorrupt
+	}
+	points := make([]IndexPoint, n)
+	var in, out int64
+	for i := range points {
+		dIn, ok1 := readUvarint()
+		dOut, ok2 := readUvarint()
+		wLen, ok3 := readUvarint()
+		if !ok1 || !ok2 || !ok3 || wLen > maxIndexWindow || wLen > int64(len(b)) {
+			return errCorrupt
+		}
+		in, out = in+dIn, out+dOut
+		if in < 0 || out > size {
+			return errCorrupt
+		}
+		points[i] = IndexPoint{In: in, Out: out, Window: append([]byte{}, b[:wLen]...)}
+		b = b[wLen:]
+	}
+	if len(b) != 0 {
+		return errCorrupt
+	}
+	*idx = Index{Span: span, Size: size, Points: points}
+	return nil
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(dst, tmp[:n]...)
+}
+
+// ReaderAt provides random access to the uncompressed content of a gzip file
+// using an Index.
+// Checksums are only verified for members that are read from their start.
+// ReaderAt is safe for concurrent use.
+type ReaderAt struct {
+	ra  io.ReaderAt
+	idx *Index
+}
+
+// NewReaderAt returns a ReaderAt that reads the uncompressed content of ra,
+// using the access points in idx, which must have been created from the same file.
+// Reads start decompressing at the nearest access point before the requested offset.
+func NewReaderAt(ra io.ReaderAt, idx *Index) *ReaderAt {
+	return &ReaderAt{ra: ra, idx: idx}
+}
+
+// Size returns the uncompressed size.
+func (r *ReaderAt) Size() int64 {
+	return r.idx.Size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gzip: negative offset")
+	}
+	if off >= r.idx.Size {
+		return 0, io.EOF
+	}
+	var eof error
+	if remain := r.idx.Size - off; int64(len(p)) > remain {
+		p = p[:remain]
+		eof = io.EOF
+	}
+	rd, err := r.NewReader(off)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(rd, p)
+	if err != nil {
+		return n, noEOF(err)
+	}
+	return n, eof
+}
+
+// NewReader returns a reader that returns the uncompressed content
+// starting at offset off.
+func (r *ReaderAt) NewReader(off int64) (io.Reader, error) {
+	pts := r.idx.Points
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].Out > off })
+	var rd io.Reader
+	var skip int64
+	if i == 0 || len(pts[i-1].Window) == 0 {
+		// Start of a member.
+		var start int64
+		if i > 0 {
+			start, skip = pts[i-1].In/8, off-pts[i-1].Out
+		} else {
+			skip = off
+		}
+		z, err := NewReader(io.NewSectionReader(r.ra, start, 1<<62))
+		if err != nil {
+			return nil, err
+		}
+		rd = z
+	} else {
+		p := pts[i-1]
+		br := bufio.NewReader(io.NewSectionReader(r.ra, p.In/8, 1<<62))
+		rd = &pointReader{br: br, fr: flate.NewReaderBits(br, int(p.In%8), p.Window)}
+		skip = off - p.Out
+	}
+	if _, err := io.CopyN(io.Discard, rd, skip); err != nil {
+		return nil, noEOF(err)
+	}
+	return rd, nil
+}
+
+// pointReader decompresses from an access point inside a member
+// and continues with any following members.
+type pointReader struct {
+	br *bufio.Reader
+	fr io.Reader
+	z  *Reader
+}
+
+func (p *pointReader) Read(b []byte) (int, error) {
+	if p.z != nil {
+		return p.z.Read(b)
+	}
+	if p.fr == nil {
+		return 0, io.EOF
+	}
+	n, err := p.fr.Read(b)
+	if err != io.EOF {
+		return n, err
+	}
+	p.fr = nil
+	// Skip the trailer, since the checksum cannot be verified.
+	if _, err := p.br.Discard(8); err != nil {
+		return n, noEOF(err)
+	}
+	if _, err := p.br.Peek(1); err == io.EOF {
+		return n, io.EOF
+	}
+	if p.z, err = NewReader(p.br); err != nil {
+		return n, err
+	}
+	return n, nil
+}
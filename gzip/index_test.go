@@ -0,0 +1,138 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	for len(data) < 1<<20 {
+		data = append(data, data...)
+	}
+	rnd := make([]byte, 100000)
+	rand.New(rand.NewSource(0)).Read(rnd)
+	data = append(data, rnd...)
+
+	// Write two members, the second with stored blocks.
+	var buf bytes.Buffer
+	half := len(data) / 2
+	for i, level := range []int{DefaultCompression, NoCompression} {
+		w, _ := NewWriterLevel(&buf, level)
+		w.Name = "test.txt"
+		in := data[:half]
+		if i == 1 {
+			in = data[half:]
+		}
+		for len(in) > 0 {
+			n := 50000
+			if n > len(in) {
+				n = len(in)
+			}
+			w.Write(in[:n])
+			w.Flush()
+			in = in[n:]
+		}
+		w.Close()
+	}
+	comp := buf.Bytes()
+
+	const span = 100000
+	idx, err := BuildIndex(bytes.NewReader(comp), span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Size != int64(len(data)) {
+		t.Fatalf("got size %d, want %d", idx.Size, len(data))
+	}
+	if len(idx.Points) < len(data)/span-2 {
+		t.Fatalf("got %d points", len(idx.Points))
+	}
+	var last int64
+	for i, p := range idx.Points {
+		if p.Out-last < span {
+			t.Fatalf("point %d at %d, previous at %d", i, p.Out, last)
+		}
+		last = p.Out
+	}
+
+	// Serialize.
+	b, err := idx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d points, %d bytes serialized", len(idx.Points), len(b))
+	var idx2 Index
+	if err := idx2.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if idx2.Size != idx.Size || idx2.Span != idx.Span || len(idx2.Points) != len(idx.Points) {
+		t.Fatal("index mismatch")
+	}
+	for i := range idx.Points {
+		a, b := idx.Points[i], idx2.Points[i]
+		if a.In != b.In || a.Out != b.Out || !bytes.Equal(a.Window, b.Window) {
+			t.Fatalf("point %d mismatch", i)
+		}
+	}
+	for _, n := range []int{0, 5, len(b) / 2, len(b) - 1} {
+		if err := idx2.UnmarshalBinary(b[:n]); err == nil {
+			t.Errorf("truncated at %d: expected error", n)
+		}
+	}
+
+	r := NewReaderAt(bytes.NewReader(comp), &idx2)
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("got size %d", r.Size())
+	}
+	rng := rand.New(rand.NewSource(1))
+	offsets := []int{0, 1, half - 10, half, len(data) - 100}
+	for _, p := range idx.Points {
+		offsets = append(offsets, int(p.Out), int(p.Out)-1)
+	}
+	for i := 0; i < 20; i++ {
+		offsets = append(offsets, rng.Intn(len(data)))
+	}
+	got := make([]byte, 1000)
+	for _, off := range offsets {
+		n, err := r.ReadAt(got, int64(off))
+		want := data[off:]
+		if len(want) > len(got) {
+			want = want[:len(got)]
+			if err != nil {
+				t.Fatalf("offset %d: %v", off, err)
+			}
+		} else if err != io.EOF {
+			t.Fatalf("offset %d: want io.EOF, got %v", off, err)
+		}
+		if !bytes.Equal(got[:n], want) {
+			t.Fatalf("offset %d: output mismatch", off)
+		}
+	}
+	if _, err := r.ReadAt(got, int64(len(data))); err != io.EOF {
+		t.Fatalf("want io.EOF, got %v", err)
+	}
+
+	// Read to the end from an access point in the first member.
+	rd, err := r.NewReader(idx.Points[1].Out + 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(all, data[idx.Points[1].Out+10:]) {
+		t.Fatal("output mismatch reading to end")
+	}
+}
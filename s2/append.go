@@ -0,0 +1,121 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// OpenAppend returns a Writer that appends to the existing stream in rws.
+// The index of the stream is read with Index.LoadStream.
+// If the stream has no index, the stream is indexed using IndexStream.
+// If rws is empty, a new stream is started.
+//
+// New blocks are written after the existing data and a combined index
+// is written to the end of the stream on Close.
+// If rws has a Truncate(size int64) error method, like *os.File, the old index is removed.
+// Otherwise it is left in the stream as a skippable chunk.
+//
+// Appending to a Snappy stream requires the WriterSnappyCompat option.
+// Writer options are applied as usual and WriterAddIndex is always enabled.
+func OpenAppend(rws io.ReadWriteSeeker, opts ...WriterOption) (*Writer, error) {
+	w := NewWriter(nil, opts...)
+	if err := w.err(nil); err != nil {
+		return nil, err
+	}
+	w.appendIndex = true
+
+	size, err := rws.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		w.Reset(rws)
+		return w, nil
+	}
+
+	// Check the stream identifier.
+	var hdr [len(magicChunk)]byte
+	if _, err := rws.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rws, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+	switch string(hdr[:]) {
+	case magicChunk:
+	case magicChunkSnappy:
+		if !w.snappy {
+			return nil, errors.New("s2: appending to snappy stream requires WriterSnappyCompat")
+		}
+	default:
+		return nil, ErrCorrupt
+	}
+
+	// Load the index and find where it starts.
+	var index Index
+	start := size
+	err = ErrUnsupported
+	if size >= int64(len(hdr)+skippableFrameHeader+len(S2IndexTrailer)) {
+		err = index.LoadStream(rws)
+	}
+	switch err {
+	case nil:
+		var tmp [4 + len(S2IndexTrailer)]byte
+		if _, err := rws.Seek(-int64(len(tmp)), io.SeekEnd); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rws, tmp[:]); err != nil {
+			return nil, err
+		}
+		start = size - int64(binary.LittleEndian.Uint32(tmp[:4]))
+	case ErrUnsupported:
+		if _, err := rws.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		b, err := IndexStream(rws)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := index.Load(b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	if index.TotalUncompressed < 0 || start < int64(len(hdr)) || start > size {
+		return nil, ErrCorrupt
+	}
+	if n := len(index.info); n > 0 && index.info[n-1].compressedOffset >= start {
+		return nil, ErrCorrupt
+	}
+
+	// Remove the old index if possible.
+	if t, ok := rws.(interface{ Truncate(size int64) error }); ok && start < size {
+		if err := t.Truncate(start); err != nil {
+			return nil, err
+		}
+	} else {
+		start = size
+	}
+	if _, err := rws.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	w.Reset(rws)
+	w.wroteStreamHeader = true
+	w.written = start
+	w.uncompWritten = index.TotalUncompressed
+	w.index.info = index.info
+	if index.estBlockUncomp > 0 {
+		w.index.estBlockUncomp = index.estBlockUncomp
+	}
+	return w, nil
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
@@ -30,12 +31,13 @@ var (
 	faster    = flag.Bool("faster", false, "Compress faster, but with a minor compression loss")
 	slower    = flag.Bool("slower", false, "Compress more, but a lot slower")
 	snappy    = flag.Bool("snappy", false, "Generate Snappy compatible output stream")
-	recomp    = flag.Bool("recomp", false, "Recompress Snappy or S2 input")
+	recomp    = flag.Bool("recomp", false, "Recompress Snappy or S2 input. With -snappy only blocks that aren't Snappy compatible are recompressed")
 	cpu       = flag.Int("cpu", runtime.GOMAXPROCS(0), "Compress using this amount of threads")
 	blockSize = flag.String("blocksize", "4M", "Max  block size. Examples: 64K, 256K, 1M, 4M. Must be power of two and <= 4MB")
 	block     = flag.Bool("block", false, "Compress as a single block. Will load content into memory.")
 	safe      = flag.Bool("safe", false, "Do not overwrite output files")
 	index     = flag.Bool("index", true, "Add seek index")
+	indexFile = flag.Bool("index-file", false, "Write seek index to a separate file named as the output with '"+s2IdxExt+"' added, like 'file.ext"+s2Ext+s2IdxExt+"'")
 	padding   = flag.String("pad", "1", "Pad size to a multiple of this value, Examples: 500, 64K, 256K, 1M, 4M, etc")
 	stdout    = flag.Bool("c", false, "Write all output to stdout. Multiple input files will be concatenated")
 	out       = flag.String("o", "", "Write output to another file. Single input file only")
@@ -43,6 +45,8 @@ var (
 	quiet     = flag.Bool("q", false, "Don't write any output to terminal, except errors")
 	bench     = flag.Int("bench", 0, "Run benchmark n times. No output will be written")
 	verify    = flag.Bool("verify", false, "Verify written files")
+	recursive = flag.Bool("r", false, "Compress all files in directories recursively")
+	tarMode   = flag.Bool("tar", false, "Compress all input files and directories into a single tar archive")
 	help      = flag.Bool("help", false, "Display help")
 
 	cpuprofile, memprofile, traceprofile string
@@ -54,6 +58,7 @@ var (
 const (
 	s2Ext     = ".s2"
 	snappyExt = ".sz" // https://github.com/google/snappy/blob/main/framing_format.txt#L34
+	s2IdxExt  = ".s2idx"
 )
 
 func main() {
@@ -86,6 +91,12 @@ Directories can be wildcards as well. testdir/*/*.txt will match testdir/subdir/
 File names beginning with 'http://' and 'https://' will be downloaded and compressed.
 Only http response code 200 is accepted.
 
+With -r directories are traversed and all files are compressed separately.
+Files with '`+s2Ext+`', '`+snappyExt+`' or '`+s2IdxExt+`' extensions in directories are skipped.
+
+With -tar all inputs are written to a single archive named 'name.tar`+s2Ext+`'.
+Directories are added recursively. Use -o to specify the name when there are several inputs.
+
 Options:`)
 		flag.PrintDefaults()
 		os.Exit(0)
@@ -107,10 +118,16 @@ Options:`)
 
 	// No args, use stdin/stdout
 	if len(args) == 1 && args[0] == "-" {
+		if *tarMode {
+			exitErr(errors.New("-tar cannot be used with stdin"))
+		}
 		// Catch interrupt, so we don't exit at once.
 		// os.Stdin will return EOF, so we should be able to get everything.
 		signal.Notify(make(chan os.Signal, 1), os.Interrupt)
 		if len(*out) == 0 {
+			if *indexFile {
+				exitErr(errors.New("-index-file requires -o when writing to stdout"))
+			}
 			wr.Reset(os.Stdout)
 		} else {
 			if *safe {
@@ -128,6 +145,12 @@ Options:`)
 		}
 		_, err = wr.ReadFrom(os.Stdin)
 		printErr(err)
+		if *indexFile {
+			idx, err := wr.CloseIndex()
+			exitErr(err)
+			writeIndex(*out+s2IdxExt, idx, os.ModePerm)
+			return
+		}
 		printErr(wr.Close())
 		return
 	}
@@ -135,6 +158,9 @@ Options:`)
 
 	for _, pattern := range args {
 		if isHTTP(pattern) {
+			if *tarMode {
+				exitErr(errors.New("-tar cannot be used with downloads"))
+			}
 			files = append(files, pattern)
 			continue
 		}
@@ -145,6 +171,9 @@ Options:`)
 		}
 		files = append(files, found...)
 	}
+	if *recursive && !*tarMode {
+		files = walkFiles(files)
+	}
 	if cpuprofile != "" {
 		f, err := os.Create(cpuprofile)
 		if err != nil {
@@ -175,6 +204,27 @@ Options:`)
 	}
 
 	*quiet = *quiet || *stdout
+	if *tarMode {
+		if *bench > 0 || *block || *remove || *recomp {
+			exitErr(errors.New("-tar cannot be used with -bench, -block, -rm or -recomp"))
+		}
+		if *stdout && *indexFile {
+			exitErr(errors.New("-index-file cannot be used with -c"))
+		}
+		dstFilename := *out
+		if dstFilename == "" {
+			name := filepath.Clean(files[0])
+			if len(files) > 1 || name == "." || name == ".." || strings.HasSuffix(name, string(filepath.Separator)) {
+				exitErr(errors.New("-o must be specified for this input"))
+			}
+			dstFilename = name + ".tar" + s2Ext
+			if *snappy {
+				dstFilename = name + ".tar" + snappyExt
+			}
+		}
+		compressTar(files, wr, dstFilename)
+		return
+	}
 	if *bench > 0 {
 		debug.SetGCPercent(10)
 		dec := s2.NewReader(nil)
@@ -340,6 +390,9 @@ Options:`)
 	if *out != "" && len(files) > 1 {
 		exitErr(errors.New("-out parameter can only be used with one input"))
 	}
+	if *indexFile && (*block || *stdout) {
+		exitErr(errors.New("-index-file cannot be used with -block or -c"))
+	}
 	for _, filename := range files {
 		if *block {
 			if *recomp {
@@ -450,6 +503,7 @@ Options:`)
 			if !*quiet {
 				fmt.Print("Compressing ", filename, " -> ", dstFilename)
 			}
+			idxFilename := dstFilename + s2IdxExt
 
 			if dstFilename == filename && !*stdout {
 				if *remove {
@@ -476,7 +530,7 @@ Options:`)
 				// We only need to count for printing
 				src = rc
 			}
-			if *recomp {
+			if *recomp && !*snappy {
 				dec := s2.NewReader(src)
 				pr, pw := io.Pipe()
 				go func() {
@@ -509,10 +563,21 @@ Options:`)
 			wr.Reset(&wc)
 			defer wr.Close()
 			start := time.Now()
-			_, err = wr.ReadFrom(src)
-			exitErr(err)
-			err = wr.Close()
+			if *recomp && *snappy {
+				// Only recompress blocks that aren't compatible.
+				_, err = wr.CopySnappyCompatible(src)
+			} else {
+				_, err = wr.ReadFrom(src)
+			}
 			exitErr(err)
+			if *indexFile {
+				idx, err := wr.CloseIndex()
+				exitErr(err)
+				writeIndex(idxFilename, idx, mode)
+			} else {
+				err = wr.Close()
+				exitErr(err)
+			}
 			if !*quiet {
 				input := rc.n
 				elapsed := time.Since(start)
@@ -602,6 +667,51 @@ func verifyTo(w io.Writer) (io.Writer, func() error) {
 	}
 }
 
+// walkFiles replaces directories in paths with all regular files within them.
+// Compressed files and index files in directories are skipped.
+func walkFiles(paths []string) []string {
+	var files []string
+	for _, p := range paths {
+		if isHTTP(p) {
+			files = append(files, p)
+			continue
+		}
+		st, err := os.Stat(p)
+		exitErr(err)
+		if !st.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			switch filepath.Ext(name) {
+			case s2Ext, snappyExt, s2IdxExt, ".block":
+				return nil
+			}
+			files = append(files, name)
+			return nil
+		})
+		exitErr(err)
+	}
+	return files
+}
+
+// writeIndex writes a seek index to a separate file.
+func writeIndex(filename string, idx []byte, mode os.FileMode) {
+	if *safe {
+		_, err := os.Stat(filename)
+		if !os.IsNotExist(err) {
+			exitErr(errors.New("destination index file exists"))
+		}
+	}
+	exitErr(os.WriteFile(filename, idx, mode))
+}
+
 func printErr(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "\nERROR:", err.Error())
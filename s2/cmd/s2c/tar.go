@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// compressTar writes the files and directories in files
+// as a single compressed tar archive to dstFilename.
+func compressTar(files []string, wr *s2.Writer, dstFilename string) {
+	if !*quiet {
+		fmt.Print("Compressing ", strings.Join(files, ", "), " -> ", dstFilename)
+	}
+	var out io.Writer
+	switch {
+	case *stdout:
+		out = os.Stdout
+	default:
+		if *safe {
+			_, err := os.Stat(dstFilename)
+			if !os.IsNotExist(err) {
+				exitErr(errors.New("destination file exists"))
+			}
+		}
+		dstFile, err := os.OpenFile(dstFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+		exitErr(err)
+		defer dstFile.Close()
+		bw := bufio.NewWriterSize(dstFile, 4<<20)
+		defer bw.Flush()
+		out = bw
+	}
+	out, errFn := verifyTo(out)
+	wc := wCounter{out: out}
+	wr.Reset(&wc)
+	defer wr.Close()
+	start := time.Now()
+	tc := wCounter{out: wr}
+	exitErr(writeTar(&tc, files))
+	if *indexFile {
+		idx, err := wr.CloseIndex()
+		exitErr(err)
+		writeIndex(dstFilename+s2IdxExt, idx, 0666)
+	} else {
+		exitErr(wr.Close())
+	}
+	if !*quiet {
+		input := tc.n
+		elapsed := time.Since(start)
+		mbpersec := (float64(input) / (1024 * 1024)) / (float64(elapsed) / (float64(time.Second)))
+		pct := float64(wc.n) * 100 / float64(input)
+		fmt.Printf(" %d -> %d [%.02f%%]; %.01fMB/s\n", input, wc.n, pct, mbpersec)
+	}
+	exitErr(errFn())
+}
+
+// writeTar writes the files and directories in paths as a tar archive to w.
+// Directories are added recursively. Symbolic links are stored as links.
+func writeTar(w io.Writer, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, root := range paths {
+		err := filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			var link string
+			switch {
+			case fi.Mode().IsRegular(), fi.IsDir():
+			case fi.Mode()&os.ModeSymlink != 0:
+				link, err = os.Readlink(name)
+				if err != nil {
+					return err
+				}
+			default:
+				if !*quiet {
+					fmt.Print("\nSkipping ", name)
+				}
+				return nil
+			}
+			hdr, err := tar.FileInfoHeader(fi, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = tarName(name)
+			if hdr.Name == "" {
+				return nil
+			}
+			if fi.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// tarName returns the name of a file inside the archive.
+// Volume names, leading separators and parent directory elements are removed.
+func tarName(name string) string {
+	name = filepath.ToSlash(strings.TrimPrefix(name, filepath.VolumeName(name)))
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
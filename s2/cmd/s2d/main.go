@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"strconv"
@@ -29,13 +30,20 @@ var (
 	remove = flag.Bool("rm", false, "Delete source file(s) after successful decompression")
 	quiet  = flag.Bool("q", false, "Don't write any output to terminal, except errors")
 	bench  = flag.Int("bench", 0, "Run benchmark n times. No output will be written")
-	tail   = flag.String("tail", "", "Return last of compressed file. Examples: 92, 64K, 256K, 1M, 4M. Requires Index")
-	offset = flag.String("offset", "", "Start at offset. Examples: 92, 64K, 256K, 1M, 4M. Requires Index")
+	tail   = flag.String("tail", "", "Return last of compressed file. Examples: 92, 64K, 256K, 1M, 4M. Uses index if available")
+	offset = flag.String("offset", "", "Start at offset. Examples: 92, 64K, 256K, 1M, 4M. Uses index if available")
 	help   = flag.Bool("help", false, "Display help")
 	out    = flag.String("o", "", "Write output to another file. Single input file only")
 	block  = flag.Bool("block", false, "Decompress as a single block. Will load content into memory.")
 	cpu    = flag.Int("cpu", runtime.NumCPU(), "Decompress streams using this amount of threads")
 
+	indexFile = flag.Bool("index-file", false, "Write seek index of each input to 'filename"+s2IdxExt+"'. No output is decompressed")
+	indexJSON = flag.Bool("index-json", false, "Print seek index of each input as JSON. No output is decompressed")
+	list      = flag.Bool("list", false, "List chunks and stream information of each input. No output is decompressed")
+	recursive = flag.Bool("r", false, "Decompress all compressed files in directories recursively")
+	tarMode   = flag.Bool("tar", false, "Extract compressed tar archives to the directory given with -o, default is the current directory")
+	member    = flag.String("member", "", "Only extract this file or directory from tar archives. Uses the index to skip other files")
+
 	version = "(dev)"
 	date    = "(unknown)"
 )
@@ -43,6 +51,7 @@ var (
 const (
 	s2Ext     = ".s2"
 	snappyExt = ".sz" // https://github.com/google/snappy/blob/main/framing_format.txt#L34
+	s2IdxExt  = ".s2idx"
 )
 
 func main() {
@@ -67,6 +76,17 @@ Directories can be wildcards as well. testdir/*/*.txt will match testdir/subdir/
 File names beginning with 'http://' and 'https://' will be downloaded and decompressed.
 Extensions on downloaded files are ignored. Only http response code 200 is accepted.
 
+If 'filename`+s2IdxExt+`' exists, it is used as seek index for --offset and --tail.
+If there is no index, it is created by reading the input.
+
+Use --list to show chunks, sizes and the format of each input without decompressing it.
+
+With -r directories are traversed and all compressed files are decompressed.
+
+With -tar archives created with 's2c -tar' are extracted.
+Files are never written outside the output directory.
+
+
 Options:`)
 		flag.PrintDefaults()
 		os.Exit(0)
@@ -78,7 +98,42 @@ Options:`)
 	if tailBytes > 0 && offset > 0 {
 		exitErr(errors.New("--offset and --tail cannot be used together"))
 	}
+	if *indexFile && *indexJSON {
+		exitErr(errors.New("--index-file and --index-json cannot be used together"))
+	}
+	if *member != "" && !*tarMode {
+		exitErr(errors.New("-member can only be used with -tar"))
+	}
 	if len(args) == 1 && args[0] == "-" {
+		if *tarMode {
+			dst := *out
+			if dst == "" {
+				dst = "."
+			}
+			r.Reset(os.Stdin)
+			found, err := extractTar(dst, r, *member)
+			exitErr(err)
+			if *member != "" && !found {
+				exitErr(fmt.Errorf("member %q not found", *member))
+			}
+			return
+		}
+		if *list {
+			listStream("(stdin)", os.Stdin)
+			return
+		}
+		if *indexJSON {
+			idx, err := s2.IndexStream(bufio.NewReaderSize(os.Stdin, 1<<20))
+			exitErr(err)
+			var index s2.Index
+			_, err = index.Load(idx)
+			exitErr(err)
+			printIndex(&index)
+			return
+		}
+		if *indexFile {
+			exitErr(errors.New("--index-file cannot be used with stdin"))
+		}
 		r.Reset(os.Stdin)
 		if *verify {
 			_, err := io.Copy(io.Discard, r)
@@ -121,9 +176,63 @@ Options:`)
 		}
 		files = append(files, found...)
 	}
+	if *recursive {
+		files = walkFiles(files)
+	}
 
 	*quiet = *quiet || *stdout
 
+	if *tarMode {
+		dst := *out
+		if dst == "" {
+			dst = "."
+		}
+		for _, filename := range files {
+			extractTarFile(r, filename, dst, *member)
+		}
+		os.Exit(0)
+	}
+
+	if *list {
+		for _, filename := range files {
+			file, _, _ := openFile(filename)
+			listStream(filename, file)
+			file.Close()
+		}
+		os.Exit(0)
+	}
+
+	if *indexFile || *indexJSON {
+		for _, filename := range files {
+			switch {
+			case *indexJSON:
+				printIndex(loadIndex(filename))
+			case isHTTP(filename):
+				exitErr(errors.New("--index-file cannot be used with downloads"))
+			default:
+				dstFilename := filename + s2IdxExt
+				if !*quiet {
+					fmt.Print("Indexing ", filename, " -> ", dstFilename)
+				}
+				file, _, mode := openFile(filename)
+				idx, err := s2.IndexStream(bufio.NewReaderSize(file, 1<<20))
+				file.Close()
+				exitErr(err)
+				if *safe {
+					_, err := os.Stat(dstFilename)
+					if !os.IsNotExist(err) {
+						exitErr(errors.New("destination files exists"))
+					}
+				}
+				exitErr(os.WriteFile(dstFilename, idx, mode))
+				if !*quiet {
+					fmt.Printf(" %d bytes\n", len(idx))
+				}
+			}
+		}
+		os.Exit(0)
+	}
+
 	if *bench > 0 {
 		debug.SetGCPercent(10)
 		for _, filename := range files {
@@ -288,7 +397,18 @@ Options:`)
 			} else {
 				r.Reset(src)
 				if tailBytes > 0 || offset > 0 {
-					rs, err := r.ReadSeeker(tailBytes > 0, nil)
+					idx := sidecarIndex(filename)
+					rs, err := r.ReadSeeker(tailBytes > 0, idx)
+					if err != nil && idx != nil {
+						exitErr(fmt.Errorf("index file %s: %v", filename+s2IdxExt, err))
+					}
+					if err != nil && tailBytes > 0 {
+						// No index, create one from the stream.
+						idx, err = buildIndex(rc.(io.ReadSeeker))
+						exitErr(err)
+						r.Reset(src)
+						rs, err = r.ReadSeeker(true, idx)
+					}
 					exitErr(err)
 					if tailBytes > 0 {
 						_, err = rs.Seek(-tailBytes, io.SeekEnd)
@@ -321,12 +441,153 @@ Options:`)
 					}
 					err := os.Remove(filename)
 					exitErr(err)
+					if sidecarIndex(filename) != nil {
+						exitErr(os.Remove(filename + s2IdxExt))
+					}
 				})
 			}
 		}()
 	}
 }
 
+// walkFiles replaces directories in paths with all compressed files within them.
+func walkFiles(paths []string) []string {
+	var files []string
+	for _, p := range paths {
+		if isHTTP(p) {
+			files = append(files, p)
+			continue
+		}
+		st, err := os.Stat(p)
+		exitErr(err)
+		if !st.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			switch filepath.Ext(strings.TrimSuffix(name, ".block")) {
+			case s2Ext, snappyExt, ".snappy":
+				files = append(files, name)
+			}
+			return nil
+		})
+		exitErr(err)
+	}
+	return files
+}
+
+// sidecarIndex returns the content of the index file belonging to filename.
+// nil is returned if there is no index file.
+func sidecarIndex(filename string) []byte {
+	if isHTTP(filename) {
+		return nil
+	}
+	b, err := os.ReadFile(filename + s2IdxExt)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	exitErr(err)
+	return b
+}
+
+// buildIndex creates an index by reading the stream from the start.
+// The stream is returned to the start when done.
+func buildIndex(rs io.ReadSeeker) ([]byte, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	idx, err := s2.IndexStream(bufio.NewReaderSize(rs, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	return idx, err
+}
+
+// loadIndex returns the index of the stream in filename.
+// The index is loaded from the index file, from the end of the stream,
+// or created by reading the stream, in that order.
+func loadIndex(filename string) *s2.Index {
+	var index s2.Index
+	idx := sidecarIndex(filename)
+	if idx == nil {
+		file, _, _ := openFile(filename)
+		defer file.Close()
+		rs, ok := file.(io.ReadSeeker)
+		if ok {
+			err := index.LoadStream(rs)
+			if err == nil {
+				return &index
+			}
+			if err != s2.ErrUnsupported {
+				exitErr(err)
+			}
+			idx, err = buildIndex(rs)
+			exitErr(err)
+		} else {
+			var err error
+			idx, err = s2.IndexStream(bufio.NewReaderSize(file, 1<<20))
+			exitErr(err)
+		}
+	}
+	_, err := index.Load(idx)
+	exitErr(err)
+	return &index
+}
+
+// listStream prints the chunks of the stream in r and a summary.
+// If quiet is set only the summary is printed.
+func listStream(name string, r io.Reader) {
+	info, err := s2.Inspect(bufio.NewReaderSize(r, 1<<20))
+	fmt.Println(name + ":")
+	if !*quiet && len(info.Chunks) > 0 {
+		fmt.Printf("%12s %-18s %9s %12s  %s\n", "Offset", "Type", "Size", "Uncompressed", "Status")
+		for _, c := range info.Chunks {
+			var uncomp, status string
+			if c.Type <= 1 {
+				uncomp = strconv.Itoa(c.Uncompressed)
+				switch {
+				case c.Err != nil:
+					status = c.Err.Error()
+				case !c.CRCValid:
+					status = "CRC mismatch"
+				case c.SnappyIncompatible:
+					status = "ok, S2 only"
+				default:
+					status = "ok"
+				}
+			}
+			line := fmt.Sprintf("%12d %-18s %9d %12s  %s", c.Offset, c.TypeName(), c.Size, uncomp, status)
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	}
+	format := "S2"
+	switch {
+	case info.SnappyStreams == info.Streams:
+		format = "Snappy"
+	case info.SnappyStreams > 0:
+		format = "S2 and Snappy"
+	}
+	fmt.Printf("%d chunks, %d -> %d bytes, ratio %.02f. Format: %s, Snappy compatible: %v, index: %v\n",
+		len(info.Chunks), info.Compressed, info.Uncompressed, info.Ratio(), format, info.SnappyCompatible, info.HasIndex)
+	if info.Corrupt > 0 || info.CRCErrors > 0 {
+		fmt.Printf("%d corrupt chunks, %d CRC mismatches\n", info.Corrupt, info.CRCErrors)
+	}
+	exitErr(err)
+}
+
+// printIndex writes the index as JSON to stdout.
+func printIndex(index *s2.Index) {
+	_, err := os.Stdout.Write(append(index.JSON(), '\n'))
+	exitErr(err)
+}
+
 func openFile(name string) (rc io.ReadCloser, size int64, mode os.FileMode) {
 	if isHTTP(name) {
 		resp, err := http.Get(name)
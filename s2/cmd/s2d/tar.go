@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/s2/cmd/internal/readahead"
+)
+
+// extractTarFile extracts the compressed tar archive in filename to dst.
+// If member is set, only the member with that name,
+// or members in the directory with that name, are extracted.
+// Member data that is not extracted is skipped using the index if available.
+func extractTarFile(r *s2.Reader, filename, dst, member string) {
+	if !*quiet {
+		fmt.Println("Extracting", filename, "->", dst)
+	}
+	file, _, _ := openFile(filename)
+	defer file.Close()
+	var src io.Reader
+	if rs, ok := file.(io.ReadSeeker); ok && member != "" {
+		r.Reset(rs)
+		seeker, err := r.ReadSeeker(false, sidecarIndex(filename))
+		exitErr(err)
+		src = seeker
+	} else {
+		ra, err := readahead.NewReaderSize(file, 2, 4<<20)
+		exitErr(err)
+		defer ra.Close()
+		r.Reset(ra)
+		src = r
+	}
+	found, err := extractTar(dst, src, member)
+	exitErr(err)
+	if member != "" && !found {
+		exitErr(fmt.Errorf("member %q not found in %s", member, filename))
+	}
+}
+
+// extractTar extracts the tar archive in r to dst.
+// Members that would be written outside dst are rejected.
+// Returns whether any members matching member were found.
+func extractTar(dst string, r io.Reader, member string) (found bool, err error) {
+	member = strings.Trim(member, "/")
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return found, nil
+		}
+		if err != nil {
+			return found, err
+		}
+		name := strings.Trim(hdr.Name, "/")
+		if member != "" && name != member && !strings.HasPrefix(name, member+"/") {
+			continue
+		}
+		found = true
+		target, err := tarTarget(dst, name)
+		if err != nil {
+			return found, err
+		}
+		if *safe && hdr.Typeflag != tar.TypeDir {
+			if _, err := os.Lstat(target); !os.IsNotExist(err) {
+				return found, fmt.Errorf("destination file %s exists", target)
+			}
+		}
+		if !*quiet {
+			fmt.Println(target)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeTarFile(target, tr, os.FileMode(hdr.Mode).Perm())
+		case tar.TypeSymlink:
+			// The link must point inside dst.
+			if filepath.IsAbs(hdr.Linkname) {
+				return found, fmt.Errorf("illegal link target %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			if _, err := tarTarget(dst, filepath.Join(filepath.Dir(name), hdr.Linkname)); err != nil {
+				return found, err
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				os.Remove(target)
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		case tar.TypeLink:
+			var old string
+			old, err = tarTarget(dst, hdr.Linkname)
+			if err == nil {
+				if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+					os.Remove(target)
+					err = os.Link(old, target)
+				}
+			}
+		default:
+			if !*quiet {
+				fmt.Println("Skipping unsupported type:", hdr.Name)
+			}
+		}
+		if err != nil {
+			return found, err
+		}
+	}
+}
+
+// tarTarget returns the path of the member name within dst.
+// An error is returned if the path is outside dst,
+// or if a parent directory within dst is a symbolic link.
+func tarTarget(dst, name string) (string, error) {
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dst, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	dir := dst
+	for _, elem := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if elem == "." {
+			continue
+		}
+		dir = filepath.Join(dir, elem)
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			break
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("illegal file path through symbolic link: %s", name)
+		}
+	}
+	return target, nil
+}
+
+// writeTarFile writes the content of r to a new file.
+// Existing files and links are removed first.
+func writeTarFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = s2.ErrCorrupt
+	}
+	return err
+}
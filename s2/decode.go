@@ -25,6 +25,8 @@ var (
 	ErrTooLarge = errors.New("s2: decoded block is too large")
 	// ErrUnsupported reports that the input isn't supported.
 	ErrUnsupported = errors.New("s2: unsupported input")
+	// ErrReaderClosed is returned when reading from a closed Reader.
+	ErrReaderClosed = errors.New("s2: reader closed")
 )
 
 // ErrCantSeek is returned if the stream cannot be seeked.
@@ -97,6 +99,10 @@ func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
 			return &nr
 		}
 	}
+	if nr.rec != nil && nr.concurrency > 1 {
+		nr.err = errors.New("s2: ReaderRecover cannot be combined with ReaderConcurrency")
+		return &nr
+	}
 	nr.maxBufSize = MaxEncodedLen(nr.maxBlock) + checksumSize
 	if nr.lazyBuf > 0 {
 		nr.buf = make([]byte, MaxEncodedLen(nr.lazyBuf)+checksumSize)
@@ -105,6 +111,10 @@ func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
 	}
 	nr.readHeader = nr.ignoreStreamID
 	nr.paramsOK = true
+	if nr.rec != nil {
+		nr.rec.reset(r)
+		nr.r = nr.rec
+	}
 	return &nr
 }
 
@@ -167,7 +177,7 @@ func ReaderSkippableCB(id uint8, fn func(r io.Reader) error) ReaderOption {
 		if id < 0x80 || id > 0xfd {
 			return fmt.Errorf("ReaderSkippableCB: Invalid id provided, must be 0x80-0xfd (inclusive)")
 		}
-		r.skippableCB[id] = fn
+		r.skippableCB[id-0x80] = fn
 		return nil
 	}
 }
@@ -180,6 +190,18 @@ func ReaderIgnoreCRC() ReaderOption {
 	}
 }
 
+// ReaderDict will decompress all blocks using the supplied dictionary as history.
+// This must be the same dictionary as was used when compressing the stream.
+func ReaderDict(dict *Dict) ReaderOption {
+	return func(r *Reader) error {
+		if dict == nil {
+			return errors.New("s2: nil dictionary")
+		}
+		r.dict = dict
+		return nil
+	}
+}
+
 // Reader is an io.Reader that can read Snappy-compressed bytes.
 type Reader struct {
 	r           io.Reader
@@ -189,6 +211,9 @@ type Reader struct {
 	skippableCB [0x80]func(r io.Reader) error
 	blockStart  int64 // Uncompressed offset at start of current.
 	index       *Index
+	dict        *Dict
+	rec         *recoverReader
+	ahead       *readAhead
 
 	// decoded[i:j] contains decoded bytes that have not yet been passed on.
 	i, j int
@@ -197,7 +222,11 @@ type Reader struct {
 	// maximum expected buffer size.
 	maxBufSize int
 	// alloc a buffer this size if > 0.
-	lazyBuf        int
+	lazyBuf int
+	// number of decoded blocks to cache. Only used by ReaderAt.
+	cacheBlocks int
+	// number of blocks to decode ahead.
+	concurrency    int
 	readHeader     bool
 	paramsOK       bool
 	snappyFrame    bool
@@ -220,6 +249,14 @@ func (r *Reader) ensureBufferSize(n int) bool {
 	return true
 }
 
+// decodeBlock decodes a compressed block, using the dictionary if one was supplied.
+func (r *Reader) decodeBlock(dst, src []byte) ([]byte, error) {
+	if r.dict != nil {
+		return r.dict.Decode(dst, src)
+	}
+	return Decode(dst, src)
+}
+
 // Reset discards any buffered data, resets all state, and switches the Snappy
 // reader to read from r. This permits reusing a Reader rather than allocating
 // a new one.
@@ -227,8 +264,13 @@ func (r *Reader) Reset(reader io.Reader) {
 	if !r.paramsOK {
 		return
 	}
+	r.stopAhead(false)
 	r.index = nil
 	r.r = reader
+	if r.rec != nil {
+		r.rec.reset(reader)
+		r.r = r.rec
+	}
 	r.err = nil
 	r.i = 0
 	r.j = 0
@@ -291,6 +333,25 @@ func (r *Reader) skippable(tmp []byte, n int, allowEOF bool, id uint8) (ok bool)
 
 // Read satisfies the io.Reader interface.
 func (r *Reader) Read(p []byte) (int, error) {
+	if r.rec == nil {
+		return r.read(p)
+	}
+	for {
+		// Uncompressed offset of the next block.
+		out := r.blockStart + int64(r.j)
+		r.rec.record = true
+		n, err := r.read(p)
+		r.rec.record = false
+		if err == nil || !recoverable(err) {
+			return n, err
+		}
+		if !r.resync(out, err) {
+			return 0, r.err
+		}
+	}
+}
+
+func (r *Reader) read(p []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
@@ -300,6 +361,15 @@ func (r *Reader) Read(p []byte) (int, error) {
 			r.i += n
 			return n, nil
 		}
+		if r.concurrency > 1 {
+			if !r.nextAhead() {
+				return 0, r.err
+			}
+			continue
+		}
+		if r.rec != nil {
+			r.rec.mark()
+		}
 		if !r.readFull(r.buf[:4], true) {
 			return 0, r.err
 		}
@@ -353,7 +423,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 				}
 				r.decoded = make([]byte, n)
 			}
-			if _, err := Decode(r.decoded, buf); err != nil {
+			if _, err := r.decodeBlock(r.decoded, buf); err != nil {
 				r.err = err
 				return 0, r.err
 			}
@@ -455,7 +525,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 // On success the number of bytes decompressed nil and is returned.
 // This is mainly intended for bigger streams.
 func (r *Reader) DecodeConcurrent(w io.Writer, concurrent int) (written int64, err error) {
-	if r.i > 0 || r.j > 0 || r.blockStart > 0 {
+	if r.i > 0 || r.j > 0 || r.blockStart > 0 || r.ahead != nil {
 		return 0, errors.New("DecodeConcurrent called after ")
 	}
 	if concurrent <= 0 {
@@ -597,7 +667,7 @@ func (r *Reader) DecodeConcurrent(w io.Writer, concurrent int) (written int64, e
 			go func() {
 				defer wg.Done()
 				decoded = decoded[:n]
-				_, err := Decode(decoded, buf)
+				_, err := r.decodeBlock(decoded, buf)
 				toRead <- orgBuf
 				if err != nil {
 					writtenBlocks <- decoded
@@ -731,6 +801,16 @@ func (r *Reader) Skip(n int64) error {
 			r.i = r.j
 		}
 
+		if r.concurrency > 1 {
+			if !r.nextAhead() {
+				if r.err == io.EOF {
+					r.err = io.ErrUnexpectedEOF
+				}
+				return r.err
+			}
+			continue
+		}
+
 		// Buffer empty; read blocks until we have content.
 		if !r.readFull(r.buf[:4], true) {
 			if r.err == io.EOF {
@@ -785,7 +865,7 @@ func (r *Reader) Skip(n int64) error {
 				if len(r.decoded) < dLen {
 					r.decoded = make([]byte, dLen)
 				}
-				if _, err := Decode(r.decoded, buf); err != nil {
+				if _, err := r.decodeBlock(r.decoded, buf); err != nil {
 					r.err = err
 					return r.err
 				}
@@ -892,6 +972,10 @@ type ReadSeeker struct {
 // The returned ReadSeeker contains a shallow reference to the existing Reader,
 // meaning changes performed to one is reflected in the other.
 func (r *Reader) ReadSeeker(random bool, index []byte) (*ReadSeeker, error) {
+	// Return the input to the current position.
+	if err := r.stopAhead(true); err != nil {
+		return nil, ErrCantSeek{Reason: "stopping read-ahead returned: " + err.Error()}
+	}
 	// Read index if provided.
 	if len(index) != 0 {
 		if r.index == nil {
@@ -993,18 +1077,30 @@ func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
 		return 0, errors.New("seek before start of file")
 	}
 
+	if offset >= r.blockStart && offset < r.blockStart+int64(r.j) && r.err == nil {
+		// Within the current block.
+		r.i = int(offset - r.blockStart)
+		return offset, nil
+	}
+
 	c, u, err := r.index.Find(offset)
 	if err != nil {
 		return r.blockStart + int64(r.i), err
 	}
 
 	// Seek to next block
+	if err := r.stopAhead(false); err != nil {
+		return 0, err
+	}
 	_, err = rs.Seek(c, io.SeekStart)
 	if err != nil {
 		return 0, err
 	}
 
-	r.i = r.j // Remove rest of current block.
+	// Remove rest of current block.
+	// The next block read will start at u.
+	r.blockStart = u
+	r.i, r.j = 0, 0
 	if u < offset {
 		// Forward inside block
 		return offset, r.Skip(offset - u)
@@ -1045,6 +1141,6 @@ func (r *Reader) SkippableCB(id uint8, fn func(r io.Reader) error) error {
 	if id < 0x80 || id > chunkTypePadding {
 		return fmt.Errorf("ReaderSkippableCB: Invalid id provided, must be 0x80-0xfe (inclusive)")
 	}
-	r.skippableCB[id] = fn
+	r.skippableCB[id-0x80] = fn
 	return nil
 }
@@ -0,0 +1,350 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ReaderConcurrency will decode up to n blocks ahead in the background,
+// while decoded data is returned by Read in order.
+// This allows regular Read calls, for example via bufio or io.Copy, to use several cores.
+// At most n decoded blocks are held, including the block being read,
+// so memory use is bounded to n times ReaderMaxBlockSize,
+// in addition to the compressed blocks being decoded.
+// If n <= 0, runtime.GOMAXPROCS(0) is used.
+// Default is 1, meaning blocks are decoded when read.
+//
+// Read-ahead is started on the first Read and stops when the stream ends,
+// when an error occurs or when Reset or Close is called.
+// If a stream is not read to the end, Close or Reset must be called,
+// otherwise the background goroutine and its buffers are kept.
+// Seeking and skipping is supported, but will restart read-ahead.
+// Callbacks for skippable chunks are called from a background goroutine.
+//
+// ReaderConcurrency cannot be combined with ReaderRecover.
+func ReaderConcurrency(n int) ReaderOption {
+	return func(r *Reader) error {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		r.concurrency = n
+		return nil
+	}
+}
+
+// readAhead contains the state of background decoding.
+type readAhead struct {
+	// Decoded blocks in stream order.
+	queue chan chan aheadBlock
+	stop  chan struct{}
+	wg    sync.WaitGroup
+	// Reader used by the producer.
+	// It is a copy of the original Reader and owns the input until stopped.
+	p  *Reader
+	in *countReader
+	// Offset of a chunk that was read, but not queued when stopped, or -1.
+	held int64
+	// Backing buffer of the block returned by the Reader.
+	cur     []byte
+	buffers sync.Pool
+}
+
+// aheadBlock is a decoded block or an error.
+type aheadBlock struct {
+	b []byte
+	// Buffer to return to the pool after use.
+	buf []byte
+	// Input offset of the chunk, relative to where read-ahead started.
+	start int64
+	err   error
+}
+
+// countReader counts bytes read and skipped.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read satisfies the io.Reader interface.
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Seek allows relative seeking if the underlying reader supports it.
+func (c *countReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := c.r.(io.Seeker)
+	if !ok || whence != io.SeekCurrent {
+		return 0, ErrUnsupported
+	}
+	n, err := s.Seek(offset, whence)
+	if err == nil {
+		c.n += offset
+	}
+	return n, err
+}
+
+// getBuf returns a buffer with length n.
+func (a *readAhead) getBuf(n int) []byte {
+	b, _ := a.buffers.Get().([]byte)
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// startAhead will start decoding blocks in the background.
+func (r *Reader) startAhead() {
+	p := *r
+	p.ahead = nil
+	p.err = nil
+	// The block returned by the Reader is the last of the n decoded blocks.
+	queued := r.concurrency - 1
+	if queued < 1 {
+		queued = 1
+	}
+	a := &readAhead{
+		queue: make(chan chan aheadBlock, queued),
+		stop:  make(chan struct{}),
+		p:     &p,
+		in:    &countReader{r: r.r},
+		held:  -1,
+	}
+	p.r = a.in
+	// Own buffer for reading headers.
+	p.buf = make([]byte, 64<<10)
+	a.wg.Add(1)
+	go a.run()
+	r.ahead = a
+}
+
+// run reads chunks from the input and starts decoding data chunks.
+func (a *readAhead) run() {
+	defer a.wg.Done()
+	defer close(a.queue)
+	p := a.p
+
+	// send queues res, unless stopped.
+	send := func(res chan aheadBlock) bool {
+		select {
+		case a.queue <- res:
+			return true
+		case <-a.stop:
+			return false
+		}
+	}
+	// fail sends err as the last result.
+	fail := func(start int64, err error) {
+		res := make(chan aheadBlock, 1)
+		res <- aheadBlock{start: start, err: err}
+		if !send(res) {
+			a.held = start
+		}
+	}
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		default:
+		}
+		start := a.in.n
+		if !p.readFull(p.buf[:4], true) {
+			fail(start, p.err)
+			return
+		}
+		chunkType := p.buf[0]
+		if !p.readHeader {
+			if chunkType != chunkTypeStreamIdentifier {
+				fail(start, ErrCorrupt)
+				return
+			}
+			p.readHeader = true
+		}
+		chunkLen := int(p.buf[1]) | int(p.buf[2])<<8 | int(p.buf[3])<<16
+
+		// The chunk types are specified at
+		// https://github.com/google/snappy/blob/master/framing_format.txt
+		switch chunkType {
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			// Section 4.2. Compressed data (chunk type 0x00).
+			// Section 4.3. Uncompressed data (chunk type 0x01).
+			if chunkLen < checksumSize || chunkLen > p.maxBufSize {
+				fail(start, ErrCorrupt)
+				return
+			}
+			in := a.getBuf(chunkLen)
+			if !p.readFull(in, false) {
+				fail(start, p.err)
+				return
+			}
+			res := make(chan aheadBlock, 1)
+			if !send(res) {
+				a.held = start
+				return
+			}
+			snappyFrame := p.snappyFrame
+			go func() {
+				res <- a.decode(chunkType, in, snappyFrame, start)
+			}()
+			continue
+
+		case chunkTypeStreamIdentifier:
+			// Section 4.1. Stream identifier (chunk type 0xff).
+			if chunkLen != len(magicBody) {
+				fail(start, ErrCorrupt)
+				return
+			}
+			if !p.readFull(p.buf[:len(magicBody)], false) {
+				fail(start, p.err)
+				return
+			}
+			switch string(p.buf[:len(magicBody)]) {
+			case magicBody:
+				p.snappyFrame = false
+			case magicBodySnappy:
+				p.snappyFrame = true
+			default:
+				fail(start, ErrCorrupt)
+				return
+			}
+			continue
+		}
+
+		if chunkType <= 0x7f {
+			// Section 4.5. Reserved unskippable chunks (chunk types 0x02-0x7f).
+			fail(start, ErrUnsupported)
+			return
+		}
+		// Section 4.4 Padding (chunk type 0xfe).
+		// Section 4.6. Reserved skippable chunks (chunk types 0x80-0xfd).
+		if chunkLen > maxChunkSize {
+			fail(start, ErrUnsupported)
+			return
+		}
+		if !p.skippable(p.buf, chunkLen, false, chunkType) {
+			fail(start, p.err)
+			return
+		}
+	}
+}
+
+// decode a data chunk with checksum.
+func (a *readAhead) decode(chunkType uint8, in []byte, snappyFrame bool, start int64) aheadBlock {
+	p := a.p
+	res := aheadBlock{start: start, buf: in}
+	checksum := uint32(in[0]) | uint32(in[1])<<8 | uint32(in[2])<<16 | uint32(in[3])<<24
+	b := in[checksumSize:]
+	if chunkType == chunkTypeCompressedData {
+		n, err := DecodedLen(b)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if n > p.maxBlock || (snappyFrame && n > maxSnappyBlockSize) {
+			res.err = ErrCorrupt
+			return res
+		}
+		dst := a.getBuf(n)
+		if _, err := p.decodeBlock(dst, b); err != nil {
+			a.buffers.Put(dst)
+			res.err = err
+			return res
+		}
+		a.buffers.Put(in)
+		b, res.buf = dst, dst
+	} else if len(b) > p.maxBlock || (snappyFrame && len(b) > maxSnappyBlockSize) {
+		res.err = ErrCorrupt
+		return res
+	}
+	if !p.ignoreCRC && crc(b) != checksum {
+		res.err = ErrCRC
+		return res
+	}
+	res.b = b
+	return res
+}
+
+// nextAhead makes the next block decoded in the background the current block.
+// If false is returned r.err has been set.
+func (r *Reader) nextAhead() bool {
+	if r.ahead == nil {
+		r.startAhead()
+	}
+	a := r.ahead
+	res, ok := <-a.queue
+	if !ok {
+		r.err = errors.New("s2: internal error: read-ahead stopped")
+		return false
+	}
+	block := <-res
+	if block.err != nil {
+		// Stop the producer, if the block could not be decoded.
+		r.stopAhead(false)
+		r.err = block.err
+		return false
+	}
+	if a.cur != nil {
+		a.buffers.Put(a.cur)
+	}
+	a.cur = block.buf
+	r.blockStart += int64(r.j)
+	r.decoded = block.b
+	r.i, r.j = 0, len(block.b)
+	return true
+}
+
+// Close stops decoding in the background started by ReaderConcurrency.
+// Subsequent reads will return ErrReaderClosed until the Reader is Reset.
+// The underlying reader is not closed.
+func (r *Reader) Close() error {
+	r.stopAhead(false)
+	if r.err == nil || r.err == io.EOF {
+		r.err = ErrReaderClosed
+	}
+	return nil
+}
+
+// stopAhead stops decoding in the background.
+// If rewind is set, the input is moved back to after the current block,
+// so reading can continue without read-ahead.
+// This requires the input to be an io.Seeker, unless all blocks read have been consumed.
+func (r *Reader) stopAhead(rewind bool) error {
+	a := r.ahead
+	if a == nil {
+		return nil
+	}
+	r.ahead = nil
+	close(a.stop)
+	a.wg.Wait()
+	r.readHeader = a.p.readHeader
+	r.snappyFrame = a.p.snappyFrame
+
+	// Find the first chunk that wasn't consumed.
+	target := int64(-1)
+	for res := range a.queue {
+		block := <-res
+		if target < 0 {
+			target = block.start
+		}
+	}
+	if target < 0 {
+		target = a.held
+	}
+	if !rewind || target < 0 || target == a.in.n {
+		return nil
+	}
+	s, ok := r.r.(io.Seeker)
+	if !ok {
+		return ErrCantSeek{Reason: "input stream isn't seekable"}
+	}
+	_, err := s.Seek(target-a.in.n, io.SeekCurrent)
+	return err
+}
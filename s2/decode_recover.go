@@ -0,0 +1,245 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLostData is sent to ReaderRecover callbacks when data has been skipped.
+type ErrLostData struct {
+	// Offset and Size of the skipped compressed data.
+	Offset, Size int64
+	// Uncompressed size of the skipped data, if known.
+	// Will be -1 if unknown.
+	Uncompressed int64
+	// Err is the error that caused the data to be skipped.
+	Err error
+}
+
+// Error returns the error as string.
+func (e ErrLostData) Error() string {
+	return fmt.Sprintf("s2: skipped %d bytes at offset %d: %v", e.Size, e.Offset, e.Err)
+}
+
+// Unwrap returns the error that caused the data to be skipped.
+func (e ErrLostData) Unwrap() error {
+	return e.Err
+}
+
+// ReaderRecover will make the reader recover from corrupt input.
+// When a chunk cannot be decoded or fails the CRC check,
+// the input is searched for the next valid chunk and decoding continues from there.
+// A chunk is only considered valid if it is a stream identifier,
+// or a data chunk that decodes and passes the CRC check.
+//
+// For each skipped section fn is called with the uncompressed offset
+// where data is missing from the output and an ErrLostData describing the skipped input.
+// If the end of the input is reached while searching, fn is called and io.EOF is returned.
+//
+// Recovery is only done by Read and ReadByte.
+// Errors from the underlying reader are not recovered.
+// Seeking on the underlying reader is not used when recovery is enabled.
+// Recovery will keep a copy of the current chunk, so it adds a small overhead.
+func ReaderRecover(fn func(off int64, err error)) ReaderOption {
+	return func(r *Reader) error {
+		if fn == nil {
+			return errors.New("s2: nil recover callback")
+		}
+		r.rec = &recoverReader{cb: fn}
+		return nil
+	}
+}
+
+// recoverReader wraps the input and keeps the content of the current chunk,
+// so the input can be searched if the chunk is invalid.
+type recoverReader struct {
+	r  io.Reader
+	cb func(off int64, err error)
+
+	// Compressed offset of next byte returned.
+	off int64
+	// Compressed offset of the current chunk.
+	start int64
+	// Bytes read since start, if recording.
+	hist   []byte
+	record bool
+	// Bytes to return before reading from r.
+	pending []byte
+	// Buffer for decoding candidate chunks.
+	decoded []byte
+}
+
+// reset the reader to read from r.
+func (rr *recoverReader) reset(r io.Reader) {
+	rr.r = r
+	rr.off, rr.start = 0, 0
+	rr.hist = rr.hist[:0]
+	rr.pending = nil
+}
+
+// Read satisfies the io.Reader interface.
+func (rr *recoverReader) Read(p []byte) (n int, err error) {
+	if len(rr.pending) > 0 {
+		n = copy(p, rr.pending)
+		rr.pending = rr.pending[n:]
+	} else {
+		n, err = rr.r.Read(p)
+	}
+	if rr.record {
+		rr.hist = append(rr.hist, p[:n]...)
+	}
+	rr.off += int64(n)
+	return n, err
+}
+
+// mark the start of a chunk.
+func (rr *recoverReader) mark() {
+	rr.hist = rr.hist[:0]
+	rr.start = rr.off
+}
+
+// recoverable returns whether err is caused by invalid input.
+func recoverable(err error) bool {
+	switch err {
+	case ErrCorrupt, ErrCRC, ErrUnsupported, ErrTooLarge:
+		return true
+	}
+	return false
+}
+
+// resync will search for the next valid chunk after an error in the current chunk.
+// out is the uncompressed offset of the current chunk.
+// If a chunk is found, the reader is set up to continue from it and true is returned.
+// Otherwise r.err is set and false is returned.
+func (r *Reader) resync(out int64, cause error) bool {
+	rr := r.rec
+	r.blockStart = out
+	r.i, r.j = 0, 0
+	r.err = nil
+
+	// Search from the byte after the start of the failing chunk.
+	// buf[0] is at compressed offset pos.
+	pos := rr.start
+	buf := make([]byte, 0, len(rr.hist)+len(rr.pending)+64<<10)
+	if len(rr.hist) > 0 {
+		buf = append(buf, rr.hist[1:]...)
+		pos++
+	}
+	buf = append(buf, rr.pending...)
+	rr.pending = nil
+
+	eof := false
+	// fill will read until buf contains at least n bytes.
+	fill := func(n int) bool {
+		for len(buf) < n && !eof && r.err == nil {
+			if cap(buf)-len(buf) < 64<<10 {
+				tmp := make([]byte, len(buf), 2*cap(buf)+n-len(buf))
+				copy(tmp, buf)
+				buf = tmp
+			}
+			got, err := rr.r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+got]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				r.err = err
+			}
+		}
+		return len(buf) >= n
+	}
+
+	for i := 0; ; i++ {
+		if i > 1<<20 && i > len(buf)/2 {
+			// Drop searched data.
+			buf = buf[:copy(buf, buf[i:])]
+			pos += int64(i)
+			i = 0
+		}
+		if !fill(i + chunkHeaderSize) {
+			if r.err != nil {
+				return false
+			}
+			// Reached end of input.
+			rr.off = pos + int64(len(buf))
+			rr.cb(out, ErrLostData{Offset: rr.start, Size: rr.off - rr.start, Uncompressed: -1, Err: cause})
+			r.err = io.EOF
+			return false
+		}
+		chunkType := buf[i]
+		chunkLen := int(buf[i+1]) | int(buf[i+2])<<8 | int(buf[i+3])<<16
+		var ok bool
+		switch chunkType {
+		case chunkTypeStreamIdentifier:
+			ok = chunkLen == len(magicBody) && fill(i+chunkHeaderSize+chunkLen)
+			if ok {
+				body := string(buf[i+chunkHeaderSize : i+chunkHeaderSize+chunkLen])
+				ok = body == magicBody || body == magicBodySnappy
+			}
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			ok = chunkLen >= checksumSize && chunkLen <= r.maxBufSize && fill(i+chunkHeaderSize+chunkLen) &&
+				r.validChunk(buf[i:i+chunkHeaderSize+chunkLen])
+		}
+		if r.err != nil {
+			return false
+		}
+		if !ok {
+			continue
+		}
+
+		// Found a valid chunk.
+		lost := ErrLostData{Offset: rr.start, Size: pos + int64(i) - rr.start, Uncompressed: -1, Err: cause}
+		if len(rr.hist) >= chunkHeaderSize+checksumSize {
+			// If the chunk header was intact, we may know the uncompressed size.
+			badLen := int(rr.hist[1]) | int(rr.hist[2])<<8 | int(rr.hist[3])<<16
+			if int64(chunkHeaderSize+badLen) == lost.Size {
+				switch rr.hist[0] {
+				case chunkTypeCompressedData:
+					if n, err := DecodedLen(rr.hist[chunkHeaderSize+checksumSize:]); err == nil {
+						lost.Uncompressed = int64(n)
+					}
+				case chunkTypeUncompressedData:
+					lost.Uncompressed = int64(badLen - checksumSize)
+				}
+			}
+		}
+		rr.pending = buf[i:]
+		rr.off = pos + int64(i)
+		rr.hist = rr.hist[:0]
+		if chunkType != chunkTypeStreamIdentifier {
+			r.readHeader = true
+		}
+		rr.cb(out, lost)
+		return true
+	}
+}
+
+// validChunk returns whether chunk is a data chunk that decodes
+// and has a valid checksum.
+func (r *Reader) validChunk(chunk []byte) bool {
+	chunkType := chunk[0]
+	chunk = chunk[chunkHeaderSize:]
+	checksum := uint32(chunk[0]) | uint32(chunk[1])<<8 | uint32(chunk[2])<<16 | uint32(chunk[3])<<24
+	chunk = chunk[checksumSize:]
+	decoded := chunk
+	if chunkType == chunkTypeCompressedData {
+		n, err := DecodedLen(chunk)
+		if err != nil || n > r.maxBlock {
+			return false
+		}
+		if cap(r.rec.decoded) < n {
+			r.rec.decoded = make([]byte, n)
+		}
+		decoded, err = r.decodeBlock(r.rec.decoded[:n], chunk)
+		if err != nil {
+			return false
+		}
+	} else if len(decoded) > r.maxBlock {
+		return false
+	}
+	return r.ignoreCRC || crc(decoded) == checksum
+}
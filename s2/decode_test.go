@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"runtime"
 	"strings"
@@ -185,3 +186,272 @@ func TestDecoderMaxBlockSize(t *testing.T) {
 		})
 	}
 }
+
+func TestReaderRecover(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type block struct {
+		uOff, cOff int64
+		uLen, cLen int
+	}
+	var blocks []block
+	var buf bytes.Buffer
+	enc := NewWriter(&buf, WriterBlockSize(minBlockSize), WriterConcurrency(1), WriterBlockCallback(func(uOff, cOff int64, uLen, cLen int) {
+		blocks = append(blocks, block{uOff: uOff, cOff: cOff, uLen: uLen, cLen: cLen})
+	}))
+	if _, err := enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	comp := buf.Bytes()
+	b := blocks[10]
+	garbage := bytes.Repeat([]byte{0x42}, 100)
+
+	tests := []struct {
+		name string
+		// modify returns the modified stream.
+		modify func(b []byte) []byte
+		// Expected output and lost data.
+		want []byte
+		lost []ErrLostData
+		offs []int64
+	}{
+		{
+			name: "crc",
+			modify: func(in []byte) []byte {
+				in[b.cOff+int64(b.cLen)/2]++
+				return in
+			},
+			want: append(append([]byte{}, data[:b.uOff]...), data[b.uOff+int64(b.uLen):]...),
+			lost: []ErrLostData{{Offset: b.cOff, Size: int64(b.cLen), Uncompressed: int64(b.uLen)}},
+			offs: []int64{b.uOff},
+		},
+		{
+			name: "header",
+			modify: func(in []byte) []byte {
+				in[b.cOff] = 0x12
+				return in
+			},
+			want: append(append([]byte{}, data[:b.uOff]...), data[b.uOff+int64(b.uLen):]...),
+			lost: []ErrLostData{{Offset: b.cOff, Size: int64(b.cLen), Uncompressed: -1}},
+			offs: []int64{b.uOff},
+		},
+		{
+			name: "stream-identifier",
+			modify: func(in []byte) []byte {
+				in[0] = 0
+				return in
+			},
+			want: data,
+			lost: []ErrLostData{{Offset: 0, Size: int64(len(magicChunk)), Uncompressed: -1}},
+			offs: []int64{0},
+		},
+		{
+			name: "garbage",
+			modify: func(in []byte) []byte {
+				return append(append(append([]byte{}, in[:b.cOff]...), garbage...), in[b.cOff:]...)
+			},
+			want: data,
+			lost: []ErrLostData{{Offset: b.cOff, Size: int64(len(garbage)), Uncompressed: -1}},
+			offs: []int64{b.uOff},
+		},
+		{
+			name: "truncated",
+			modify: func(in []byte) []byte {
+				return in[:b.cOff+int64(b.cLen)/2]
+			},
+			want: data[:b.uOff],
+			lost: []ErrLostData{{Offset: b.cOff, Size: int64(b.cLen) / 2, Uncompressed: -1}},
+			offs: []int64{b.uOff},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := test.modify(append([]byte{}, comp...))
+			if _, err := io.ReadAll(NewReader(bytes.NewReader(in))); err == nil {
+				t.Fatal("expected error without recovery")
+			}
+			var lost []ErrLostData
+			var offs []int64
+			dec := NewReader(bytes.NewReader(in), ReaderRecover(func(off int64, err error) {
+				offs = append(offs, off)
+				lost = append(lost, err.(ErrLostData))
+			}))
+			got, err := io.ReadAll(dec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Fatalf("output mismatch, got %d bytes, want %d", len(got), len(test.want))
+			}
+			if len(lost) != len(test.lost) {
+				t.Fatalf("got %d lost sections, want %d: %v", len(lost), len(test.lost), lost)
+			}
+			for i := range lost {
+				if lost[i].Err == nil {
+					t.Errorf("lost %d: no cause", i)
+				}
+				lost[i].Err = nil
+				if lost[i] != test.lost[i] {
+					t.Errorf("lost %d: got %+v, want %+v", i, lost[i], test.lost[i])
+				}
+				if offs[i] != test.offs[i] {
+					t.Errorf("lost %d: got offset %d, want %d", i, offs[i], test.offs[i])
+				}
+			}
+		})
+	}
+
+	// Random corruption should always be recovered.
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 200; i++ {
+		in := append([]byte{}, comp...)
+		for j := rng.Intn(10); j >= 0; j-- {
+			in[rng.Intn(len(in))] = byte(rng.Intn(256))
+		}
+		in = in[:len(in)-rng.Intn(len(in)/10)]
+		var lostBytes int64
+		dec := NewReader(bytes.NewReader(in), ReaderRecover(func(off int64, err error) {
+			lostBytes += err.(ErrLostData).Size
+		}))
+		got, err := io.ReadAll(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) > len(data) {
+			t.Fatalf("got %d bytes, want at most %d", len(got), len(data))
+		}
+		if lostBytes > int64(len(in)) {
+			t.Fatalf("lost %d bytes of %d", lostBytes, len(in))
+		}
+	}
+}
+
+func TestReaderConcurrency(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Repeat(data, 3)
+	var buf bytes.Buffer
+	enc := NewWriter(&buf, WriterBlockSize(64<<10), WriterPadding(4<<10), WriterAddIndex())
+	if _, err := enc.Write(data[:len(data)/2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.AddSkippableBlock(0x80, []byte("skippable")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.Write(data[len(data)/2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	for _, n := range []int{2, 4, 16} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			var skipped int
+			dec := NewReader(bytes.NewReader(stream), ReaderConcurrency(n), ReaderSkippableCB(0x80, func(r io.Reader) error {
+				skipped++
+				return nil
+			}))
+			// Small reads.
+			var got []byte
+			tmp := make([]byte, 1000)
+			for {
+				n, err := dec.Read(tmp[:1+len(got)%len(tmp)])
+				got = append(got, tmp[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("mismatch")
+			}
+			if skipped != 1 {
+				t.Fatalf("got %d skippable callbacks, want 1", skipped)
+			}
+
+			// Skip, ReadByte and seeking.
+			dec.Reset(bytes.NewReader(stream))
+			if err := dec.Skip(100000); err != nil {
+				t.Fatal(err)
+			}
+			b, err := dec.ReadByte()
+			if err != nil || b != data[100000] {
+				t.Fatalf("got %v, %v", b, err)
+			}
+			// Input must be restored when switching to seeking.
+			rs, err := dec.ReadSeeker(true, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = make([]byte, 1000)
+			if _, err := io.ReadFull(rs, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data[100001:101001]) {
+				t.Fatal("mismatch after ReadSeeker")
+			}
+			rng := rand.New(rand.NewSource(int64(n)))
+			for i := 0; i < 100; i++ {
+				off := rng.Int63n(int64(len(data) - 1000))
+				if _, err := rs.Seek(off, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.ReadFull(rs, got); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data[off:off+1000]) {
+					t.Fatalf("mismatch at offset %d", off)
+				}
+			}
+
+			// Stop in the middle of the stream.
+			dec.Reset(bytes.NewReader(stream))
+			if _, err := dec.Read(tmp); err != nil {
+				t.Fatal(err)
+			}
+			dec.Reset(nil)
+
+			// Close stops read-ahead.
+			dec.Reset(bytes.NewReader(stream))
+			if _, err := dec.Read(tmp); err != nil {
+				t.Fatal(err)
+			}
+			if a := dec.ahead; a == nil || cap(a.queue) != n-1 {
+				t.Fatalf("read-ahead not started with %d queued blocks", n-1)
+			}
+			if err := dec.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if dec.ahead != nil {
+				t.Fatal("read-ahead not stopped")
+			}
+			if _, err := dec.Read(tmp); err != ErrReaderClosed {
+				t.Fatalf("got %v, want %v", err, ErrReaderClosed)
+			}
+
+			// Corrupt input.
+			corrupt := append([]byte{}, stream...)
+			corrupt[len(corrupt)/2] ^= 0xff
+			dec.Reset(bytes.NewReader(corrupt))
+			if _, err := io.Copy(io.Discard, dec); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	dec := NewReader(nil, ReaderConcurrency(2), ReaderRecover(func(int64, error) {}))
+	if _, err := dec.Read(nil); err == nil {
+		t.Fatal("expected error combining ReaderConcurrency and ReaderRecover")
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+)
+
+const (
+	// MinDictSize is the minimum dictionary size when repeat has been read.
+	MinDictSize = 16
+
+	// MaxDictSize is the maximum dictionary size when repeat has been read.
+	MaxDictSize = 65536
+
+	// MaxDictSrcOffset is the maximum offset where a dictionary entry can start.
+	MaxDictSrcOffset = 65535
+)
+
+// Dict contains a dictionary that can be used for encoding and decoding s2.
+// The dictionary is used as history before the start of each block,
+// so content that is similar to the dictionary can be referenced from the first byte.
+//
+// A Dict is safe for concurrent use.
+type Dict struct {
+	dict   []byte
+	repeat int // Repeat as index of dict
+
+	fast, better, best sync.Once
+	fastTable          *[1 << 14]uint16
+
+	betterTableShort *[1 << 14]uint16
+	betterTableLong  *[1 << 17]uint16
+
+	bestTableShort *[1 << 16]uint16
+	bestTableLong  *[1 << 19]uint16
+}
+
+// NewDict will read a dictionary.
+// It will return nil if the dictionary is invalid.
+// The dictionary is expected to have been created by Dict.Bytes.
+func NewDict(dict []byte) *Dict {
+	if len(dict) == 0 {
+		return nil
+	}
+	var d Dict
+	// Repeat is the first value of the dict
+	r, n := binary.Uvarint(dict)
+	if n <= 0 {
+		return nil
+	}
+	dict = dict[n:]
+	if len(dict) < MinDictSize || len(dict) > MaxDictSize {
+		return nil
+	}
+	if r >= uint64(len(dict)) {
+		return nil
+	}
+	d.dict = dict
+	d.repeat = int(r)
+	return &d
+}
+
+// Bytes will return a serialized version of the dictionary.
+// The output can be sent to NewDict.
+func (d *Dict) Bytes() []byte {
+	dst := make([]byte, binary.MaxVarintLen16+len(d.dict))
+	return append(dst[:binary.PutUvarint(dst, uint64(d.repeat))], d.dict...)
+}
+
+// MakeDict will create a dictionary.
+// 'data' must be at least MinDictSize.
+// If data is longer than MaxDictSize only the last MaxDictSize bytes will be used.
+// If searchStart is set the start repeat value will be set to the last
+// match of this content.
+// If no matches are found, it will attempt to find shorter matches.
+// This content should match the typical start of a block.
+// If at least 4 bytes cannot be matched, repeat is set to start of the dictionary.
+func MakeDict(data []byte, searchStart []byte) *Dict {
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) > MaxDictSize {
+		data = data[len(data)-MaxDictSize:]
+	}
+	if len(data) < MinDictSize {
+		return nil
+	}
+	var d Dict
+	// Keep our own copy, so the caller can reuse data.
+	d.dict = append(make([]byte, 0, len(data)), data...)
+
+	// Find the longest match possible, last entry if multiple.
+	// If a prefix is found, all shorter prefixes will also be found,
+	// so we can do a binary search for the longest.
+	if len(searchStart) < 4 || !bytes.Contains(d.dict, searchStart[:4]) {
+		return &d
+	}
+	lo, hi := 4, len(searchStart)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if bytes.Contains(d.dict, searchStart[:mid]) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	d.repeat = bytes.LastIndex(d.dict, searchStart[:lo])
+	return &d
+}
+
+// EncodeDict returns the encoded form of src using the dictionary as history.
+// The returned slice may be a sub-slice of dst if dst was large enough to hold
+// the entire encoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst.
+//
+// The output can only be decoded using Dict.Decode with the same dictionary.
+// If dict is nil, Encode is used.
+func EncodeDict(dst, src []byte, dict *Dict) []byte {
+	if dict == nil {
+		return Encode(dst, src)
+	}
+	return encodeDict(dst, src, dict, encodeBlockDictGo)
+}
+
+// EncodeBetterDict returns the encoded form of src using the dictionary as history.
+// The returned slice may be a sub-slice of dst if dst was large enough to hold
+// the entire encoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// EncodeBetterDict compresses better than EncodeDict but typically with a
+// 10-40% speed decrease on both compression and decompression.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst.
+//
+// The output can only be decoded using Dict.Decode with the same dictionary.
+// If dict is nil, EncodeBetter is used.
+func EncodeBetterDict(dst, src []byte, dict *Dict) []byte {
+	if dict == nil {
+		return EncodeBetter(dst, src)
+	}
+	return encodeDict(dst, src, dict, encodeBlockBetterDict)
+}
+
+// EncodeBestDict returns the encoded form of src using the dictionary as history.
+// The returned slice may be a sub-slice of dst if dst was large enough to hold
+// the entire encoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// EncodeBestDict compresses as good as reasonably possible but with a
+// big speed decrease.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst.
+//
+// The output can only be decoded using Dict.Decode with the same dictionary.
+// If dict is nil, EncodeBest is used.
+func EncodeBestDict(dst, src []byte, dict *Dict) []byte {
+	if dict == nil {
+		return EncodeBest(dst, src)
+	}
+	return encodeDict(dst, src, dict, encodeBlockBest)
+}
+
+func encodeDict(dst, src []byte, dict *Dict, encodeBlock func(dst, src []byte, dict *Dict) int) []byte {
+	if n := MaxEncodedLen(len(src)); n < 0 {
+		panic(ErrTooLarge)
+	} else if cap(dst) < n {
+		dst = make([]byte, n)
+	} else {
+		dst = dst[:n]
+	}
+
+	// The block starts with the varint-encoded length of the decompressed bytes.
+	d := binary.PutUvarint(dst, uint64(len(src)))
+
+	if len(src) == 0 {
+		return dst[:d]
+	}
+	// With a dictionary even small blocks can be compressed.
+	if len(src) < MinDictSize {
+		d += emitLiteral(dst[d:], src)
+		return dst[:d]
+	}
+	n := encodeBlock(dst[d:], src, dict)
+	if n > 0 {
+		d += n
+		return dst[:d]
+	}
+	// Not compressible
+	d += emitLiteral(dst[d:], src)
+	return dst[:d]
+}
+
+// Decode returns the decoded form of src. The returned slice may be a sub-
+// slice of dst if dst was large enough to hold the entire decoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// The src must have been encoded with the same dictionary.
+// Blocks encoded without a dictionary can also be decoded.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst.
+func (d *Dict) Decode(dst, src []byte) ([]byte, error) {
+	dLen, s, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if dLen <= cap(dst) {
+		dst = dst[:dLen]
+	} else {
+		dst = make([]byte, dLen)
+	}
+	if s2DecodeDict(dst, src[s:], d) != 0 {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
+
+func (d *Dict) initFast() {
+	d.fast.Do(func() {
+		const (
+			tableBits    = 14
+			maxTableSize = 1 << tableBits
+		)
+
+		var table [maxTableSize]uint16
+		// We stop so any entry of length 8 can always be read.
+		for i := 0; i < len(d.dict)-8-2; i += 3 {
+			x0 := load64(d.dict, i)
+			h0 := hash6(x0, tableBits)
+			h1 := hash6(x0>>8, tableBits)
+			h2 := hash6(x0>>16, tableBits)
+			table[h0] = uint16(i)
+			table[h1] = uint16(i + 1)
+			table[h2] = uint16(i + 2)
+		}
+		d.fastTable = &table
+	})
+}
+
+func (d *Dict) initBetter() {
+	d.better.Do(func() {
+		const (
+			// Long hash matches.
+			lTableBits    = 17
+			maxLTableSize = 1 << lTableBits
+
+			// Short hash matches.
+			sTableBits    = 14
+			maxSTableSize = 1 << sTableBits
+		)
+
+		var lTable [maxLTableSize]uint16
+		var sTable [maxSTableSize]uint16
+
+		// We stop so any entry of length 8 can always be read.
+		for i := 0; i < len(d.dict)-8; i++ {
+			cv := load64(d.dict, i)
+			lTable[hash7(cv, lTableBits)] = uint16(i)
+			sTable[hash4(cv, sTableBits)] = uint16(i)
+		}
+		d.betterTableShort = &sTable
+		d.betterTableLong = &lTable
+	})
+}
+
+func (d *Dict) initBest() {
+	d.best.Do(func() {
+		const (
+			// Long hash matches.
+			lTableBits    = 19
+			maxLTableSize = 1 << lTableBits
+
+			// Short hash matches.
+			sTableBits    = 16
+			maxSTableSize = 1 << sTableBits
+		)
+
+		var lTable [maxLTableSize]uint16
+		var sTable [maxSTableSize]uint16
+
+		// We stop so any entry of length 8 can always be read.
+		for i := 0; i < len(d.dict)-8; i++ {
+			cv := load64(d.dict, i)
+			lTable[hash8(cv, lTableBits)] = uint16(i)
+			sTable[hash4(cv, sTableBits)] = uint16(i)
+		}
+		d.bestTableShort = &sTable
+		d.bestTableLong = &lTable
+	})
+}
+
+// matchLen returns how many bytes of src[s:] match the history starting at
+// dictionary position cand.
+// Matches may continue from the end of the dictionary into the start of src.
+func (d *Dict) matchLen(src []byte, s, cand int) int {
+	left := len(d.dict) - cand
+	if left >= len(src)-s {
+		return matchLen(src[s:], d.dict[cand:])
+	}
+	n := matchLen(src[s:s+left], d.dict[cand:])
+	if n < left {
+		return n
+	}
+	// Continue at the start of src.
+	return n + matchLen(src[s+left:], src)
+}
+
+// s2DecodeDict writes the decoding of src to dst using dict as history.
+// It assumes that the varint-encoded length of the decompressed bytes has
+// already been read, and that len(dst) equals that length.
+//
+// It returns 0 on success or a decodeErrCodeXxx error code on failure.
+func s2DecodeDict(dst, src []byte, dict *Dict) int {
+	if dict == nil {
+		return s2Decode(dst, src)
+	}
+	var d, s, length int
+	// The initial repeat offset points to the dictionary repeat.
+	offset := len(dict.dict) - dict.repeat
+
+	for s < len(src) {
+		switch src[s] & 0x03 {
+		case tagLiteral:
+			x := uint32(src[s] >> 2)
+			switch {
+			case x < 60:
+				s++
+			case x == 60:
+				s += 2
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-1])
+			case x == 61:
+				s += 3
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-2]) | uint32(src[s-1])<<8
+			case x == 62:
+				s += 4
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-3]) | uint32(src[s-2])<<8 | uint32(src[s-1])<<16
+			case x == 63:
+				s += 5
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24
+			}
+			length = int(x) + 1
+			if length <= 0 || length > len(dst)-d || length > len(src)-s {
+				return decodeErrCodeCorrupt
+			}
+			copy(dst[d:], src[s:s+length])
+			d += length
+			s += length
+			continue
+
+		case tagCopy1:
+			s += 2
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = int(src[s-2]) >> 2 & 0x7
+			toffset := int(uint32(src[s-2])&0xe0<<3 | uint32(src[s-1]))
+			if toffset == 0 {
+				// keep last offset
+				switch length {
+				case 5:
+					s += 1
+					if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+						return decodeErrCodeCorrupt
+					}
+					length = int(uint32(src[s-1])) + 4
+				case 6:
+					s += 2
+					if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+						return decodeErrCodeCorrupt
+					}
+					length = int(uint32(src[s-2])|(uint32(src[s-1])<<8)) + (1 << 8)
+				case 7:
+					s += 3
+					if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+						return decodeErrCodeCorrupt
+					}
+					length = int(uint32(src[s-3])|(uint32(src[s-2])<<8)|(uint32(src[s-1])<<16)) + (1 << 16)
+				default: // 0-> 4
+				}
+			} else {
+				offset = toffset
+			}
+			length += 4
+		case tagCopy2:
+			s += 3
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = 1 + int(src[s-3])>>2
+			offset = int(uint32(src[s-2]) | uint32(src[s-1])<<8)
+
+		case tagCopy4:
+			s += 5
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = 1 + int(src[s-5])>>2
+			offset = int(uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24)
+		}
+
+		if offset <= 0 || length > len(dst)-d {
+			return decodeErrCodeCorrupt
+		}
+
+		if d < offset {
+			// Copy from the dictionary.
+			dOff := len(dict.dict) - (offset - d)
+			if dOff < 0 {
+				return decodeErrCodeCorrupt
+			}
+			n := copy(dst[d:d+length], dict.dict[dOff:])
+			d += n
+			length -= n
+			if length == 0 {
+				continue
+			}
+			// The remainder continues at the start of dst.
+		}
+
+		// Copy from an earlier sub-slice of dst to a later sub-slice.
+		// If no overlap, use the built-in copy:
+		if offset > length {
+			copy(dst[d:d+length], dst[d-offset:])
+			d += length
+			continue
+		}
+
+		// Unlike the built-in copy function, this byte-by-byte copy always runs
+		// forwards, even if the slices overlap.
+		a := dst[d : d+length]
+		b := dst[d-offset:]
+		b = b[:len(a)]
+		for i := range a {
+			a[i] = b[i]
+		}
+		d += length
+	}
+
+	if d != len(dst) {
+		return decodeErrCodeCorrupt
+	}
+	return 0
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestDictBytes(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog, the quick brown fox")
+	d := MakeDict(data, []byte("brown fox"))
+	if d == nil {
+		t.Fatal("MakeDict returned nil")
+	}
+	if want := bytes.LastIndex(data, []byte("brown fox")); d.repeat != want {
+		t.Errorf("repeat: got %d, want %d", d.repeat, want)
+	}
+	d2 := NewDict(d.Bytes())
+	if d2 == nil {
+		t.Fatal("NewDict returned nil")
+	}
+	if d2.repeat != d.repeat || !bytes.Equal(d2.dict, d.dict) {
+		t.Fatal("dictionary did not survive serialization")
+	}
+	if MakeDict(data[:MinDictSize-1], nil) != nil {
+		t.Error("expected nil for too small dictionary")
+	}
+	if NewDict([]byte{0xff}) != nil {
+		t.Error("expected nil for invalid dictionary")
+	}
+	big := make([]byte, MaxDictSize*2)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	if d := MakeDict(big, nil); d == nil || len(d.dict) != MaxDictSize || !bytes.Equal(d.dict, big[MaxDictSize:]) {
+		t.Error("expected last MaxDictSize bytes to be used")
+	}
+}
+
+func TestDictRoundtrip(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dictionary from the start, payloads from everywhere.
+	dict := MakeDict(data[:MaxDictSize/2], data[MaxDictSize/2:MaxDictSize/2+16])
+	encoders := map[string]func(dst, src []byte, dict *Dict) []byte{
+		"fast":   EncodeDict,
+		"better": EncodeBetterDict,
+		"best":   EncodeBestDict,
+	}
+	rng := rand.New(rand.NewSource(0))
+	for name, enc := range encoders {
+		t.Run(name, func(t *testing.T) {
+			var withDict, without int
+			for i := 0; i < 500; i++ {
+				size := rng.Intn(1000) + 1
+				if i%50 == 0 {
+					size = rng.Intn(200 << 10)
+				}
+				start := rng.Intn(len(data) - size)
+				src := data[start : start+size]
+				if i%7 == 0 {
+					// Take from the dictionary.
+					start = rng.Intn(MaxDictSize/2 - 16)
+					if start+size > len(data) {
+						size = len(data) - start
+					}
+					src = data[start : start+size]
+				}
+				if i%11 == 0 {
+					src = append([]byte{}, src...)
+					rng.Read(src[:len(src)/2])
+				}
+				comp := enc(nil, src, dict)
+				got, err := dict.Decode(nil, comp)
+				if err != nil {
+					t.Fatalf("%d (size %d): %v", i, size, err)
+				}
+				if !bytes.Equal(got, src) {
+					t.Fatalf("%d (size %d): mismatch", i, size)
+				}
+				if len(src) < 2000 {
+					withDict += len(comp)
+					without += len(Encode(nil, src))
+				}
+			}
+			t.Logf("small blocks: %d bytes with dict, %d bytes without", withDict, without)
+			if withDict >= without {
+				t.Errorf("dictionary did not improve compression: %d >= %d", withDict, without)
+			}
+		})
+	}
+}
+
+func TestDictDecodeNoDict(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := MakeDict(data[:1000], nil)
+	for _, comp := range [][]byte{Encode(nil, data), EncodeBetter(nil, data), EncodeBest(nil, data)} {
+		got, err := dict.Decode(nil, comp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("mismatch")
+		}
+	}
+}
+
+func TestDictRepeatStart(t *testing.T) {
+	// The start of each block matches the repeat of the dictionary.
+	dict := MakeDict([]byte("some header data {\"id\":123,\"name\":\"some name\"} more data here"), []byte("{\"id\":"))
+	src := []byte("{\"id\":456,\"name\":\"other name\"} more data here and there")
+	for name, enc := range map[string]func(dst, src []byte, dict *Dict) []byte{"fast": EncodeDict, "better": EncodeBetterDict, "best": EncodeBestDict} {
+		comp := enc(nil, src, dict)
+		got, err := dict.Decode(nil, comp)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if !bytes.Equal(got, src) {
+			t.Fatal(name, "mismatch")
+		}
+		if len(comp) >= len(src) {
+			t.Errorf("%s: no compression, %d >= %d", name, len(comp), len(src))
+		}
+		t.Logf("%s: %d -> %d", name, len(src), len(comp))
+	}
+}
+
+func TestDictStream(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := MakeDict(data[:MaxDictSize], nil)
+	levels := map[string][]WriterOption{
+		"fast":   nil,
+		"better": {WriterBetterCompression()},
+		"best":   {WriterBestCompression()},
+	}
+	for name, opts := range levels {
+		for _, conc := range []int{1, 4} {
+			t.Run(fmt.Sprintf("%s-c%d", name, conc), func(t *testing.T) {
+				var buf bytes.Buffer
+				opts := append([]WriterOption{WriterDict(dict), WriterConcurrency(conc), WriterBlockSize(minBlockSize)}, opts...)
+				enc := NewWriter(&buf, opts...)
+				if _, err := io.Copy(enc, bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				comp := buf.Bytes()
+				dec := NewReader(bytes.NewReader(comp), ReaderDict(dict))
+				got, err := io.ReadAll(dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatal("mismatch")
+				}
+
+				// Concurrent decoding
+				dec = NewReader(bytes.NewReader(comp), ReaderDict(dict))
+				var out bytes.Buffer
+				if _, err := dec.DecodeConcurrent(&out, 4); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out.Bytes(), data) {
+					t.Fatal("concurrent mismatch")
+				}
+
+				// Without dictionary should fail.
+				dec = NewReader(bytes.NewReader(comp))
+				if _, err := io.ReadAll(dec); err == nil {
+					t.Fatal("expected error decoding without dictionary")
+				}
+			})
+		}
+	}
+	enc := NewWriter(io.Discard, WriterDict(dict), WriterSnappyCompat())
+	if _, err := enc.Write(data); err == nil {
+		t.Error("expected error combining dictionary and snappy output")
+	}
+}
@@ -132,7 +132,7 @@ func EncodeBest(dst, src []byte) []byte {
 		d += emitLiteral(dst[d:], src)
 		return dst[:d]
 	}
-	n := encodeBlockBest(dst[d:], src)
+	n := encodeBlockBest(dst[d:], src, nil)
 	if n > 0 {
 		d += n
 		return dst[:d]
@@ -142,6 +142,103 @@ func EncodeBest(dst, src []byte) []byte {
 	return dst[:d]
 }
 
+// bestConcurrentSegment is the size of the segments that EncodeBestConcurrent compresses separately.
+const bestConcurrentSegment = 512 << 10
+
+// EncodeBestConcurrent returns the encoded form of src, like EncodeBest,
+// but using up to n goroutines for compressing a single block.
+// The returned slice may be a sub-slice of dst if dst was large enough to hold the entire encoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// The input is split into 512KB segments that are compressed concurrently.
+// Each segment can reference the last 64KB of the previous segment,
+// so only matches further back across segments are lost.
+// Compression is close to EncodeBest for most content.
+// The output does not depend on n, so it is deterministic.
+// If n <= 0, runtime.GOMAXPROCS(0) is used.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst.
+func EncodeBestConcurrent(dst, src []byte, n int) []byte {
+	if len(src) <= bestConcurrentSegment {
+		return EncodeBest(dst, src)
+	}
+	if n := MaxEncodedLen(len(src)); n < 0 {
+		panic(ErrTooLarge)
+	} else if len(dst) < n {
+		dst = make([]byte, n)
+	}
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	segments := make([][]byte, (len(src)+bestConcurrentSegment-1)/bestConcurrentSegment)
+	if n > len(segments) {
+		n = len(segments)
+	}
+	next := make(chan int, len(segments))
+	for i := range segments {
+		next <- i
+	}
+	close(next)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				segments[i] = encodeBestSegment(src, i*bestConcurrentSegment)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The block starts with the varint-encoded length of the decompressed bytes.
+	d := binary.PutUvarint(dst, uint64(len(src)))
+	total := 0
+	for _, b := range segments {
+		total += len(b)
+	}
+	if total > len(src)-5 {
+		// Not compressible
+		d += emitLiteral(dst[d:], src)
+		return dst[:d]
+	}
+	for _, b := range segments {
+		d += copy(dst[d:], b)
+	}
+	return dst[:d]
+}
+
+// encodeBestSegment will compress the segment of src starting at start,
+// using up to MaxDictSize bytes before it as history.
+// The output is the encoded operations without a block header.
+func encodeBestSegment(src []byte, start int) []byte {
+	end := start + bestConcurrentSegment
+	if end > len(src) {
+		end = len(src)
+	}
+	seg := src[start:end:end]
+	dst := make([]byte, MaxEncodedLen(len(seg)))
+	var n int
+	if start == 0 {
+		n = encodeBlockBest(dst, seg, nil)
+	} else {
+		histStart := start - MaxDictSize
+		if histStart < 0 {
+			histStart = 0
+		}
+		// The repeat offset at the start of the segment depends on the previous segment.
+		// Place it before the history, so it is never used.
+		dict := Dict{dict: src[histStart:start:start], repeat: -len(src)}
+		n = encodeBlockBest(dst, seg, &dict)
+	}
+	if n == 0 {
+		// Not compressible
+		n = emitLiteral(dst, seg)
+	}
+	return dst[:n]
+}
+
 // EncodeSnappy returns the encoded form of src. The returned slice may be a sub-
 // slice of dst if dst was large enough to hold the entire encoded block.
 // Otherwise, a newly allocated slice will be returned.
@@ -377,6 +474,10 @@ func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
 			return &w2
 		}
 	}
+	if w2.snappy && w2.dict != nil {
+		w2.errState = errors.New("s2: dictionaries cannot be used with snappy compatible output")
+		return &w2
+	}
 	w2.obufLen = obufHeaderLen + MaxEncodedLen(w2.blockSize)
 	w2.paramsOK = true
 	w2.ibuf = make([]byte, 0, w2.blockSize)
@@ -408,6 +509,8 @@ type Writer struct {
 	randSrc  io.Reader
 	writerWg sync.WaitGroup
 	index    Index
+	dict     *Dict
+	blockCB  func(uncompressedOff, compressedOff int64, uLen, cLen int)
 
 	// wroteStreamHeader is whether we have written the stream header.
 	wroteStreamHeader bool
@@ -429,6 +532,9 @@ type result struct {
 	b []byte
 	// Uncompressed start offset
 	startOffset int64
+	// Uncompressed length of a data block.
+	// Zero if b is not a data block.
+	blockLen int
 }
 
 // err returns the previously set error.
@@ -497,6 +603,9 @@ func (w *Writer) Reset(writer io.Writer) {
 					}
 					_ = w.err(err)
 					w.err(w.index.add(w.written, input.startOffset))
+					if w.blockCB != nil && input.blockLen > 0 && err == nil {
+						w.blockCB(input.startOffset, w.written, input.blockLen, n)
+					}
 					w.written += int64(n)
 				}
 			}
@@ -611,19 +720,32 @@ func (w *Writer) AddSkippableBlock(id uint8, data []byte) (err error) {
 	if len(data) > maxChunkSize {
 		return fmt.Errorf("skippable block excessed maximum size")
 	}
+	// Write any buffered input first, so the block is placed after it.
+	if len(w.ibuf) > 0 {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
 	var header [4]byte
-	chunkLen := 4 + len(data)
+	chunkLen := len(data)
 	header[0] = id
 	header[1] = uint8(chunkLen >> 0)
 	header[2] = uint8(chunkLen >> 8)
 	header[3] = uint8(chunkLen >> 16)
+	return w.writeRawChunk(header[:], data, 0)
+}
+
+// writeRawChunk writes a chunk with the supplied header and data after any queued output.
+// uLen is the uncompressed size of data chunks and must be 0 for other chunks.
+// Any buffered input must have been flushed.
+func (w *Writer) writeRawChunk(header, data []byte, uLen int) error {
 	if w.concurrency == 1 {
 		write := func(b []byte) error {
 			n, err := w.writer.Write(b)
 			if err = w.err(err); err != nil {
 				return err
 			}
-			if n != len(data) {
+			if n != len(b) {
 				return w.err(io.ErrShortWrite)
 			}
 			w.written += int64(n)
@@ -641,12 +763,25 @@ func (w *Writer) AddSkippableBlock(id uint8, data []byte) (err error) {
 				}
 			}
 		}
-		if err := write(header[:]); err != nil {
+		chunkStart, blockStart := w.written, w.uncompWritten
+		if uLen > 0 {
+			if err := w.err(w.index.add(w.written, w.uncompWritten)); err != nil {
+				return err
+			}
+		}
+		if err := write(header); err != nil {
 			return err
 		}
 		if err := write(data); err != nil {
 			return err
 		}
+		if uLen > 0 {
+			w.uncompWritten += int64(uLen)
+			if w.blockCB != nil {
+				w.blockCB(blockStart, chunkStart, uLen, int(w.written-chunkStart))
+			}
+		}
+		return nil
 	}
 
 	// Create output...
@@ -662,14 +797,15 @@ func (w *Writer) AddSkippableBlock(id uint8, data []byte) (err error) {
 	}
 
 	// Copy input.
-	inbuf := w.buffers.Get().([]byte)[:4]
-	copy(inbuf, header[:])
+	inbuf := w.buffers.Get().([]byte)[:0]
+	inbuf = append(inbuf, header...)
 	inbuf = append(inbuf, data...)
 
 	output := make(chan result, 1)
 	// Queue output.
 	w.output <- output
-	output <- result{startOffset: w.uncompWritten, b: inbuf}
+	output <- result{startOffset: w.uncompWritten, b: inbuf, blockLen: uLen}
+	w.uncompWritten += int64(uLen)
 
 	return nil
 }
@@ -731,6 +867,7 @@ func (w *Writer) EncodeBuffer(buf []byte) (err error) {
 		w.output <- output
 		res := result{
 			startOffset: w.uncompWritten,
+			blockLen:    len(uncompressed),
 		}
 		w.uncompWritten += int64(len(uncompressed))
 		go func() {
@@ -773,6 +910,20 @@ func (w *Writer) EncodeBuffer(buf []byte) (err error) {
 }
 
 func (w *Writer) encodeBlock(obuf, uncompressed []byte) int {
+	if w.dict != nil {
+		if len(uncompressed) < MinDictSize {
+			return 0
+		}
+		switch w.level {
+		case levelFast:
+			return encodeBlockDictGo(obuf, uncompressed, w.dict)
+		case levelBetter:
+			return encodeBlockBetterDict(obuf, uncompressed, w.dict)
+		case levelBest:
+			return encodeBlockBest(obuf, uncompressed, w.dict)
+		}
+		return 0
+	}
 	if w.snappy {
 		switch w.level {
 		case levelFast:
@@ -790,7 +941,7 @@ func (w *Writer) encodeBlock(obuf, uncompressed []byte) int {
 	case levelBetter:
 		return encodeBlockBetter(obuf, uncompressed)
 	case levelBest:
-		return encodeBlockBest(obuf, uncompressed)
+		return encodeBlockBest(obuf, uncompressed, nil)
 	}
 	return 0
 }
@@ -835,6 +986,7 @@ func (w *Writer) write(p []byte) (nRet int, errRet error) {
 		w.output <- output
 		res := result{
 			startOffset: w.uncompWritten,
+			blockLen:    len(uncompressed),
 		}
 		w.uncompWritten += int64(len(uncompressed))
 
@@ -916,6 +1068,7 @@ func (w *Writer) writeFull(inbuf []byte) (errRet error) {
 	w.output <- output
 	res := result{
 		startOffset: w.uncompWritten,
+		blockLen:    len(uncompressed),
 	}
 	w.uncompWritten += int64(len(uncompressed))
 
@@ -1027,6 +1180,7 @@ func (w *Writer) writeSync(p []byte) (nRet int, errRet error) {
 			return 0, w.err(io.ErrShortWrite)
 		}
 		w.err(w.index.add(w.written, w.uncompWritten))
+		chunkStart, blockStart := w.written, w.uncompWritten
 		w.written += int64(n)
 		w.uncompWritten += int64(len(uncompressed))
 
@@ -1041,6 +1195,9 @@ func (w *Writer) writeSync(p []byte) (nRet int, errRet error) {
 			}
 			w.written += int64(n)
 		}
+		if w.blockCB != nil {
+			w.blockCB(blockStart, chunkStart, len(uncompressed), int(w.written-chunkStart))
+		}
 		w.buffers.Put(obuf)
 		// Queue final output.
 		nRet += len(uncompressed)
@@ -1226,6 +1383,22 @@ func WriterAddIndex() WriterOption {
 	}
 }
 
+// WriterBlockCallback will call fn for every data block written to the output.
+// uncompressedOff and compressedOff are the offsets of the block in the uncompressed
+// and the compressed stream. uLen is the uncompressed size of the block and
+// cLen is the size of the block in the compressed stream, including the chunk header.
+//
+// The callback is called in output order, after the block has been written to the output.
+// With concurrency > 1 it is called from a separate goroutine,
+// so it must not call back into the Writer.
+// Stream identifiers, padding, indexes and skippable blocks are not reported.
+func WriterBlockCallback(fn func(uncompressedOff, compressedOff int64, uLen, cLen int)) WriterOption {
+	return func(w *Writer) error {
+		w.blockCB = fn
+		return nil
+	}
+}
+
 // WriterBetterCompression will enable better compression.
 // EncodeBetter compresses better than Encode but typically with a
 // 10-40% speed decrease on both compression and decompression.
@@ -1339,3 +1512,18 @@ func WriterFlushOnWrite() WriterOption {
 		return nil
 	}
 }
+
+// WriterDict will compress all blocks using the supplied dictionary as history.
+// Each block is compressed independently, so concurrency is retained.
+// The stream can only be decompressed by a Reader using ReaderDict
+// with the same dictionary.
+// Dictionaries cannot be combined with WriterSnappyCompat.
+func WriterDict(dict *Dict) WriterOption {
+	return func(w *Writer) error {
+		if dict == nil {
+			return errors.New("s2: nil dictionary")
+		}
+		w.dict = dict
+		return nil
+	}
+}
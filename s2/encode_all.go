@@ -455,3 +455,283 @@ emitRemainder:
 	}
 	return d
 }
+
+// encodeBlockDictGo encodes a non-empty src to a guaranteed-large-enough dst.
+// The dictionary is used as history before the start of src.
+// It assumes that the varint-encoded length of the decompressed bytes has already
+// been written.
+//
+// It also assumes that:
+//
+//	len(dst) >= MaxEncodedLen(len(src)) &&
+//	MinDictSize <= len(src) && len(src) <= maxBlockSize
+func encodeBlockDictGo(dst, src []byte, dict *Dict) (d int) {
+	// Initialize the hash table.
+	const (
+		tableBits    = 14
+		maxTableSize = 1 << tableBits
+
+		debug = false
+	)
+	dict.initFast()
+
+	var table [maxTableSize]uint32
+
+	// sLimit is when to stop looking for offset/length copies. The inputMargin
+	// lets us use a fast path for emitLiteral in the main loop, while we are
+	// looking for copies.
+	sLimit := len(src) - inputMargin
+
+	// Bail if we can't compress to at least this.
+	dstLimit := len(src) - len(src)>>5 - 5
+
+	// nextEmit is where in src the next emitLiteral should start from.
+	nextEmit := 0
+
+	// The dictionary is history, so we can look for matches from the first byte.
+	s := 0
+	cv := load64(src, s)
+
+	// The repeat offset starts at the dictionary repeat position.
+	repeat := len(dict.dict) - dict.repeat
+
+	for {
+		candidate := 0
+		// dictCand is the dictionary position of a match at s, if >= 0.
+		dictCand := -1
+		for {
+			// Next src position to check
+			nextS := s + (s-nextEmit)>>6 + 4
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			hash0 := hash6(cv, tableBits)
+			hash1 := hash6(cv>>8, tableBits)
+			candidate = int(table[hash0])
+			candidate2 := int(table[hash1])
+			table[hash0] = uint32(s)
+			table[hash1] = uint32(s + 1)
+			hash2 := hash6(cv>>16, tableBits)
+
+			// Check repeat at offset checkRep.
+			const checkRep = 1
+			if repPos := s - repeat + checkRep; repPos >= 0 {
+				if uint32(cv>>(checkRep*8)) == load32(src, repPos) {
+					base := s + checkRep
+					// Extend back
+					for i := repPos; base > nextEmit && i > 0 && src[i-1] == src[base-1]; {
+						i--
+						base--
+					}
+					d += emitLiteral(dst[d:], src[nextEmit:base])
+
+					// Extend forward
+					candidate := repPos + 4
+					s += 4 + checkRep
+					for s <= sLimit {
+						if diff := load64(src, s) ^ load64(src, candidate); diff != 0 {
+							s += bits.TrailingZeros64(diff) >> 3
+							break
+						}
+						s += 8
+						candidate += 8
+					}
+					if debug {
+						// Validate match.
+						a := src[base:s]
+						b := src[base-repeat : base-repeat+(s-base)]
+						if !bytes.Equal(a, b) {
+							panic("mismatch")
+						}
+					}
+					// The decoder starts with the dictionary repeat,
+					// so repeats are always valid.
+					d += emitRepeat(dst[d:], repeat, s-base)
+					nextEmit = s
+					if s >= sLimit {
+						goto emitRemainder
+					}
+					cv = load64(src, s)
+					continue
+				}
+			} else if dictPos := len(dict.dict) + repPos; dictPos >= 0 {
+				if length := dict.matchLen(src, s+checkRep, dictPos); length >= 4 {
+					base := s + checkRep
+					// Extend back into the dictionary.
+					for base > nextEmit && dictPos > 0 && dict.dict[dictPos-1] == src[base-1] {
+						dictPos--
+						base--
+						length++
+					}
+					d += emitLiteral(dst[d:], src[nextEmit:base])
+					d += emitRepeat(dst[d:], repeat, length)
+					s = base + length
+					nextEmit = s
+					if s >= sLimit {
+						goto emitRemainder
+					}
+					cv = load64(src, s)
+					continue
+				}
+			}
+
+			// s == 0 will have candidate == 0 from the empty table.
+			if candidate < s && uint32(cv) == load32(src, candidate) {
+				break
+			}
+			candidate = int(table[hash2])
+			if uint32(cv>>8) == load32(src, candidate2) {
+				table[hash2] = uint32(s + 2)
+				candidate = candidate2
+				s++
+				break
+			}
+			table[hash2] = uint32(s + 2)
+			if uint32(cv>>16) == load32(src, candidate) {
+				s += 2
+				break
+			}
+
+			// Check the dictionary.
+			if s < MaxDictSrcOffset {
+				dictCand = int(dict.fastTable[hash0])
+				if uint32(cv) == load32(dict.dict, dictCand) {
+					break
+				}
+				dictCand = int(dict.fastTable[hash1])
+				if uint32(cv>>8) == load32(dict.dict, dictCand) {
+					s++
+					break
+				}
+				dictCand = -1
+			}
+
+			cv = load64(src, nextS)
+			s = nextS
+		}
+
+		if dictCand >= 0 {
+			// Extend backwards into the dictionary.
+			for dictCand > 0 && s > nextEmit && dict.dict[dictCand-1] == src[s-1] {
+				dictCand--
+				s--
+			}
+
+			// Bail if we exceed the maximum size.
+			if d+(s-nextEmit) > dstLimit {
+				return 0
+			}
+
+			d += emitLiteral(dst[d:], src[nextEmit:s])
+			base := s
+			offset := s + len(dict.dict) - dictCand
+			s += dict.matchLen(src, s, dictCand)
+			if offset == repeat {
+				d += emitRepeat(dst[d:], offset, s-base)
+			} else {
+				d += emitCopy(dst[d:], offset, s-base)
+				repeat = offset
+			}
+
+			nextEmit = s
+			if s >= sLimit {
+				goto emitRemainder
+			}
+			if d > dstLimit {
+				// Do we have space for more, if not bail.
+				return 0
+			}
+			x := load64(src, s-2)
+			table[hash6(x, tableBits)] = uint32(s - 2)
+			cv = load64(src, s)
+			continue
+		}
+
+		// Extend backwards.
+		// The top bytes will be rechecked to get the full match.
+		for candidate > 0 && s > nextEmit && src[candidate-1] == src[s-1] {
+			candidate--
+			s--
+		}
+
+		// Bail if we exceed the maximum size.
+		if d+(s-nextEmit) > dstLimit {
+			return 0
+		}
+
+		// A 4-byte match has been found. We'll later see if more than 4 bytes
+		// match. But, prior to the match, src[nextEmit:s] are unmatched. Emit
+		// them as literal bytes.
+
+		d += emitLiteral(dst[d:], src[nextEmit:s])
+
+		// Call emitCopy, and then see if another emitCopy could be our next
+		// move. Repeat until we find no match for the input immediately after
+		// what was consumed by the last emitCopy call.
+		//
+		// If we exit this loop normally then we need to call emitLiteral next,
+		// though we don't yet know how big the literal will be. We handle that
+		// by proceeding to the next iteration of the main loop. We also can
+		// exit this loop via goto if we get close to exhausting the input.
+		for {
+			// Invariant: we have a 4-byte match at s, and no need to emit any
+			// literal bytes prior to s.
+			base := s
+			repeat = base - candidate
+
+			// Extend the 4-byte match as long as possible.
+			s += 4
+			candidate += 4
+			for s <= len(src)-8 {
+				if diff := load64(src, s) ^ load64(src, candidate); diff != 0 {
+					s += bits.TrailingZeros64(diff) >> 3
+					break
+				}
+				s += 8
+				candidate += 8
+			}
+
+			d += emitCopy(dst[d:], repeat, s-base)
+			if debug {
+				// Validate match.
+				a := src[base:s]
+				b := src[base-repeat : base-repeat+(s-base)]
+				if !bytes.Equal(a, b) {
+					panic("mismatch")
+				}
+			}
+
+			nextEmit = s
+			if s >= sLimit {
+				goto emitRemainder
+			}
+
+			if d > dstLimit {
+				// Do we have space for more, if not bail.
+				return 0
+			}
+			// Check for an immediate match, otherwise start search at s+1
+			x := load64(src, s-2)
+			m2Hash := hash6(x, tableBits)
+			currHash := hash6(x>>16, tableBits)
+			candidate = int(table[currHash])
+			table[m2Hash] = uint32(s - 2)
+			table[currHash] = uint32(s)
+			if uint32(x>>16) != load32(src, candidate) {
+				cv = load64(src, s+1)
+				s++
+				break
+			}
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		// Bail if we exceed the maximum size.
+		if d+len(src)-nextEmit > dstLimit {
+			return 0
+		}
+		d += emitLiteral(dst[d:], src[nextEmit:])
+	}
+	return d
+}
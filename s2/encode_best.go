@@ -13,12 +13,13 @@ import (
 // encodeBlockBest encodes a non-empty src to a guaranteed-large-enough dst. It
 // assumes that the varint-encoded length of the decompressed bytes has already
 // been written.
+// If dict is not nil it is used as history before the start of src.
 //
 // It also assumes that:
 //
 //	len(dst) >= MaxEncodedLen(len(src)) &&
 //	minNonLiteralBlockSize <= len(src) && len(src) <= maxBlockSize
-func encodeBlockBest(dst, src []byte) (d int) {
+func encodeBlockBest(dst, src []byte, dict *Dict) (d int) {
 	// Initialize the hash tables.
 	const (
 		// Long hash matches.
@@ -36,7 +37,7 @@ func encodeBlockBest(dst, src []byte) (d int) {
 	// lets us use a fast path for emitLiteral in the main loop, while we are
 	// looking for copies.
 	sLimit := len(src) - inputMargin
-	if len(src) < minNonLiteralBlockSize {
+	if len(src) < minNonLiteralBlockSize && (dict == nil || len(src) < MinDictSize) {
 		return 0
 	}
 
@@ -56,6 +57,15 @@ func encodeBlockBest(dst, src []byte) (d int) {
 
 	// We search for a repeat at -1, but don't output repeats when nextEmit == 0
 	repeat := 1
+	if dict != nil {
+		dict.initBest()
+		// The dictionary is history, so we can look for matches from the first byte.
+		// Offsets below 0 are dictionary positions counted from the end.
+		s = 0
+		cv = load64(src, s)
+		// The repeat offset starts at the dictionary repeat position.
+		repeat = len(dict.dict) - dict.repeat
+	}
 	const lowbitMask = 0xffffffff
 	getCur := func(x uint64) int {
 		return int(x & lowbitMask)
@@ -109,6 +119,22 @@ func encodeBlockBest(dst, src []byte) (d int) {
 					// Don't retest if we have the same offset.
 					return match{offset: offset, s: s}
 				}
+				if offset < 0 || offset >= s {
+					// Only the dictionary can be referenced before the start of src.
+					if dict == nil || offset >= s || len(dict.dict)+offset < 0 {
+						return match{offset: offset, s: s}
+					}
+					m := match{offset: offset, s: s, length: dict.matchLen(src, s, len(dict.dict)+offset), rep: rep}
+					if m.length < 4 {
+						return match{offset: offset, s: s}
+					}
+					m.score = score(m)
+					if m.score <= -m.s {
+						// Eliminate if no savings, we might find a better one.
+						m.length = 0
+					}
+					return m
+				}
 				if load32(src, offset) != first {
 					return match{offset: offset, s: s}
 				}
@@ -149,6 +175,11 @@ func encodeBlockBest(dst, src []byte) (d int) {
 			best = bestOf(matchAt(getCur(candidateL), s, uint32(cv), false), matchAt(getPrev(candidateL), s, uint32(cv), false))
 			best = bestOf(best, matchAt(getCur(candidateS), s, uint32(cv), false))
 			best = bestOf(best, matchAt(getPrev(candidateS), s, uint32(cv), false))
+			if dict != nil && s < MaxDictSrcOffset {
+				// Dictionary positions are stored as negative offsets.
+				best = bestOf(best, matchAt(int(dict.bestTableLong[hashL])-len(dict.dict), s, uint32(cv), false))
+				best = bestOf(best, matchAt(int(dict.bestTableShort[hashS])-len(dict.dict), s, uint32(cv), false))
+			}
 
 			{
 				best = bestOf(best, matchAt(s-repeat+1, s+1, uint32(cv>>8), true))
@@ -233,6 +264,14 @@ func encodeBlockBest(dst, src []byte) (d int) {
 				best.length++
 				s--
 			}
+			if dict != nil {
+				// Continue into the dictionary.
+				for best.offset <= 0 && len(dict.dict)+best.offset > 0 && s > nextEmit && dict.dict[len(dict.dict)+best.offset-1] == src[s-1] {
+					best.offset--
+					best.length++
+					s--
+				}
+			}
 		}
 		if false && best.offset >= s {
 			panic(fmt.Errorf("t %d >= s %d", best.offset, s))
@@ -258,8 +297,9 @@ func encodeBlockBest(dst, src []byte) (d int) {
 		}
 		d += emitLiteral(dst[d:], src[nextEmit:base])
 		if best.rep {
-			if nextEmit > 0 {
+			if nextEmit > 0 || dict != nil {
 				// same as `add := emitCopy(dst[d:], repeat, s-base)` but skips storing offset.
+				// With a dictionary the decoder starts with the dictionary repeat.
 				d += emitRepeat(dst[d:], offset, best.length)
 			} else {
 				// First match, cannot be repeat.
@@ -476,3 +476,243 @@ emitRemainder:
 	}
 	return d
 }
+
+// encodeBlockBetterDict encodes a non-empty src to a guaranteed-large-enough dst.
+// The dictionary is used as history before the start of src.
+// It assumes that the varint-encoded length of the decompressed bytes has already
+// been written.
+//
+// It also assumes that:
+//
+//	len(dst) >= MaxEncodedLen(len(src)) &&
+//	MinDictSize <= len(src) && len(src) <= maxBlockSize
+func encodeBlockBetterDict(dst, src []byte, dict *Dict) (d int) {
+	// sLimit is when to stop looking for offset/length copies. The inputMargin
+	// lets us use a fast path for emitLiteral in the main loop, while we are
+	// looking for copies.
+	sLimit := len(src) - inputMargin
+	if len(src) < MinDictSize {
+		return 0
+	}
+
+	// Initialize the hash tables.
+	const (
+		// Long hash matches.
+		lTableBits    = 17
+		maxLTableSize = 1 << lTableBits
+
+		// Short hash matches.
+		sTableBits    = 14
+		maxSTableSize = 1 << sTableBits
+	)
+	dict.initBetter()
+
+	var lTable [maxLTableSize]uint32
+	var sTable [maxSTableSize]uint32
+
+	// Bail if we can't compress to at least this.
+	dstLimit := len(src) - len(src)>>5 - 6
+
+	// nextEmit is where in src the next emitLiteral should start from.
+	nextEmit := 0
+
+	// The dictionary is history, so we can look for matches from the first byte.
+	s := 0
+	cv := load64(src, s)
+
+	// The repeat offset starts at the dictionary repeat position.
+	repeat := len(dict.dict) - dict.repeat
+
+	for {
+		candidateL := 0
+		// dictCand is the dictionary position of a match at s, if >= 0.
+		dictCand := -1
+		nextS := 0
+		for {
+			// Next src position to check
+			nextS = s + (s-nextEmit)>>7 + 1
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			hashL := hash7(cv, lTableBits)
+			hashS := hash4(cv, sTableBits)
+			candidateL = int(lTable[hashL])
+			candidateS := int(sTable[hashS])
+			lTable[hashL] = uint32(s)
+			sTable[hashS] = uint32(s)
+
+			// s == 0 will have candidates == 0 from the empty tables.
+			if s > 0 {
+				valLong := load64(src, candidateL)
+				valShort := load64(src, candidateS)
+
+				// If long matches at least 8 bytes, use that.
+				if cv == valLong {
+					break
+				}
+				if cv == valShort {
+					candidateL = candidateS
+					break
+				}
+
+				// Long likely matches 7, so take that.
+				if uint32(cv) == uint32(valLong) {
+					break
+				}
+
+				// Check our short candidate
+				if uint32(cv) == uint32(valShort) {
+					// Try a long candidate at s+1
+					hashL = hash7(cv>>8, lTableBits)
+					candidateL = int(lTable[hashL])
+					lTable[hashL] = uint32(s + 1)
+					if uint32(cv>>8) == load32(src, candidateL) {
+						s++
+						break
+					}
+					// Use our short candidate.
+					candidateL = candidateS
+					break
+				}
+			}
+
+			// Check the dictionary.
+			if s < MaxDictSrcOffset {
+				// A repeat reaching into the dictionary.
+				if repPos := len(dict.dict) + s - repeat; repPos >= 0 && repPos < len(dict.dict) {
+					if dict.matchLen(src, s, repPos) >= 4 {
+						dictCand = repPos
+						break
+					}
+				}
+				dictCand = int(dict.betterTableLong[hashL])
+				if uint32(cv) == load32(dict.dict, dictCand) {
+					break
+				}
+				dictCand = int(dict.betterTableShort[hashS])
+				if uint32(cv) == load32(dict.dict, dictCand) {
+					break
+				}
+				dictCand = -1
+			}
+
+			cv = load64(src, nextS)
+			s = nextS
+		}
+
+		var base, offset int
+		if dictCand >= 0 {
+			// Extend backwards into the dictionary.
+			for dictCand > 0 && s > nextEmit && dict.dict[dictCand-1] == src[s-1] {
+				dictCand--
+				s--
+			}
+
+			// Bail if we exceed the maximum size.
+			if d+(s-nextEmit) > dstLimit {
+				return 0
+			}
+
+			base = s
+			offset = s + len(dict.dict) - dictCand
+			s += dict.matchLen(src, s, dictCand)
+		} else {
+			// Extend backwards
+			for candidateL > 0 && s > nextEmit && src[candidateL-1] == src[s-1] {
+				candidateL--
+				s--
+			}
+
+			// Bail if we exceed the maximum size.
+			if d+(s-nextEmit) > dstLimit {
+				return 0
+			}
+
+			base = s
+			offset = base - candidateL
+
+			// Extend the 4-byte match as long as possible.
+			s += 4
+			candidateL += 4
+			for s < len(src) {
+				if len(src)-s < 8 {
+					if src[s] == src[candidateL] {
+						s++
+						candidateL++
+						continue
+					}
+					break
+				}
+				if diff := load64(src, s) ^ load64(src, candidateL); diff != 0 {
+					s += bits.TrailingZeros64(diff) >> 3
+					break
+				}
+				s += 8
+				candidateL += 8
+			}
+		}
+
+		if offset > 65535 && s-base <= 5 && repeat != offset {
+			// Bail if the match is equal or worse to the encoding.
+			s = nextS + 1
+			if s >= sLimit {
+				goto emitRemainder
+			}
+			cv = load64(src, s)
+			continue
+		}
+
+		d += emitLiteral(dst[d:], src[nextEmit:base])
+		// The decoder starts with the dictionary repeat,
+		// so repeats are always valid.
+		if repeat == offset {
+			d += emitRepeat(dst[d:], offset, s-base)
+		} else {
+			d += emitCopy(dst[d:], offset, s-base)
+			repeat = offset
+		}
+
+		nextEmit = s
+		if s >= sLimit {
+			goto emitRemainder
+		}
+
+		if d > dstLimit {
+			// Do we have space for more, if not bail.
+			return 0
+		}
+
+		// Index short & long
+		index0 := base + 1
+		index1 := s - 2
+
+		cv0 := load64(src, index0)
+		cv1 := load64(src, index1)
+		lTable[hash7(cv0, lTableBits)] = uint32(index0)
+		sTable[hash4(cv0>>8, sTableBits)] = uint32(index0 + 1)
+
+		lTable[hash7(cv1, lTableBits)] = uint32(index1)
+		sTable[hash4(cv1>>8, sTableBits)] = uint32(index1 + 1)
+		index0 += 1
+		index1 -= 1
+		cv = load64(src, s)
+
+		// index every second long in between.
+		for index0 < index1 {
+			lTable[hash7(load64(src, index0), lTableBits)] = uint32(index0)
+			lTable[hash7(load64(src, index1), lTableBits)] = uint32(index1)
+			index0 += 2
+			index1 -= 2
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		// Bail if we exceed the maximum size.
+		if d+len(src)-nextEmit > dstLimit {
+			return 0
+		}
+		d += emitLiteral(dst[d:], src[nextEmit:])
+	}
+	return d
+}
@@ -477,6 +477,77 @@ func TestWriterPadding(t *testing.T) {
 	}
 }
 
+func TestWriterBlockCallback(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	src := make([]byte, 300000)
+	for i := range src {
+		src[i] = uint8(rng.Uint32()) & 3
+	}
+	// Add incompressible data for uncompressed blocks.
+	rng.Read(src[100000:150000])
+	for name, opts := range testOptions(t) {
+		t.Run(name, func(t *testing.T) {
+			type block struct {
+				uOff, cOff int64
+				uLen, cLen int
+			}
+			var blocks []block
+			var dst bytes.Buffer
+			opts := append([]WriterOption{WriterBlockSize(minBlockSize), WriterBlockCallback(func(uOff, cOff int64, uLen, cLen int) {
+				blocks = append(blocks, block{uOff: uOff, cOff: cOff, uLen: uLen, cLen: cLen})
+			})}, opts...)
+			e := NewWriter(&dst, opts...)
+			if _, err := e.Write(src[:200000]); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.AddSkippableBlock(0x80, []byte("skippable")); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.EncodeBuffer(src[200000:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			comp := dst.Bytes()
+			var uOff int64
+			for i, b := range blocks {
+				if b.uOff != uOff {
+					t.Fatalf("block %d: want uncompressed offset %d, got %d", i, uOff, b.uOff)
+				}
+				if b.cOff < 0 || b.cOff+int64(b.cLen) > int64(len(comp)) {
+					t.Fatalf("block %d: compressed range %d+%d outside output", i, b.cOff, b.cLen)
+				}
+				chunk := comp[b.cOff : b.cOff+int64(b.cLen)]
+				chunkLen := int(chunk[1]) | int(chunk[2])<<8 | int(chunk[3])<<16
+				if chunkLen+4 != b.cLen {
+					t.Fatalf("block %d: want chunk length %d, got %d", i, chunkLen+4, b.cLen)
+				}
+				var got []byte
+				switch chunk[0] {
+				case chunkTypeCompressedData:
+					var err error
+					got, err = Decode(nil, chunk[8:])
+					if err != nil {
+						t.Fatalf("block %d: %v", i, err)
+					}
+				case chunkTypeUncompressedData:
+					got = chunk[8:]
+				default:
+					t.Fatalf("block %d: unexpected chunk type %x", i, chunk[0])
+				}
+				if !bytes.Equal(got, src[b.uOff:b.uOff+int64(b.uLen)]) {
+					t.Fatalf("block %d: content mismatch", i)
+				}
+				uOff += int64(b.uLen)
+			}
+			if uOff != int64(len(src)) {
+				t.Fatalf("want %d bytes in blocks, got %d", len(src), uOff)
+			}
+		})
+	}
+}
+
 func TestBigRegularWrites(t *testing.T) {
 	var buf [maxBlockSize * 2]byte
 	dst := bytes.NewBuffer(nil)
@@ -607,3 +678,112 @@ func BenchmarkWriterRandom(b *testing.B) {
 		w.Close()
 	}
 }
+
+func TestEncodeBestConcurrent(t *testing.T) {
+	var mixed []byte
+	for _, f := range []string{"html.txt", "Mark.Twain-Tom.Sawyer.txt", "e.txt", "pngdata.bin", "gettysburg.txt", "pi.txt"} {
+		b, err := os.ReadFile("../testdata/" + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mixed = append(mixed, b...)
+	}
+	rng := rand.New(rand.NewSource(0))
+	rnd := make([]byte, 3<<20)
+	rng.Read(rnd)
+	inputs := map[string][]byte{
+		"mixed":  mixed,
+		"small":  mixed[:100000],
+		"edge":   mixed[:bestConcurrentSegment+1],
+		"random": rnd,
+		"zeros":  make([]byte, 3<<20),
+		"part":   append(append([]byte{}, mixed...), rnd[:bestConcurrentSegment+20]...),
+	}
+	for name, src := range inputs {
+		t.Run(name, func(t *testing.T) {
+			want := EncodeBest(nil, src)
+			var first []byte
+			for _, n := range []int{1, 3, 0} {
+				got := EncodeBestConcurrent(nil, src, n)
+				if first == nil {
+					first = got
+				} else if !bytes.Equal(got, first) {
+					t.Fatalf("output with n=%d differs", n)
+				}
+				dec, err := Decode(nil, got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(dec, src) {
+					t.Fatal("mismatch")
+				}
+			}
+			// Allow 1% larger output, and a few bytes for each segment.
+			if len(first) > len(want)+len(want)/100+64 {
+				t.Errorf("concurrent output %d bytes, EncodeBest %d bytes", len(first), len(want))
+			}
+			t.Logf("%d -> best: %d, concurrent: %d", len(src), len(want), len(first))
+		})
+	}
+}
+
+func TestWriterSkippableBlock(t *testing.T) {
+	skip := []byte("skippable data")
+	for _, concurrency := range []int{1, 4} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WriterConcurrency(concurrency))
+		w.Write([]byte("before"))
+		if err := w.AddSkippableBlock(0x80, skip); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("after"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+
+		// The chunk length must not include the header,
+		// and buffered input must be written before the block.
+		var types []uint8
+		for len(b) >= 4 {
+			n := int(b[1]) | int(b[2])<<8 | int(b[3])<<16
+			if len(b) < 4+n {
+				t.Fatalf("concurrency %d: chunk 0x%x: length %d exceeds stream", concurrency, b[0], n)
+			}
+			if b[0] == 0x80 && !bytes.Equal(b[4:4+n], skip) {
+				t.Fatalf("concurrency %d: got skippable content %q, want %q", concurrency, b[4:4+n], skip)
+			}
+			types = append(types, b[0])
+			b = b[4+n:]
+		}
+		want := []uint8{chunkTypeStreamIdentifier, chunkTypeUncompressedData, 0x80, chunkTypeUncompressedData}
+		if len(b) != 0 || !bytes.Equal(types, want) {
+			t.Fatalf("concurrency %d: got chunks %x, want %x", concurrency, types, want)
+		}
+
+		// Callbacks for the lowest ID must not panic.
+		var got []byte
+		r := NewReader(bytes.NewReader(buf.Bytes()))
+		if err := r.SkippableCB(0x80, func(sr io.Reader) (err error) {
+			got, err = io.ReadAll(sr)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dec) != "beforeafter" || !bytes.Equal(got, skip) {
+			t.Fatalf("concurrency %d: got %q and skippable %q", concurrency, dec, got)
+		}
+		got = nil
+		r = NewReader(bytes.NewReader(buf.Bytes()), ReaderSkippableCB(0x80, func(sr io.Reader) (err error) {
+			got, err = io.ReadAll(sr)
+			return err
+		}))
+		if _, err := io.Copy(io.Discard, r); err != nil || !bytes.Equal(got, skip) {
+			t.Fatalf("concurrency %d: got skippable %q, err %v", concurrency, got, err)
+		}
+	}
+}
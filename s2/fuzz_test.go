@@ -128,3 +128,28 @@ func FuzzEncodingBlocks(f *testing.F) {
 		}
 	})
 }
+
+func FuzzDictBlocks(f *testing.F) {
+	f.Add([]byte("the quick brown fox jumps over the lazy dog"), []byte("a lazy fox jumps over the quick brown dog"))
+	f.Add(bytes.Repeat([]byte{0}, 100), bytes.Repeat([]byte{0}, 1000))
+	f.Fuzz(func(t *testing.T, dictData, src []byte) {
+		dict := MakeDict(dictData, src)
+		if dict == nil {
+			return
+		}
+		for _, enc := range []func(dst, src []byte, dict *Dict) []byte{EncodeDict, EncodeBetterDict, EncodeBestDict} {
+			comp := enc(nil, src, dict)
+			got, err := dict.Decode(nil, comp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, src) {
+				t.Fatal("mismatch")
+			}
+		}
+		// Must not crash on arbitrary input.
+		if n, err := DecodedLen(src); err == nil && n < 1<<20 {
+			_, _ = dict.Decode(nil, src)
+		}
+	})
+}
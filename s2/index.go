@@ -19,6 +19,20 @@ const (
 	maxIndexEntries = 1 << 16
 )
 
+// indexFormat describes the chunk type and signatures of an encoded index.
+type indexFormat struct {
+	chunkType       uint8
+	header, trailer string
+	// Entries are merged until they cover at least this many uncompressed units,
+	// unless that would leave fewer than 1000 entries.
+	minEntry int64
+}
+
+var (
+	streamIndex = indexFormat{chunkType: ChunkTypeIndex, header: S2IndexHeader, trailer: S2IndexTrailer, minEntry: 1 << 20}
+	recordIndex = indexFormat{chunkType: ChunkTypeRecordIndex, header: S2RecordIndexHeader, trailer: S2RecordIndexTrailer}
+)
+
 // Index represents an S2/Snappy index.
 type Index struct {
 	TotalUncompressed int64 // Total Uncompressed size if known. Will be -1 if unknown.
@@ -121,8 +135,9 @@ func (i *Index) Find(offset int64) (compressedOff, uncompressedOff int64, err er
 }
 
 // reduce to stay below maxIndexEntries
-func (i *Index) reduce() {
-	if len(i.info) < maxIndexEntries && i.estBlockUncomp >= 1<<20 {
+// and to have entries cover at least minEntry.
+func (i *Index) reduce(minEntry int64) {
+	if len(i.info) < maxIndexEntries && i.estBlockUncomp >= minEntry {
 		return
 	}
 
@@ -132,7 +147,7 @@ func (i *Index) reduce() {
 	j := 0
 
 	// Each block should be at least 1MB, but don't reduce below 1000 entries.
-	for i.estBlockUncomp*(int64(removeN)+1) < 1<<20 && len(i.info)/(removeN+1) > 1000 {
+	for i.estBlockUncomp*(int64(removeN)+1) < minEntry && len(i.info)/(removeN+1) > 1000 {
 		removeN++
 	}
 	for idx := 0; idx < len(src); idx++ {
@@ -146,13 +161,17 @@ func (i *Index) reduce() {
 }
 
 func (i *Index) appendTo(b []byte, uncompTotal, compTotal int64) []byte {
-	i.reduce()
+	return i.appendFormat(b, uncompTotal, compTotal, streamIndex)
+}
+
+func (i *Index) appendFormat(b []byte, uncompTotal, compTotal int64, f indexFormat) []byte {
+	i.reduce(f.minEntry)
 	var tmp [binary.MaxVarintLen64]byte
 
 	initSize := len(b)
 	// We make the start a skippable header+size.
-	b = append(b, ChunkTypeIndex, 0, 0, 0)
-	b = append(b, []byte(S2IndexHeader)...)
+	b = append(b, f.chunkType, 0, 0, 0)
+	b = append(b, []byte(f.header)...)
 	// Total Uncompressed size
 	n := binary.PutVarint(tmp[:], uncompTotal)
 	b = append(b, tmp[:n]...)
@@ -213,10 +232,10 @@ func (i *Index) appendTo(b []byte, uncompTotal, compTotal int64) []byte {
 
 	// Add Total Size.
 	// Stored as fixed size for easier reading.
-	binary.LittleEndian.PutUint32(tmp[:], uint32(len(b)-initSize+4+len(S2IndexTrailer)))
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(b)-initSize+4+len(f.trailer)))
 	b = append(b, tmp[:4]...)
 	// Trailer
-	b = append(b, []byte(S2IndexTrailer)...)
+	b = append(b, []byte(f.trailer)...)
 
 	// Update size
 	chunkLen := len(b) - initSize - skippableFrameHeader
@@ -230,10 +249,14 @@ func (i *Index) appendTo(b []byte, uncompTotal, compTotal int64) []byte {
 // Load a binary index.
 // A zero value Index can be used or a previous one can be reused.
 func (i *Index) Load(b []byte) ([]byte, error) {
-	if len(b) <= 4+len(S2IndexHeader)+len(S2IndexTrailer) {
+	return i.load(b, streamIndex)
+}
+
+func (i *Index) load(b []byte, f indexFormat) ([]byte, error) {
+	if len(b) <= 4+len(f.header)+len(f.trailer) {
 		return b, io.ErrUnexpectedEOF
 	}
-	if b[0] != ChunkTypeIndex {
+	if b[0] != f.chunkType {
 		return b, ErrCorrupt
 	}
 	chunkLen := int(b[1]) | int(b[2])<<8 | int(b[3])<<16
@@ -243,10 +266,10 @@ func (i *Index) Load(b []byte) ([]byte, error) {
 	if len(b) < chunkLen {
 		return b, io.ErrUnexpectedEOF
 	}
-	if !bytes.Equal(b[:len(S2IndexHeader)], []byte(S2IndexHeader)) {
+	if !bytes.Equal(b[:len(f.header)], []byte(f.header)) {
 		return b, ErrUnsupported
 	}
-	b = b[len(S2IndexHeader):]
+	b = b[len(f.header):]
 
 	// Total Uncompressed
 	if v, n := binary.Varint(b); n <= 0 || v < 0 {
@@ -354,17 +377,17 @@ func (i *Index) Load(b []byte) ([]byte, error) {
 		}
 		i.info[idx].compressedOffset = cOff
 	}
-	if len(b) < 4+len(S2IndexTrailer) {
+	if len(b) < 4+len(f.trailer) {
 		return b, io.ErrUnexpectedEOF
 	}
 	// Skip size...
 	b = b[4:]
 
 	// Check trailer...
-	if !bytes.Equal(b[:len(S2IndexTrailer)], []byte(S2IndexTrailer)) {
+	if !bytes.Equal(b[:len(f.trailer)], []byte(f.trailer)) {
 		return b, ErrCorrupt
 	}
-	return b[len(S2IndexTrailer):], nil
+	return b[len(f.trailer):], nil
 }
 
 // LoadStream will load an index from the end of the supplied stream.
@@ -373,6 +396,10 @@ func (i *Index) Load(b []byte) ([]byte, error) {
 // io.ErrUnexpectedEOF is returned if there are too few bytes.
 // IO errors are returned as-is.
 func (i *Index) LoadStream(rs io.ReadSeeker) error {
+	return i.loadStream(rs, streamIndex)
+}
+
+func (i *Index) loadStream(rs io.ReadSeeker, f indexFormat) error {
 	// Go to end.
 	_, err := rs.Seek(-10, io.SeekEnd)
 	if err != nil {
@@ -384,7 +411,7 @@ func (i *Index) LoadStream(rs io.ReadSeeker) error {
 		return err
 	}
 	// Check trailer...
-	if !bytes.Equal(tmp[4:4+len(S2IndexTrailer)], []byte(S2IndexTrailer)) {
+	if !bytes.Equal(tmp[4:4+len(f.trailer)], []byte(f.trailer)) {
 		return ErrUnsupported
 	}
 	sz := binary.LittleEndian.Uint32(tmp[:4])
@@ -402,7 +429,7 @@ func (i *Index) LoadStream(rs io.ReadSeeker) error {
 	if err != nil {
 		return err
 	}
-	_, err = i.Load(buf)
+	_, err = i.load(buf, f)
 	return err
 }
 
@@ -509,6 +536,171 @@ func IndexStream(r io.Reader) ([]byte, error) {
 	}
 }
 
+// ConcatStreams will concatenate the supplied streams and write them to dst.
+// Each source is read from its current position to EOF and must start with a stream identifier.
+// Compressed chunks are copied as is, without being decompressed or validated.
+// Stream identifiers, padding and indexes of the sources are removed,
+// and a single index covering the entire output is written at the end.
+// Other skippable chunks are preserved.
+// The output is a Snappy stream if all sources are Snappy streams,
+// otherwise an S2 stream.
+func ConcatStreams(dst io.Writer, srcs ...io.ReadSeeker) error {
+	// Check stream identifiers.
+	snappy := len(srcs) > 0
+	for _, src := range srcs {
+		var hdr [len(magicChunk)]byte
+		if _, err := io.ReadFull(src, hdr[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch string(hdr[:]) {
+		case magicChunk:
+			snappy = false
+		case magicChunkSnappy:
+		default:
+			return ErrCorrupt
+		}
+		if _, err := src.Seek(-int64(len(hdr)), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+
+	var i Index
+	i.reset(0)
+	i.TotalCompressed, i.TotalUncompressed = 0, 0
+	write := func(b []byte) error {
+		n, err := dst.Write(b)
+		if err == nil && n != len(b) {
+			err = io.ErrShortWrite
+		}
+		i.TotalCompressed += int64(n)
+		return err
+	}
+	if snappy {
+		if err := write([]byte(magicChunkSnappy)); err != nil {
+			return err
+		}
+	} else {
+		if err := write([]byte(magicChunk)); err != nil {
+			return err
+		}
+	}
+
+	// Chunk header, checksum and uncompressed size.
+	var buf [chunkHeaderSize + checksumSize + binary.MaxVarintLen32]byte
+	for _, src := range srcs {
+		for {
+			_, err := io.ReadFull(src, buf[:chunkHeaderSize])
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			chunkType := buf[0]
+			chunkLen := int(buf[1]) | int(buf[2])<<8 | int(buf[3])<<16
+
+			// The chunk types are specified at
+			// https://github.com/google/snappy/blob/master/framing_format.txt
+			switch chunkType {
+			case chunkTypeCompressedData, chunkTypeUncompressedData:
+				if chunkLen < checksumSize {
+					return ErrCorrupt
+				}
+				var dLen int
+				hdr := buf[:chunkHeaderSize+checksumSize]
+				if chunkType == chunkTypeCompressedData {
+					// Section 4.2. Compressed data (chunk type 0x00).
+					if chunkLen < checksumSize+binary.MaxVarintLen32 {
+						hdr = buf[:chunkHeaderSize+chunkLen]
+					} else {
+						hdr = buf[:]
+					}
+					if _, err := io.ReadFull(src, hdr[chunkHeaderSize:]); err != nil {
+						return io.ErrUnexpectedEOF
+					}
+					dLen, err = DecodedLen(hdr[chunkHeaderSize+checksumSize:])
+					if err != nil {
+						return err
+					}
+				} else {
+					// Section 4.3. Uncompressed data (chunk type 0x01).
+					if _, err := io.ReadFull(src, hdr[chunkHeaderSize:]); err != nil {
+						return io.ErrUnexpectedEOF
+					}
+					dLen = chunkLen - checksumSize
+				}
+				if dLen > maxBlockSize {
+					return ErrCorrupt
+				}
+				if i.estBlockUncomp == 0 {
+					// Use first block for estimate...
+					i.estBlockUncomp = int64(dLen)
+				}
+				if err := i.add(i.TotalCompressed, i.TotalUncompressed); err != nil {
+					return err
+				}
+				if err := write(hdr); err != nil {
+					return err
+				}
+				n, err := io.CopyN(dst, src, int64(chunkHeaderSize+chunkLen-len(hdr)))
+				i.TotalCompressed += n
+				if err != nil {
+					if err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					return err
+				}
+				i.TotalUncompressed += int64(dLen)
+				continue
+			case chunkTypeStreamIdentifier:
+				// Section 4.1. Stream identifier (chunk type 0xff).
+				if chunkLen != len(magicBody) {
+					return ErrCorrupt
+				}
+				if _, err := io.ReadFull(src, buf[:chunkLen]); err != nil {
+					return io.ErrUnexpectedEOF
+				}
+				if string(buf[:len(magicBody)]) != magicBody {
+					if string(buf[:len(magicBody)]) != magicBodySnappy {
+						return ErrCorrupt
+					}
+				}
+				continue
+			}
+
+			if chunkType <= 0x7f {
+				// Section 4.5. Reserved unskippable chunks (chunk types 0x02-0x7f).
+				return ErrUnsupported
+			}
+			if chunkType == chunkTypePadding || chunkType == ChunkTypeIndex || chunkType == ChunkTypeRecordIndex {
+				// Section 4.4 Padding (chunk type 0xfe).
+				// Indexes are replaced by the combined index.
+				// Record indexes would no longer be valid.
+				if _, err := src.Seek(int64(chunkLen), io.SeekCurrent); err != nil {
+					return err
+				}
+				continue
+			}
+			// Section 4.6. Reserved skippable chunks (chunk types 0x80-0xfd).
+			if err := write(buf[:chunkHeaderSize]); err != nil {
+				return err
+			}
+			n, err := io.CopyN(dst, src, int64(chunkLen))
+			i.TotalCompressed += n
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+		}
+	}
+	return write(i.appendTo(nil, i.TotalUncompressed, i.TotalCompressed))
+}
+
 // JSON returns the index as JSON text.
 func (i *Index) JSON() []byte {
 	x := struct {
@@ -236,6 +236,51 @@ func TestSeeking(t *testing.T) {
 	}
 }
 
+func TestSeekingCurrent(t *testing.T) {
+	compressed := bytes.Buffer{}
+	enc := s2.NewWriter(&compressed, s2.WriterBlockSize(16<<10))
+	const nElems = 10_000
+	for i := 0; i < nElems; i++ {
+		fmt.Fprintf(enc, "Item %019d\n", i)
+	}
+	index, err := enc.CloseIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := s2.NewReader(io.ReadSeeker(bytes.NewReader(compressed.Bytes())))
+	seeker, err := dec.ReadSeeker(false, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 25)
+	// Include records starting at block boundaries.
+	for _, rec := range []int{9000, 655, 656, 1, 1310, 5000, 5001, 0, nElems - 1} {
+		offset := int64(rec * 25)
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("Failed to seek: %v", err)
+		}
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil || pos != offset {
+			t.Fatalf("record %d: got position %d (%v), want %d", rec, pos, err, offset)
+		}
+		// Read the record twice, seeking back relative to the current position.
+		for i := 0; i < 2; i++ {
+			if _, err := io.ReadFull(dec, buf); err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			expected := fmt.Sprintf("Item %019d\n", rec)
+			if string(buf) != expected {
+				t.Fatalf("Expected %q, got %q", expected, buf)
+			}
+			pos, err := seeker.Seek(-25, io.SeekCurrent)
+			if err != nil || pos != offset {
+				t.Fatalf("record %d: got position %d (%v), want %d", rec, pos, err, offset)
+			}
+		}
+	}
+}
+
 // ExampleIndexStream shows an example of indexing a stream
 // and indexing it after it has been written.
 // The index can either be appended.
@@ -408,3 +453,314 @@ func ExampleIndexStream() {
 	// last 10 bytes read
 	// 10 bytes at offset 10 read
 }
+
+func TestConcatStreams(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	var want []byte
+	var srcs []io.ReadSeeker
+	for i := 0; i < 5; i++ {
+		var data []byte
+		for j := 0; j < 10000+rng.Intn(10000); j++ {
+			data = append(data, fmt.Sprintf("Stream %d Item %019d\n", i, j)...)
+		}
+		want = append(want, data...)
+		opts := []s2.WriterOption{s2.WriterBlockSize(16 << 10), s2.WriterConcurrency(1 + i%2)}
+		switch i {
+		case 1:
+			opts = append(opts, s2.WriterSnappyCompat())
+		case 2:
+			opts = append(opts, s2.WriterAddIndex(), s2.WriterPadding(4<<10))
+		case 3:
+			opts = append(opts, s2.WriterAddIndex())
+		}
+		var buf bytes.Buffer
+		enc := s2.NewWriter(&buf, opts...)
+		if _, err := enc.Write(data[:len(data)/2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.AddSkippableBlock(0x80, []byte("skippable")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := enc.Write(data[len(data)/2:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, bytes.NewReader(buf.Bytes()))
+	}
+
+	var dst bytes.Buffer
+	if err := s2.ConcatStreams(&dst, srcs...); err != nil {
+		t.Fatal(err)
+	}
+	comp := dst.Bytes()
+
+	var skipped int
+	dec := s2.NewReader(bytes.NewReader(comp))
+	if err := dec.SkippableCB(0x80, func(r io.Reader) error {
+		b, err := io.ReadAll(r)
+		if string(b) != "skippable" {
+			t.Errorf("unexpected skippable content %q", b)
+		}
+		skipped++
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("output mismatch")
+	}
+	if skipped != len(srcs) {
+		t.Errorf("want %d skippable blocks, got %d", len(srcs), skipped)
+	}
+
+	var index s2.Index
+	if err := index.LoadStream(bytes.NewReader(comp)); err != nil {
+		t.Fatal(err)
+	}
+	if index.TotalUncompressed != int64(len(want)) {
+		t.Errorf("want uncompressed size %d, got %d", len(want), index.TotalUncompressed)
+	}
+	wantIndex, err := s2.IndexStream(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index2 s2.Index
+	if _, err := index2.Load(wantIndex); err != nil {
+		t.Fatal(err)
+	}
+	// The compressed size does not include the index itself.
+	if comp[index.TotalCompressed] != s2.ChunkTypeIndex {
+		t.Errorf("compressed size %d does not point to the index", index.TotalCompressed)
+	}
+	for i := 0; i < 100; i++ {
+		off := rng.Int63n(int64(len(want)))
+		c1, u1, err1 := index.Find(off)
+		c2, u2, err2 := index2.Find(off)
+		if c1 != c2 || u1 != u2 || err1 != err2 {
+			t.Fatalf("offset %d: got (%d, %d, %v), IndexStream: (%d, %d, %v)", off, c1, u1, err1, c2, u2, err2)
+		}
+	}
+
+	dec = s2.NewReader(bytes.NewReader(comp))
+	rs, err := dec.ReadSeeker(true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		off := rng.Int63n(int64(len(want) - len(buf)))
+		if _, err := rs.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(rs, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, want[off:off+int64(len(buf))]) {
+			t.Fatalf("mismatch at offset %d", off)
+		}
+	}
+
+	// All snappy streams.
+	var a, b bytes.Buffer
+	for _, buf := range []*bytes.Buffer{&a, &b} {
+		enc := s2.NewWriter(buf, s2.WriterSnappyCompat())
+		if _, err := enc.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst.Reset()
+	if err := s2.ConcatStreams(&dst, bytes.NewReader(a.Bytes()), bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(dst.Bytes(), []byte("\xff\x06\x00\x00sNaPpY")) {
+		t.Error("expected snappy stream identifier")
+	}
+	got, err = io.ReadAll(s2.NewReader(bytes.NewReader(dst.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello worldhello world" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// memRWS is an in-memory io.ReadWriteSeeker.
+type memRWS struct {
+	b   []byte
+	off int64
+}
+
+func (m *memRWS) Read(p []byte) (int, error) {
+	if m.off >= int64(len(m.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.b[m.off:])
+	m.off += int64(n)
+	return n, nil
+}
+
+func (m *memRWS) Write(p []byte) (int, error) {
+	if end := m.off + int64(len(p)); end > int64(len(m.b)) {
+		m.b = append(m.b, make([]byte, end-int64(len(m.b)))...)
+	}
+	n := copy(m.b[m.off:], p)
+	m.off += int64(n)
+	return n, nil
+}
+
+func (m *memRWS) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.off
+	case io.SeekEnd:
+		offset += int64(len(m.b))
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	m.off = offset
+	return offset, nil
+}
+
+func TestOpenAppend(t *testing.T) {
+	var parts [][]byte
+	for i := 0; i < 4; i++ {
+		var b []byte
+		for j := 0; j < 20000; j++ {
+			b = append(b, fmt.Sprintf("Part %d Item %019d\n", i, j)...)
+		}
+		parts = append(parts, b)
+	}
+	check := func(t *testing.T, stream []byte, want []byte) {
+		t.Helper()
+		got, err := io.ReadAll(s2.NewReader(bytes.NewReader(stream)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("got %d bytes, want %d", len(got), len(want))
+		}
+		var index s2.Index
+		if err := index.LoadStream(bytes.NewReader(stream)); err != nil {
+			t.Fatal(err)
+		}
+		if index.TotalUncompressed != int64(len(want)) {
+			t.Fatalf("index: got uncompressed size %d, want %d", index.TotalUncompressed, len(want))
+		}
+		ra, err := s2.NewReaderAt(bytes.NewReader(stream), int64(len(stream)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = io.ReadAll(io.NewSectionReader(ra, 0, ra.Size()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("ReaderAt mismatch")
+		}
+	}
+	for _, test := range []struct {
+		name string
+		opts []s2.WriterOption
+		// Initial writer adds an index.
+		index bool
+	}{
+		{name: "default", index: true},
+		{name: "no-index"},
+		{name: "concurrent", opts: []s2.WriterOption{s2.WriterConcurrency(4), s2.WriterBlockSize(16 << 10)}, index: true},
+		{name: "padding", opts: []s2.WriterOption{s2.WriterPadding(1 << 10)}, index: true},
+		{name: "snappy", opts: []s2.WriterOption{s2.WriterSnappyCompat()}, index: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, file := range []bool{false, true} {
+				var mem memRWS
+				var rws io.ReadWriteSeeker = &mem
+				if file {
+					f, err := os.CreateTemp(t.TempDir(), "append")
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer f.Close()
+					rws = f
+				}
+				read := func() []byte {
+					if !file {
+						return mem.b
+					}
+					b, err := os.ReadFile(rws.(*os.File).Name())
+					if err != nil {
+						t.Fatal(err)
+					}
+					return b
+				}
+				opts := test.opts
+				if test.index {
+					opts = append(opts, s2.WriterAddIndex())
+				}
+				enc := s2.NewWriter(rws, opts...)
+				if _, err := enc.Write(parts[0]); err != nil {
+					t.Fatal(err)
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				want := parts[0]
+				for _, part := range parts[1:] {
+					before := len(read())
+					enc, err := s2.OpenAppend(rws, test.opts...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := enc.Write(part); err != nil {
+						t.Fatal(err)
+					}
+					if err := enc.Close(); err != nil {
+						t.Fatal(err)
+					}
+					want = append(want, part...)
+					stream := read()
+					if len(stream) <= before {
+						t.Fatalf("stream did not grow: %d <= %d", len(stream), before)
+					}
+					check(t, stream, want)
+				}
+			}
+		})
+	}
+
+	// Empty input starts a new stream.
+	var mem memRWS
+	enc, err := s2.OpenAppend(&mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.Write(parts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, mem.b, parts[0])
+
+	// Snappy streams require snappy output.
+	mem = memRWS{}
+	enc = s2.NewWriter(&mem, s2.WriterSnappyCompat())
+	if _, err := enc.Write(parts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s2.OpenAppend(&mem); err == nil {
+		t.Fatal("expected error appending S2 blocks to snappy stream")
+	}
+}
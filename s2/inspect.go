@@ -0,0 +1,203 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"fmt"
+	"io"
+)
+
+// StreamInfo contains information about a stream returned by Inspect.
+type StreamInfo struct {
+	// Chunks of the stream in the order they were read.
+	Chunks []ChunkInfo
+
+	// Total compressed and uncompressed size of the stream.
+	Compressed, Uncompressed int64
+
+	// Number of stream identifiers and the number of those that were Snappy.
+	Streams, SnappyStreams int
+
+	// Number of data chunks with invalid content and CRC mismatches.
+	Corrupt, CRCErrors int
+
+	// SnappyCompatible reports whether the stream can be decoded by a Snappy decoder.
+	// This requires Snappy stream identifiers, blocks of at most 64KB
+	// and that no S2 extensions, like repeat offsets, are used.
+	SnappyCompatible bool
+
+	// HasIndex reports whether the stream contains an index.
+	HasIndex bool
+}
+
+// ChunkInfo describes a single chunk of a stream.
+type ChunkInfo struct {
+	// Type is the chunk type.
+	Type uint8
+
+	// Offset of the chunk header in the stream.
+	Offset int64
+
+	// Size of the chunk, excluding the 4 byte chunk header.
+	Size int
+
+	// Uncompressed size of the data in data chunks.
+	Uncompressed int
+
+	// CRCValid reports whether the CRC of a data chunk matches its content.
+	CRCValid bool
+
+	// SnappyIncompatible reports whether a compressed block uses S2 extensions,
+	// like repeat offsets, so it cannot be decoded by a Snappy decoder.
+	SnappyIncompatible bool
+
+	// Err will contain any error decoding a data chunk.
+	Err error
+}
+
+// Ratio returns the uncompressed size divided by the compressed size.
+func (s *StreamInfo) Ratio() float64 {
+	if s.Compressed == 0 {
+		return 0
+	}
+	return float64(s.Uncompressed) / float64(s.Compressed)
+}
+
+// TypeName returns a textual description of the chunk type.
+func (c ChunkInfo) TypeName() string {
+	switch c.Type {
+	case chunkTypeCompressedData:
+		return "compressed"
+	case chunkTypeUncompressedData:
+		return "uncompressed"
+	case chunkTypeStreamIdentifier:
+		return "stream identifier"
+	case chunkTypePadding:
+		return "padding"
+	case ChunkTypeIndex:
+		return "index"
+	case ChunkTypeRecordIndex:
+		return "record index"
+	}
+	if c.Type >= 0x80 {
+		return fmt.Sprintf("skippable 0x%02x", c.Type)
+	}
+	return fmt.Sprintf("reserved 0x%02x", c.Type)
+}
+
+// Inspect reads all chunks of an S2 or Snappy stream and returns information about them.
+// Data chunks are decoded and checked, but unlike a Reader,
+// a corrupt chunk does not stop inspection. Corrupt chunks will have Err set.
+// If the structure of the stream cannot be read, the information
+// gathered so far is returned along with the error.
+func Inspect(r io.Reader) (*StreamInfo, error) {
+	s := StreamInfo{SnappyCompatible: true}
+	var hdr [chunkHeaderSize]byte
+	var buf, dst []byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				if s.Streams == 0 {
+					s.SnappyCompatible = false
+				}
+				return &s, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return &s, err
+		}
+		c := ChunkInfo{
+			Type:   hdr[0],
+			Offset: s.Compressed,
+			Size:   int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16,
+		}
+		if s.Streams == 0 && c.Type != chunkTypeStreamIdentifier {
+			return &s, ErrCorrupt
+		}
+		if c.Type <= 0x7f && c.Type > chunkTypeUncompressedData {
+			// Reserved unskippable chunks.
+			s.Chunks = append(s.Chunks, c)
+			return &s, ErrUnsupported
+		}
+		if cap(buf) < c.Size {
+			buf = make([]byte, c.Size)
+		}
+		buf = buf[:c.Size]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return &s, err
+		}
+		s.Compressed += chunkHeaderSize + int64(c.Size)
+
+		switch c.Type {
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			dst = c.inspectData(buf, dst)
+			if c.Err != nil {
+				s.Corrupt++
+			} else if !c.CRCValid {
+				s.CRCErrors++
+			}
+			if c.SnappyIncompatible || c.Uncompressed > maxSnappyBlockSize {
+				s.SnappyCompatible = false
+			}
+			s.Uncompressed += int64(c.Uncompressed)
+		case chunkTypeStreamIdentifier:
+			s.Streams++
+			switch string(buf) {
+			case magicBodySnappy:
+				s.SnappyStreams++
+			case magicBody:
+				s.SnappyCompatible = false
+			default:
+				s.Chunks = append(s.Chunks, c)
+				return &s, ErrCorrupt
+			}
+		case ChunkTypeIndex:
+			s.HasIndex = true
+		}
+		s.Chunks = append(s.Chunks, c)
+	}
+}
+
+// inspectData decodes and checks the data chunk in b.
+// dst is used as destination buffer and is returned for reuse.
+func (c *ChunkInfo) inspectData(b, dst []byte) []byte {
+	if len(b) < checksumSize {
+		c.Err = ErrCorrupt
+		return dst
+	}
+	checksum := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	b = b[checksumSize:]
+	if c.Type == chunkTypeUncompressedData {
+		c.Uncompressed = len(b)
+		c.CRCValid = crc(b) == checksum
+		return dst
+	}
+	n, err := DecodedLen(b)
+	if err != nil {
+		c.Err = err
+		return dst
+	}
+	if n > maxBlockSize {
+		c.Err = ErrTooLarge
+		return dst
+	}
+	c.Uncompressed = n
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dec, err := Decode(dst[:n], b)
+	if err != nil {
+		c.Err = err
+		return dst
+	}
+	c.CRCValid = crc(dec) == checksum
+	// The block is valid, so only S2 extensions can make it incompatible.
+	c.SnappyIncompatible = !IsSnappyCompatible(b)
+	return dst
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	data = append(data, data...)
+	encode := func(opts ...WriterOption) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddSkippableBlock(0x80, []byte("skip")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, test := range []struct {
+		name   string
+		opts   []WriterOption
+		snappy bool
+		index  bool
+	}{
+		{name: "default", opts: []WriterOption{WriterBlockSize(64 << 10)}},
+		{name: "better", opts: []WriterOption{WriterBetterCompression(), WriterAddIndex(), WriterPadding(1 << 10)}, index: true},
+		{name: "snappy", opts: []WriterOption{WriterSnappyCompat(), WriterBetterCompression()}, snappy: true},
+		{name: "uncompressed", opts: []WriterOption{WriterUncompressed(), WriterSnappyCompat()}, snappy: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := encode(test.opts...)
+			info, err := Inspect(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Compressed != int64(len(b)) || info.Uncompressed != int64(len(data)) {
+				t.Fatalf("got sizes %d -> %d, want %d -> %d", info.Compressed, info.Uncompressed, len(b), len(data))
+			}
+			if info.SnappyCompatible != test.snappy {
+				t.Errorf("got SnappyCompatible %v, want %v", info.SnappyCompatible, test.snappy)
+			}
+			if info.HasIndex != test.index {
+				t.Errorf("got HasIndex %v, want %v", info.HasIndex, test.index)
+			}
+			if info.Streams != 1 || info.Corrupt != 0 || info.CRCErrors != 0 {
+				t.Fatalf("unexpected info: %+v", info)
+			}
+			var types = map[string]int{}
+			for _, c := range info.Chunks {
+				types[c.TypeName()]++
+				if (c.Type == chunkTypeCompressedData || c.Type == chunkTypeUncompressedData) && !c.CRCValid {
+					t.Errorf("chunk at %d: invalid crc", c.Offset)
+				}
+			}
+			if types["skippable 0x80"] != 1 {
+				t.Errorf("skippable chunk not found: %v", types)
+			}
+			t.Logf("%v, ratio %.02f", types, info.Ratio())
+
+			// Corrupt the content of the first data chunk.
+			first := info.Chunks[1]
+			b[first.Offset+chunkHeaderSize+checksumSize+10] ^= 0xff
+			info, err = Inspect(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Corrupt+info.CRCErrors != 1 {
+				t.Fatalf("got %d corrupt, %d crc errors, want one", info.Corrupt, info.CRCErrors)
+			}
+
+			// Truncated stream.
+			_, err = Inspect(bytes.NewReader(b[:len(b)-1]))
+			if err != ErrCorrupt {
+				t.Fatalf("want ErrCorrupt, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInspectSnappyIncompatible(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789 "), 1000)
+	for _, snappy := range []bool{false, true} {
+		var buf bytes.Buffer
+		var w *Writer
+		if snappy {
+			// Blocks are encoded with EncodeSnappy.
+			w = NewWriter(&buf, WriterSnappyCompat())
+		} else {
+			w = NewWriter(&buf)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		info, err := Inspect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks := 0
+		for _, c := range info.Chunks {
+			if c.Type != chunkTypeCompressedData {
+				continue
+			}
+			blocks++
+			if c.SnappyIncompatible == snappy {
+				t.Errorf("snappy %v: chunk at %d: got SnappyIncompatible %v", snappy, c.Offset, c.SnappyIncompatible)
+			}
+		}
+		if blocks != 1 || info.SnappyCompatible != snappy {
+			t.Errorf("snappy %v: got %d blocks, SnappyCompatible %v", snappy, blocks, info.SnappyCompatible)
+		}
+	}
+}
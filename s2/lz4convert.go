@@ -0,0 +1,388 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	lz4FrameMagic       = 0x184D2204
+	lz4LegacyFrameMagic = 0x184C2102
+	// Skippable frames have magic 0x184D2A50 to 0x184D2A5F.
+	lz4SkippableMagic     = 0x184D2A50
+	lz4SkippableMagicMask = 0xFFFFFFF0
+
+	// Legacy frames use fixed 8MB blocks.
+	lz4LegacyBlockSize = 8 << 20
+)
+
+// LZ4Converter provides conversion from LZ4 blocks and frames to S2 or Snappy blocks.
+// LZ4 literals and matches are remapped to S2 operations,
+// so the content is not decompressed and recompressed.
+// Compression will typically be similar to the LZ4 input.
+//
+// A zero value LZ4Converter is ready to use and is safe for concurrent use.
+type LZ4Converter struct {
+}
+
+// ConvertBlock will convert an LZ4 block and append it to dst as an S2 block.
+// The returned slice is the extended dst and the uncompressed size of the block.
+// If dst has enough capacity it will be used, otherwise a new slice is allocated.
+// The LZ4 block must be self-contained; matches cannot reference data before the block.
+func (l *LZ4Converter) ConvertBlock(dst, src []byte) ([]byte, int, error) {
+	return l.convert(dst, src, false, (*lz4Conv).block)
+}
+
+// ConvertBlockSnappy will convert an LZ4 block and append it to dst as a Snappy compatible block.
+// See ConvertBlock for details.
+func (l *LZ4Converter) ConvertBlockSnappy(dst, src []byte) ([]byte, int, error) {
+	return l.convert(dst, src, true, (*lz4Conv).block)
+}
+
+// ConvertFrame will convert LZ4 frames and append them to dst as a single S2 block.
+// src may contain several concatenated frames, including skippable and legacy frames.
+// The returned slice is the extended dst and the uncompressed size of the block.
+//
+// Since the content is not decompressed, header, block and content checksums are not verified.
+// Frames with dependent blocks are supported, but frames using a dictionary are not.
+func (l *LZ4Converter) ConvertFrame(dst, src []byte) ([]byte, int, error) {
+	return l.convert(dst, src, false, (*lz4Conv).frames)
+}
+
+// ConvertFrameSnappy will convert LZ4 frames and append them to dst as a single Snappy compatible block.
+// See ConvertFrame for details.
+func (l *LZ4Converter) ConvertFrameSnappy(dst, src []byte) ([]byte, int, error) {
+	return l.convert(dst, src, true, (*lz4Conv).frames)
+}
+
+// convert will append the block header to dst and convert src with fn.
+func (l *LZ4Converter) convert(dst, src []byte, snappy bool, fn func(c *lz4Conv, src []byte) error) ([]byte, int, error) {
+	// Reserve space for the block header.
+	// We move the block when we know the size.
+	const maxHdr = binary.MaxVarintLen32
+	start := len(dst)
+	c := lz4Conv{snappy: snappy, dst: dst}
+	c.grow(maxHdr + len(src) + len(src)/255 + 16)
+	c.dst = c.dst[:start+maxHdr]
+	if err := fn(&c, src); err != nil {
+		return dst, 0, err
+	}
+	var tmp [maxHdr]byte
+	hdr := binary.PutUvarint(tmp[:], uint64(c.pos))
+	dst = c.dst
+	copy(dst[start:], tmp[:hdr])
+	copy(dst[start+hdr:], dst[start+maxHdr:])
+	return dst[:len(dst)-maxHdr+hdr], int(c.pos), nil
+}
+
+// lz4Conv contains the state of a conversion.
+type lz4Conv struct {
+	dst []byte
+	// Uncompressed position.
+	pos int64
+	// Earliest uncompressed position that can be referenced.
+	minPos     int64
+	lastOffset int
+	snappy     bool
+}
+
+// grow ensures that dst has room for n more bytes.
+func (c *lz4Conv) grow(n int) {
+	if cap(c.dst)-len(c.dst) >= n {
+		return
+	}
+	newCap := 2*cap(c.dst) + n
+	dst := make([]byte, len(c.dst), newCap)
+	copy(dst, c.dst)
+	c.dst = dst
+}
+
+// literal emits lit as a literal.
+func (c *lz4Conv) literal(lit []byte) error {
+	if c.pos+int64(len(lit)) > math.MaxUint32 {
+		return ErrTooLarge
+	}
+	c.grow(len(lit) + 5)
+	d := len(c.dst)
+	d += emitLiteral(c.dst[d:cap(c.dst)], lit)
+	c.dst = c.dst[:d]
+	c.pos += int64(len(lit))
+	return nil
+}
+
+// block converts a single LZ4 block.
+// The block format is specified at
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+func (c *lz4Conv) block(src []byte) error {
+	s := 0
+	matched := false
+	for s < len(src) {
+		token := src[s]
+		s++
+
+		// Literals.
+		ll := int(token >> 4)
+		if ll == 15 {
+			for {
+				if s >= len(src) {
+					return ErrCorrupt
+				}
+				v := src[s]
+				s++
+				ll += int(v)
+				if v != 255 {
+					break
+				}
+			}
+		}
+		if ll > len(src)-s {
+			return ErrCorrupt
+		}
+		if ll > 0 {
+			if err := c.literal(src[s : s+ll]); err != nil {
+				return err
+			}
+			s += ll
+		}
+		if s == len(src) {
+			// Last sequence has no match.
+			// The last 5 bytes must be literals.
+			if matched && ll < 5 {
+				return ErrCorrupt
+			}
+			return nil
+		}
+
+		// Match.
+		if s+2 > len(src) {
+			return ErrCorrupt
+		}
+		offset := int(src[s]) | int(src[s+1])<<8
+		s += 2
+		if offset == 0 || int64(offset) > c.pos-c.minPos {
+			return ErrCorrupt
+		}
+		ml := int(token & 15)
+		if ml == 15 {
+			for {
+				if s >= len(src) {
+					return ErrCorrupt
+				}
+				v := src[s]
+				s++
+				ml += int(v)
+				if v != 255 {
+					break
+				}
+			}
+		}
+		ml += 4
+		if c.pos+int64(ml) > math.MaxUint32 {
+			return ErrTooLarge
+		}
+		c.copy(offset, ml)
+		c.pos += int64(ml)
+		matched = true
+	}
+	if matched {
+		// The last sequence must only contain literals.
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// copy emits a copy with the specified offset and length.
+func (c *lz4Conv) copy(offset, length int) {
+	if c.snappy {
+		// Snappy copies are at most 64 bytes and use 3 bytes.
+		c.grow(3*(length/60) + 6)
+		d := len(c.dst)
+		dst := c.dst[:cap(c.dst)]
+		for length > 64 {
+			d += emitCopyNoRepeat(dst[d:], offset, 60)
+			length -= 60
+		}
+		d += emitCopyNoRepeat(dst[d:], offset, length)
+		c.dst = c.dst[:d]
+		return
+	}
+	// Repeats need 5 bytes for every 16MB.
+	c.grow(10 + 5*(length>>24))
+	d := len(c.dst)
+	dst := c.dst[:cap(c.dst)]
+	switch {
+	case offset == c.lastOffset:
+		d += emitRepeat(dst[d:], offset, length)
+	case length <= 1<<24:
+		d += emitCopy(dst[d:], offset, length)
+	default:
+		d += emitCopy(dst[d:], offset, 64)
+		d += emitRepeat(dst[d:], offset, length-64)
+	}
+	c.lastOffset = offset
+	c.dst = c.dst[:d]
+}
+
+// frames converts LZ4 frames.
+// The frame format is specified at
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+func (c *lz4Conv) frames(src []byte) error {
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return ErrCorrupt
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		src = src[4:]
+		switch {
+		case magic == lz4FrameMagic:
+			var err error
+			src, err = c.frame(src)
+			if err != nil {
+				return err
+			}
+		case magic == lz4LegacyFrameMagic:
+			var err error
+			src, err = c.legacyFrame(src)
+			if err != nil {
+				return err
+			}
+		case magic&lz4SkippableMagicMask == lz4SkippableMagic:
+			if len(src) < 4 {
+				return ErrCorrupt
+			}
+			n := binary.LittleEndian.Uint32(src)
+			src = src[4:]
+			if uint64(n) > uint64(len(src)) {
+				return ErrCorrupt
+			}
+			src = src[n:]
+		default:
+			return ErrUnsupported
+		}
+	}
+	return nil
+}
+
+// frame converts a single frame, excluding the magic number,
+// and returns the remaining input.
+func (c *lz4Conv) frame(src []byte) ([]byte, error) {
+	if len(src) < 3 {
+		return nil, ErrCorrupt
+	}
+	flg, bd := src[0], src[1]
+	if flg>>6 != 1 || flg&2 != 0 || bd&0x8f != 0 {
+		// Unknown version or reserved bits set.
+		return nil, ErrUnsupported
+	}
+	if flg&1 != 0 {
+		// Dictionary ID.
+		return nil, ErrUnsupported
+	}
+	var (
+		indep      = flg&(1<<5) != 0
+		blockCRC   = flg&(1<<4) != 0
+		hasSize    = flg&(1<<3) != 0
+		contentCRC = flg&(1<<2) != 0
+		maxBlock   = 1 << (8 + 2*(bd>>4))
+	)
+	if bd>>4 < 4 {
+		return nil, ErrCorrupt
+	}
+	src = src[2:]
+	contentSize := int64(-1)
+	if hasSize {
+		if len(src) < 8 {
+			return nil, ErrCorrupt
+		}
+		size := binary.LittleEndian.Uint64(src)
+		if size > math.MaxUint32 {
+			return nil, ErrTooLarge
+		}
+		contentSize = int64(size)
+		src = src[8:]
+	}
+	// Skip header checksum.
+	if len(src) < 1 {
+		return nil, ErrCorrupt
+	}
+	src = src[1:]
+
+	frameStart := c.pos
+	for {
+		if len(src) < 4 {
+			return nil, ErrCorrupt
+		}
+		size := binary.LittleEndian.Uint32(src)
+		src = src[4:]
+		if size == 0 {
+			// End mark.
+			break
+		}
+		uncompressed := size&(1<<31) != 0
+		size &= 1<<31 - 1
+		if int(size) > maxBlock || int(size) > len(src) {
+			return nil, ErrCorrupt
+		}
+		block := src[:size]
+		src = src[size:]
+		if blockCRC {
+			if len(src) < 4 {
+				return nil, ErrCorrupt
+			}
+			src = src[4:]
+		}
+		if uncompressed {
+			if err := c.literal(block); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		c.minPos = c.pos
+		if !indep {
+			c.minPos = frameStart
+		}
+		if err := c.block(block); err != nil {
+			return nil, err
+		}
+	}
+	if contentCRC {
+		if len(src) < 4 {
+			return nil, ErrCorrupt
+		}
+		src = src[4:]
+	}
+	if contentSize >= 0 && c.pos-frameStart != contentSize {
+		return nil, ErrCorrupt
+	}
+	return src, nil
+}
+
+// legacyFrame converts a legacy frame, excluding the magic number,
+// and returns the remaining input.
+// Legacy frames have no end mark, so the frame ends at the end of the input
+// or when a block size matches a frame magic number.
+func (c *lz4Conv) legacyFrame(src []byte) ([]byte, error) {
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, ErrCorrupt
+		}
+		size := binary.LittleEndian.Uint32(src)
+		if size == lz4FrameMagic || size == lz4LegacyFrameMagic || size&lz4SkippableMagicMask == lz4SkippableMagic {
+			return src, nil
+		}
+		src = src[4:]
+		if size > lz4LegacyBlockSize || int(size) > len(src) {
+			return nil, ErrCorrupt
+		}
+		c.minPos = c.pos
+		if err := c.block(src[:size]); err != nil {
+			return nil, err
+		}
+		src = src[size:]
+	}
+	return src, nil
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/internal/snapref"
+	"github.com/klauspost/compress/s2"
+)
+
+// lz4Compress is a simple greedy LZ4 block compressor used for testing.
+// Matches may reference hist, which precedes src.
+func lz4Compress(hist, src []byte) []byte {
+	buf := append(hist[:len(hist):len(hist)], src...)
+	table := make(map[uint32]int)
+	for i := 0; i+4 <= len(hist); i++ {
+		table[binary.LittleEndian.Uint32(buf[i:])] = i
+	}
+	var out []byte
+	anchor, s := len(hist), len(hist)
+	for s+12 < len(buf) {
+		v := binary.LittleEndian.Uint32(buf[s:])
+		cand, ok := table[v]
+		table[v] = s
+		if !ok || s-cand > 65535 {
+			s++
+			continue
+		}
+		ml := 4
+		for s+ml < len(buf)-5 && buf[cand+ml] == buf[s+ml] {
+			ml++
+		}
+		out = lz4Sequence(out, buf[anchor:s], s-cand, ml)
+		s += ml
+		anchor = s
+	}
+	return lz4Sequence(out, buf[anchor:], 0, 0)
+}
+
+// lz4Sequence appends a sequence. If ml is 0 only literals are added.
+func lz4Sequence(out, lits []byte, offset, ml int) []byte {
+	token := len(lits)
+	if token > 15 {
+		token = 15
+	}
+	token <<= 4
+	if ml > 0 {
+		if ml-4 >= 15 {
+			token |= 15
+		} else {
+			token |= ml - 4
+		}
+	}
+	out = append(out, byte(token))
+	if len(lits) >= 15 {
+		out = lz4Length(out, len(lits)-15)
+	}
+	out = append(out, lits...)
+	if ml == 0 {
+		return out
+	}
+	out = append(out, byte(offset), byte(offset>>8))
+	if ml-4 >= 15 {
+		out = lz4Length(out, ml-4-15)
+	}
+	return out
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+func lz4Length(out []byte, n int) []byte {
+	for n >= 255 {
+		out = append(out, 255)
+		n -= 255
+	}
+	return append(out, byte(n))
+}
+
+// lz4Frame creates a frame with blocks of blockSize.
+// If indep is false, blocks may reference previous blocks.
+func lz4Frame(src []byte, blockSize int, indep bool) []byte {
+	out := appendUint32(nil, 0x184D2204)
+	// Version 1, block checksums, content size and content checksum.
+	flg := byte(1<<6 | 1<<4 | 1<<3 | 1<<2)
+	if indep {
+		flg |= 1 << 5
+	}
+	// 4MB blocks.
+	out = append(out, flg, 7<<4)
+	out = appendUint32(appendUint32(out, uint32(len(src))), 0)
+	// Header checksum, not verified.
+	out = append(out, 0)
+	for i := 0; i < len(src); i += blockSize {
+		end := i + blockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		var hist []byte
+		if !indep {
+			hist = src[:i]
+		}
+		block := lz4Compress(hist, src[i:end])
+		size := uint32(len(block))
+		if len(block) >= end-i {
+			// Store uncompressed.
+			block = src[i:end]
+			size = uint32(len(block)) | 1<<31
+		}
+		out = appendUint32(out, size)
+		out = append(out, block...)
+		// Block checksum, not verified.
+		out = append(out, 1, 2, 3, 4)
+	}
+	// End mark and content checksum.
+	return append(out, 0, 0, 0, 0, 1, 2, 3, 4)
+}
+
+func TestLZ4ConverterBlock(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(0))
+	rnd := make([]byte, 10000)
+	rng.Read(rnd)
+	inputs := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("hello"),
+		"text":   data,
+		"random": rnd,
+		"zeros":  make([]byte, 100000),
+		"mixed":  append(append(append([]byte{}, rnd...), data[:50000]...), rnd...),
+	}
+	if !testing.Short() {
+		// Matches longer than a single copy.
+		inputs["long"] = make([]byte, 17<<20)
+	}
+	var conv s2.LZ4Converter
+	for name, src := range inputs {
+		lz4 := lz4Compress(nil, src)
+		for _, snappy := range []bool{false, true} {
+			fn, dec := conv.ConvertBlock, s2.Decode
+			if snappy {
+				fn, dec = conv.ConvertBlockSnappy, snapref.Decode
+			}
+			prefix := []byte("prefix")
+			out, n, err := fn(prefix, lz4)
+			if err != nil {
+				t.Fatalf("%s (snappy: %v): %v", name, snappy, err)
+			}
+			if n != len(src) {
+				t.Fatalf("%s (snappy: %v): got size %d, want %d", name, snappy, n, len(src))
+			}
+			if !bytes.HasPrefix(out, prefix) {
+				t.Fatalf("%s (snappy: %v): dst not preserved", name, snappy)
+			}
+			out = out[len(prefix):]
+			got, err := dec(nil, out)
+			if err != nil {
+				t.Fatalf("%s (snappy: %v): %v", name, snappy, err)
+			}
+			if !bytes.Equal(got, src) {
+				t.Fatalf("%s (snappy: %v): mismatch", name, snappy)
+			}
+			t.Logf("%s (snappy: %v): %d -> lz4: %d -> %d", name, snappy, len(src), len(lz4), len(out))
+		}
+	}
+}
+
+func TestLZ4ConverterFrame(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conv s2.LZ4Converter
+	for _, indep := range []bool{true, false} {
+		// Two frames and a skippable frame.
+		frames := lz4Frame(data[:100000], 16<<10, indep)
+		frames = appendUint32(frames, 0x184D2A53)
+		frames = appendUint32(frames, 3)
+		frames = append(frames, 1, 2, 3)
+		frames = append(frames, lz4Frame(data[100000:], 64<<10, indep)...)
+		for _, snappy := range []bool{false, true} {
+			fn := conv.ConvertFrame
+			if snappy {
+				fn = conv.ConvertFrameSnappy
+			}
+			out, n, err := fn(nil, frames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(data) {
+				t.Fatalf("got size %d, want %d", n, len(data))
+			}
+			dec := s2.Decode
+			if snappy {
+				dec = snapref.Decode
+			}
+			got, err := dec(nil, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("mismatch")
+			}
+			t.Logf("indep: %v, snappy: %v: %d -> lz4: %d -> %d", indep, snappy, len(data), len(frames), len(out))
+		}
+	}
+
+	// Legacy frame.
+	legacy := appendUint32(nil, 0x184C2102)
+	for _, part := range [][]byte{data[:200000], data[200000:]} {
+		block := lz4Compress(nil, part)
+		legacy = appendUint32(legacy, uint32(len(block)))
+		legacy = append(legacy, block...)
+	}
+	legacy = append(legacy, lz4Frame([]byte("hello world"), 64<<10, true)...)
+	out, _, err := conv.ConvertFrame(nil, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s2.Decode(nil, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte{}, data...), "hello world"...); !bytes.Equal(got, want) {
+		t.Fatal("legacy mismatch")
+	}
+}
+
+func TestLZ4ConverterCorrupt(t *testing.T) {
+	var conv s2.LZ4Converter
+	// Offset before start of block.
+	if _, _, err := conv.ConvertBlock(nil, lz4Sequence(nil, []byte("abc"), 4, 4)); err != s2.ErrCorrupt {
+		t.Errorf("want ErrCorrupt, got %v", err)
+	}
+	// Missing offset.
+	if _, _, err := conv.ConvertBlock(nil, []byte{0x10, 'a', 1}); err != s2.ErrCorrupt {
+		t.Errorf("want ErrCorrupt, got %v", err)
+	}
+	// Last sequence ends with a match.
+	if _, _, err := conv.ConvertBlock(nil, lz4Sequence(nil, []byte("abcd"), 4, 8)); err != s2.ErrCorrupt {
+		t.Errorf("want ErrCorrupt, got %v", err)
+	}
+	// Less than 5 literals after the last match.
+	block := lz4Sequence(nil, []byte("abcd"), 4, 8)
+	block = lz4Sequence(block, []byte("efgh"), 0, 0)
+	if _, _, err := conv.ConvertBlock(nil, block); err != s2.ErrCorrupt {
+		t.Errorf("want ErrCorrupt, got %v", err)
+	}
+	block = lz4Sequence(block[:len(block)-5], []byte("efghi"), 0, 0)
+	if _, _, err := conv.ConvertBlock(nil, block); err != nil {
+		t.Errorf("valid block: %v", err)
+	}
+	// Independent blocks cannot reference previous blocks.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	frame := lz4Frame(data, 1024, false)
+	frame[4] |= 1 << 5
+	if _, _, err := conv.ConvertFrame(nil, frame); err != s2.ErrCorrupt {
+		t.Errorf("want ErrCorrupt, got %v", err)
+	}
+	// Unknown magic.
+	if _, _, err := conv.ConvertFrame(nil, []byte{1, 2, 3, 4}); err != s2.ErrUnsupported {
+		t.Errorf("want ErrUnsupported, got %v", err)
+	}
+
+	// Random corruption must not crash.
+	valid := lz4Compress(nil, data)
+	validFrame := lz4Frame(data, 4096, false)
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 10000; i++ {
+		for _, src := range [][]byte{valid, validFrame} {
+			b := append([]byte{}, src[:rng.Intn(len(src))]...)
+			for j := rng.Intn(5); j >= 0 && len(b) > 0; j-- {
+				b[rng.Intn(len(b))] = byte(rng.Intn(256))
+			}
+			out, n, err := conv.ConvertFrame(nil, b)
+			if err == nil {
+				if got, err := s2.Decode(nil, out); err != nil || len(got) != n {
+					t.Fatalf("converted output did not decode: %v", err)
+				}
+			}
+			out, n, err = conv.ConvertBlockSnappy(nil, b)
+			if err == nil {
+				if got, err := s2.Decode(nil, out); err != nil || len(got) != n {
+					t.Fatalf("converted output did not decode: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ReaderAt provides random access to an indexed S2 or Snappy stream.
+// It implements io.ReaderAt and is safe for concurrent use.
+// Only the blocks that are needed to satisfy a read are decoded.
+type ReaderAt struct {
+	ra    io.ReaderAt
+	size  int64
+	index Index
+
+	maxBlock  int
+	ignoreCRC bool
+	dict      *Dict
+
+	// buffers contains buffers for reading compressed chunks.
+	buffers sync.Pool
+	cache   *blockCache
+}
+
+// readerAtBlock is a decoded block.
+type readerAtBlock struct {
+	// Uncompressed offset of the first byte in the block.
+	uOff int64
+	// Compressed offset of the chunk following this block.
+	nextC int64
+	data  []byte
+}
+
+// NewReaderAt returns a ReaderAt that reads the compressed stream of size bytes from ra.
+// The index must have been generated for the stream, for example by Writer.CloseIndex or IndexStream.
+// If index is empty, the index is read from the end of the stream.
+//
+// ReaderMaxBlockSize, ReaderIgnoreCRC, ReaderDict and ReaderCacheBlocks
+// options are used. Other options are ignored.
+func NewReaderAt(ra io.ReaderAt, size int64, index []byte, opts ...ReaderOption) (*ReaderAt, error) {
+	cfg := Reader{maxBlock: maxBlockSize}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	r := ReaderAt{
+		ra:        ra,
+		size:      size,
+		maxBlock:  cfg.maxBlock,
+		ignoreCRC: cfg.ignoreCRC,
+		dict:      cfg.dict,
+	}
+	if len(index) > 0 {
+		if _, err := r.index.Load(index); err != nil {
+			return nil, ErrCantSeek{Reason: "loading index returned: " + err.Error()}
+		}
+	} else {
+		err := r.index.LoadStream(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			if err == ErrUnsupported {
+				return nil, ErrCantSeek{Reason: "input stream does not contain an index"}
+			}
+			return nil, ErrCantSeek{Reason: "reading index returned: " + err.Error()}
+		}
+	}
+	if r.index.TotalUncompressed < 0 {
+		return nil, ErrCantSeek{Reason: "index does not contain uncompressed size"}
+	}
+	if cfg.cacheBlocks > 0 {
+		r.cache = &blockCache{max: cfg.cacheBlocks}
+	}
+	maxBuf := MaxEncodedLen(r.maxBlock) + chunkHeaderSize + checksumSize
+	r.buffers.New = func() interface{} {
+		return make([]byte, maxBuf)
+	}
+	return &r, nil
+}
+
+// ReaderCacheBlocks will keep up to n decoded blocks in memory.
+// This is only used by ReaderAt. By default, no blocks are cached.
+// The cache will use up to n * the stream block size of memory.
+func ReaderCacheBlocks(n int) ReaderOption {
+	return func(r *Reader) error {
+		if n < 0 {
+			return errors.New("s2: cache size must be >= 0")
+		}
+		r.cacheBlocks = n
+		return nil
+	}
+}
+
+// Size returns the uncompressed size of the stream.
+func (r *ReaderAt) Size() int64 {
+	return r.index.TotalUncompressed
+}
+
+// ReadAt reads len(p) uncompressed bytes into p starting at offset off.
+// See io.ReaderAt for the semantics.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("s2: negative offset")
+	}
+	// Compressed and uncompressed offset of the next chunk, if known.
+	nextC, nextU := int64(-1), int64(-1)
+	for len(p) > 0 {
+		if off >= r.index.TotalUncompressed {
+			return n, io.EOF
+		}
+		var blk *readerAtBlock
+		if nextU == off {
+			blk, err = r.block(off, nextC, nextU)
+		} else {
+			blk, err = r.block(off, -1, -1)
+		}
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p, blk.data[off-blk.uOff:])
+		n += copied
+		p = p[copied:]
+		off += int64(copied)
+		nextC, nextU = blk.nextC, blk.uOff+int64(len(blk.data))
+	}
+	return n, nil
+}
+
+// block returns the decoded block containing uncompressed offset off.
+// If cOff is >= 0, it must be the compressed offset of a chunk starting at uncompressed offset uOff.
+func (r *ReaderAt) block(off, cOff, uOff int64) (*readerAtBlock, error) {
+	if blk := r.cache.get(off); blk != nil {
+		return blk, nil
+	}
+	if cOff < 0 {
+		var err error
+		cOff, uOff, err = r.index.Find(off)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf := r.buffers.Get().([]byte)
+	defer r.buffers.Put(buf)
+
+	for {
+		if cOff >= r.size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		// Read chunk header, checksum and the uncompressed size of compressed blocks.
+		hdr := buf[:chunkHeaderSize+checksumSize+5]
+		n, err := r.ra.ReadAt(hdr, cOff)
+		if n < chunkHeaderSize {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		chunkType := hdr[0]
+		chunkLen := int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16
+		if n > chunkHeaderSize+chunkLen {
+			n = chunkHeaderSize + chunkLen
+		}
+		hdr = hdr[:n]
+		nextC := cOff + chunkHeaderSize + int64(chunkLen)
+
+		// The chunk types are specified at
+		// https://github.com/google/snappy/blob/master/framing_format.txt
+		var dLen int
+		switch chunkType {
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			if chunkLen < checksumSize || len(hdr) < chunkHeaderSize+checksumSize {
+				return nil, ErrCorrupt
+			}
+			if chunkType == chunkTypeCompressedData {
+				dLen, err = DecodedLen(hdr[chunkHeaderSize+checksumSize:])
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				dLen = chunkLen - checksumSize
+			}
+			if dLen > r.maxBlock || chunkHeaderSize+chunkLen > len(buf) {
+				return nil, ErrCorrupt
+			}
+		case chunkTypeStreamIdentifier:
+			// Section 4.1. Stream identifier (chunk type 0xff).
+			if chunkLen != len(magicBody) {
+				return nil, ErrCorrupt
+			}
+			cOff = nextC
+			continue
+		default:
+			if chunkType <= 0x7f {
+				// Section 4.5. Reserved unskippable chunks (chunk types 0x02-0x7f).
+				return nil, ErrUnsupported
+			}
+			// Section 4.4 Padding (chunk type 0xfe).
+			// Section 4.6. Reserved skippable chunks (chunk types 0x80-0xfd).
+			cOff = nextC
+			continue
+		}
+
+		if off >= uOff+int64(dLen) {
+			// Not in this block, skip it.
+			cOff = nextC
+			uOff += int64(dLen)
+			continue
+		}
+
+		// Read the full chunk.
+		chunk := buf[:chunkHeaderSize+chunkLen]
+		if n, err := r.ra.ReadAt(chunk, cOff); n != len(chunk) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		chunk = chunk[chunkHeaderSize:]
+		checksum := uint32(chunk[0]) | uint32(chunk[1])<<8 | uint32(chunk[2])<<16 | uint32(chunk[3])<<24
+		chunk = chunk[checksumSize:]
+
+		blk := &readerAtBlock{uOff: uOff, nextC: nextC, data: make([]byte, dLen)}
+		if chunkType == chunkTypeCompressedData {
+			if r.dict != nil {
+				_, err = r.dict.Decode(blk.data, chunk)
+			} else {
+				_, err = Decode(blk.data, chunk)
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			copy(blk.data, chunk)
+		}
+		if !r.ignoreCRC && crc(blk.data) != checksum {
+			return nil, ErrCRC
+		}
+		r.cache.add(blk)
+		return blk, nil
+	}
+}
+
+// blockCache contains recently decoded blocks.
+// A nil blockCache is valid and will not cache anything.
+type blockCache struct {
+	mu  sync.Mutex
+	max int
+	// blocks in order of use, most recent last.
+	blocks []*readerAtBlock
+}
+
+// get returns a cached block containing uncompressed offset off.
+func (c *blockCache) get(off int64) *readerAtBlock {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		blk := c.blocks[i]
+		if off >= blk.uOff && off < blk.uOff+int64(len(blk.data)) {
+			// Move to most recent.
+			copy(c.blocks[i:], c.blocks[i+1:])
+			c.blocks[len(c.blocks)-1] = blk
+			return blk
+		}
+	}
+	return nil
+}
+
+// add a block to the cache, evicting the least recently used if full.
+// Blocks are never modified after being added, so evicted blocks
+// may still be used by concurrent reads.
+func (c *blockCache) add(blk *readerAtBlock) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range c.blocks {
+		if b.uOff == blk.uOff {
+			// Added by a concurrent read.
+			return
+		}
+	}
+	if len(c.blocks) >= c.max {
+		copy(c.blocks, c.blocks[1:])
+		c.blocks = c.blocks[:len(c.blocks)-1]
+	}
+	c.blocks = append(c.blocks, blk)
+}
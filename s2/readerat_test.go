@@ -0,0 +1,122 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+)
+
+func TestReaderAt(t *testing.T) {
+	var data []byte
+	for i := 0; len(data) < 2<<20; i++ {
+		data = append(data, fmt.Sprintf("Item %019d\n", i)...)
+	}
+	rng := rand.New(rand.NewSource(0))
+	// Add some incompressible data for uncompressed blocks.
+	rnd := make([]byte, 100<<10)
+	rng.Read(rnd)
+	data = append(data, rnd...)
+
+	for _, opts := range [][]s2.WriterOption{
+		{s2.WriterBlockSize(16 << 10)},
+		{s2.WriterBlockSize(16 << 10), s2.WriterSnappyCompat()},
+		{s2.WriterBlockSize(4 << 10), s2.WriterPadding(1 << 10), s2.WriterConcurrency(1)},
+	} {
+		var compressed bytes.Buffer
+		enc := s2.NewWriter(&compressed, append(opts, s2.WriterAddIndex())...)
+		if _, err := enc.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		index, err := enc.CloseIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		comp := compressed.Bytes()
+		for _, cache := range []int{0, 4} {
+			for _, withIndex := range []bool{false, true} {
+				t.Run(fmt.Sprintf("cache=%d-index=%v", cache, withIndex), func(t *testing.T) {
+					idx := index
+					if !withIndex {
+						idx = nil
+					}
+					ra, err := s2.NewReaderAt(bytes.NewReader(comp), int64(len(comp)), idx, s2.ReaderCacheBlocks(cache))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if ra.Size() != int64(len(data)) {
+						t.Fatalf("size: got %d, want %d", ra.Size(), len(data))
+					}
+					var wg sync.WaitGroup
+					for g := 0; g < 4; g++ {
+						wg.Add(1)
+						go func(seed int64) {
+							defer wg.Done()
+							rng := rand.New(rand.NewSource(seed))
+							for i := 0; i < 200; i++ {
+								off := rng.Int63n(int64(len(data)))
+								n := rng.Intn(100 << 10)
+								got := make([]byte, n)
+								gotN, err := ra.ReadAt(got, off)
+								want := data[off:]
+								if len(want) > n {
+									want = want[:n]
+								}
+								if gotN != len(want) {
+									t.Errorf("offset %d: got %d bytes, want %d", off, gotN, len(want))
+									return
+								}
+								if len(want) < n && err != io.EOF {
+									t.Errorf("offset %d: want io.EOF, got %v", off, err)
+									return
+								}
+								if len(want) == n && err != nil {
+									t.Errorf("offset %d: %v", off, err)
+									return
+								}
+								if !bytes.Equal(got[:gotN], want) {
+									t.Errorf("offset %d: mismatch", off)
+									return
+								}
+							}
+						}(int64(g))
+					}
+					wg.Wait()
+
+					// Read everything through a section reader.
+					got, err := io.ReadAll(io.NewSectionReader(ra, 0, ra.Size()))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, data) {
+						t.Fatal("full read mismatch")
+					}
+					if n, err := ra.ReadAt(make([]byte, 10), ra.Size()); n != 0 || err != io.EOF {
+						t.Fatalf("read at end: got %d, %v", n, err)
+					}
+				})
+			}
+		}
+	}
+
+	// No index.
+	var compressed bytes.Buffer
+	enc := s2.NewWriter(&compressed)
+	if _, err := enc.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s2.NewReaderAt(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()), nil); err == nil {
+		t.Fatal("expected error without index")
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// S2RecordIndexHeader starts a record index.
+	// It uses the stream index format, with record numbers instead of uncompressed offsets.
+	S2RecordIndexHeader = "s2rix\x00"
+	// S2RecordIndexTrailer ends a record index, after the size of the index.
+	S2RecordIndexTrailer = "\x00xir2s"
+)
+
+// RecordWriter writes length-delimited records to an S2 stream.
+// Each record is stored as a uvarint length followed by the record data.
+// Records are never split between blocks, so every block starts with a new record.
+//
+// On Close a skippable chunk (ChunkTypeRecordIndex) is added to the stream.
+// It contains an index mapping record numbers to block offsets,
+// which allows RecordReader to seek to a record.
+// The stream can still be decoded by a regular Reader.
+type RecordWriter struct {
+	w   *Writer
+	buf []byte
+	// Number of records written and the number of the first record in buf.
+	records, bufFirst int64
+	// First record of each block sent to w.
+	blocks []recordBlock
+	closed bool
+}
+
+type recordBlock struct {
+	uncompressedOffset int64
+	record             int64
+}
+
+// NewRecordWriter returns a RecordWriter that writes records to w.
+// The options are passed to NewWriter.
+// The block size limits the maximum record size.
+func NewRecordWriter(w io.Writer, opts ...WriterOption) *RecordWriter {
+	return &RecordWriter{w: NewWriter(w, opts...)}
+}
+
+// Reset discards the writer's state and switches the output to w.
+// Records that have not been flushed are discarded.
+func (r *RecordWriter) Reset(w io.Writer) {
+	r.w.Reset(w)
+	r.buf = r.buf[:0]
+	r.records, r.bufFirst = 0, 0
+	r.blocks = r.blocks[:0]
+	r.closed = false
+}
+
+// Records returns the number of records written.
+func (r *RecordWriter) Records() int64 {
+	return r.records
+}
+
+// WriteRecord adds a record to the stream.
+// The record and its length prefix must fit within a single block.
+// The content of b is copied, so it can be reused when the call returns.
+func (r *RecordWriter) WriteRecord(b []byte) error {
+	if err := r.w.err(nil); err != nil {
+		return err
+	}
+	if r.closed {
+		return errClosed
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(len(b)))
+	if n+len(b) > r.w.blockSize {
+		return fmt.Errorf("s2: record size %d exceeds block size %d", len(b), r.w.blockSize)
+	}
+	if len(r.buf)+n+len(b) > r.w.blockSize {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+	}
+	if r.buf == nil {
+		r.buf = make([]byte, 0, r.w.blockSize)
+	}
+	r.buf = append(r.buf, tmp[:n]...)
+	r.buf = append(r.buf, b...)
+	r.records++
+	return nil
+}
+
+// flushBlock sends the buffered records to the writer as a single block.
+func (r *RecordWriter) flushBlock() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	r.blocks = append(r.blocks, recordBlock{uncompressedOffset: r.w.uncompWritten, record: r.bufFirst})
+	err := r.w.EncodeBuffer(r.buf)
+	if r.w.concurrency == 1 {
+		r.buf = r.buf[:0]
+	} else {
+		// The buffer is owned by the writer until it is flushed.
+		r.buf = nil
+	}
+	r.bufFirst = r.records
+	return err
+}
+
+// Flush writes all buffered records to the underlying io.Writer.
+// Flushing will end the current block, so frequent flushing
+// will reduce compression.
+func (r *RecordWriter) Flush() error {
+	if err := r.flushBlock(); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// Close flushes all records, adds the record index and closes the stream.
+// Calling Close multiple times is ok.
+func (r *RecordWriter) Close() error {
+	if r.closed {
+		return r.w.Close()
+	}
+	r.closed = true
+	if err := r.Flush(); err != nil {
+		return err
+	}
+	idx, err := r.index()
+	if err != nil {
+		return err
+	}
+	// The index refers to the offset of the index chunk.
+	compTotal := r.w.written
+	if !r.w.wroteStreamHeader {
+		compTotal += int64(len(magicChunk))
+	}
+	b := idx.appendFormat(nil, r.records, compTotal, recordIndex)
+	if err := r.w.AddSkippableBlock(ChunkTypeRecordIndex, b[skippableFrameHeader:]); err != nil {
+		return err
+	}
+	return r.w.Close()
+}
+
+// index returns the record index of the flushed blocks.
+// Compressed offsets are looked up in the stream index of the writer,
+// which has an entry for each block.
+func (r *RecordWriter) index() (*Index, error) {
+	var idx Index
+	idx.reset(1)
+	if len(r.blocks) > 0 {
+		idx.estBlockUncomp = (r.records + int64(len(r.blocks)) - 1) / int64(len(r.blocks))
+	}
+	info := r.w.index.info
+	j := 0
+	for _, block := range r.blocks {
+		for j < len(info) && info[j].uncompressedOffset < block.uncompressedOffset {
+			j++
+		}
+		if j == len(info) || info[j].uncompressedOffset != block.uncompressedOffset {
+			return nil, fmt.Errorf("internal error: no index entry for block at offset %d", block.uncompressedOffset)
+		}
+		if err := idx.add(info[j].compressedOffset, block.record); err != nil {
+			return nil, err
+		}
+	}
+	return &idx, nil
+}
+
+// RecordReader reads records written by RecordWriter.
+type RecordReader struct {
+	r  *Reader
+	rs io.ReadSeeker
+	// Record index, loaded on first use.
+	index *Index
+	// Number of the next record.
+	next int64
+	buf  []byte
+}
+
+// NewRecordReader returns a RecordReader that reads records from r.
+// The options are passed to NewReader.
+// To seek to records, r must be an io.ReadSeeker.
+func NewRecordReader(r io.Reader, opts ...ReaderOption) *RecordReader {
+	rs, _ := r.(io.ReadSeeker)
+	return &RecordReader{r: NewReader(r, opts...), rs: rs}
+}
+
+// Reset discards the reader's state and switches the input to r.
+func (r *RecordReader) Reset(reader io.Reader) {
+	r.r.Reset(reader)
+	r.rs, _ = reader.(io.ReadSeeker)
+	r.index = nil
+	r.next = 0
+}
+
+// Record returns the number of the record that will be returned by the next call to Next.
+func (r *RecordReader) Record() int64 {
+	return r.next
+}
+
+// Next returns the next record.
+// The returned slice is only valid until the next call to Next or SeekRecord.
+// io.EOF is returned when there are no more records.
+func (r *RecordReader) Next() ([]byte, error) {
+	n, err := r.readLen()
+	if err != nil {
+		return nil, err
+	}
+	r.next++
+	// Records are not split between blocks,
+	// so the record should be in the decoded block.
+	if dec := r.r; dec.i+n <= dec.j {
+		b := dec.decoded[dec.i : dec.i+n : dec.i+n]
+		dec.i += n
+		return b, nil
+	}
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	b := r.buf[:n]
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// readLen reads the length of the next record.
+func (r *RecordReader) readLen() (int, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || (err != io.EOF && r.r.err == nil) {
+			// Truncated or overflowing length.
+			err = ErrCorrupt
+		}
+		return 0, err
+	}
+	if n > uint64(r.r.maxBlock) {
+		return 0, ErrCorrupt
+	}
+	return int(n), nil
+}
+
+// skip n records.
+func (r *RecordReader) skip(n int64) error {
+	for ; n > 0; n-- {
+		l, err := r.readLen()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err := r.r.Skip(int64(l)); err != nil {
+			if err == io.EOF {
+				err = ErrCorrupt
+			}
+			return err
+		}
+		r.next++
+	}
+	return nil
+}
+
+// Records returns the number of records in the stream.
+// The input must be an io.ReadSeeker and the stream must contain a record index.
+func (r *RecordReader) Records() (int64, error) {
+	if err := r.loadIndex(); err != nil {
+		return 0, err
+	}
+	return r.index.TotalUncompressed, nil
+}
+
+// SeekRecord will seek so the next call to Next returns record n.
+// Negative values are counted from the end of the stream, where -1 is the last record.
+// Seeking to the number of records will make Next return io.EOF.
+// The input must be an io.ReadSeeker and the stream must contain a record index.
+func (r *RecordReader) SeekRecord(n int64) error {
+	if err := r.loadIndex(); err != nil {
+		return err
+	}
+	if n < 0 {
+		n += r.index.TotalUncompressed
+	}
+	c, first, err := r.index.Find(n)
+	if err != nil {
+		return err
+	}
+	if n >= r.next && first <= r.next && r.r.err == nil {
+		// Target is in the current block or later, skip forward.
+		return r.skip(n - r.next)
+	}
+	if err := r.r.stopAhead(false); err != nil {
+		return err
+	}
+	if _, err := r.rs.Seek(c, io.SeekStart); err != nil {
+		return err
+	}
+	r.r.Reset(r.rs)
+	r.r.readHeader = true
+	r.next = first
+	return r.skip(n - first)
+}
+
+// loadIndex loads the record index if it hasn't been loaded.
+// The position of the input is preserved.
+func (r *RecordReader) loadIndex() error {
+	if r.index != nil {
+		return nil
+	}
+	if r.rs == nil {
+		return ErrCantSeek{Reason: "input is not seekable"}
+	}
+	// Return the input to the current position.
+	if err := r.r.stopAhead(true); err != nil {
+		return err
+	}
+	pos, err := r.rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ErrCantSeek{Reason: "seeking input returned: " + err.Error()}
+	}
+	var idx Index
+	err = idx.loadStream(r.rs, recordIndex)
+	if err == ErrUnsupported {
+		// A stream index or padding may follow the record index.
+		var b []byte
+		b, err = findRecordIndex(r.rs)
+		if err == nil {
+			_, err = idx.load(b, recordIndex)
+		}
+	}
+	if _, err2 := r.rs.Seek(pos, io.SeekStart); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	r.index = &idx
+	return nil
+}
+
+// findRecordIndex searches the chunks of the stream for the last record index.
+// ErrUnsupported is returned if there is no record index.
+func findRecordIndex(rs io.ReadSeeker) ([]byte, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var found []byte
+	var hdr [chunkHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(rs, hdr[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return nil, err
+		}
+		chunkLen := int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16
+		if hdr[0] != ChunkTypeRecordIndex {
+			if _, err := rs.Seek(int64(chunkLen), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		found = make([]byte, chunkHeaderSize+chunkLen)
+		copy(found, hdr[:])
+		if _, err := io.ReadFull(rs, found[chunkHeaderSize:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return nil, err
+		}
+	}
+	if found == nil {
+		return nil, ErrUnsupported
+	}
+	return found, nil
+}
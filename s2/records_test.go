@@ -0,0 +1,210 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+)
+
+func TestRecords(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	var records [][]byte
+	for i := 0; i < 5000; i++ {
+		var rec []byte
+		switch i % 100 {
+		case 0:
+			// Empty record.
+		case 50:
+			// Large record.
+			rec = make([]byte, 2000+rng.Intn(2000))
+			rng.Read(rec)
+		default:
+			rec = []byte(fmt.Sprintf("record %d: %s", i, bytes.Repeat([]byte{'a' + byte(i%26)}, rng.Intn(100))))
+		}
+		records = append(records, rec)
+	}
+	// Offsets where records start.
+	starts := make(map[int64]bool)
+	var off int64
+	for _, rec := range records {
+		starts[off] = true
+		off += int64(binary.PutUvarint(make([]byte, binary.MaxVarintLen64), uint64(len(rec))) + len(rec))
+	}
+
+	for _, test := range []struct {
+		name string
+		opts []s2.WriterOption
+	}{
+		{name: "default"},
+		{name: "sync", opts: []s2.WriterOption{s2.WriterConcurrency(1), s2.WriterBlockSize(4 << 10)}},
+		{name: "concurrent", opts: []s2.WriterOption{s2.WriterConcurrency(4), s2.WriterBlockSize(4 << 10)}},
+		{name: "index", opts: []s2.WriterOption{s2.WriterAddIndex(), s2.WriterBlockSize(8 << 10)}},
+		{name: "padding", opts: []s2.WriterOption{s2.WriterPadding(1 << 10), s2.WriterAddIndex(), s2.WriterBlockSize(8 << 10)}},
+		{name: "snappy", opts: []s2.WriterOption{s2.WriterSnappyCompat(), s2.WriterBlockSize(64 << 10)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var blocks int
+			opts := append(test.opts, s2.WriterBlockCallback(func(uOff, cOff int64, uLen, cLen int) {
+				if !starts[uOff] {
+					t.Errorf("block at offset %d does not start with a record", uOff)
+				}
+				blocks++
+			}))
+			w := s2.NewRecordWriter(&buf, opts...)
+			for i, rec := range records {
+				if err := w.WriteRecord(rec); err != nil {
+					t.Fatal(err)
+				}
+				if i == len(records)/2 {
+					if err := w.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if w.Records() != int64(len(records)) {
+				t.Fatalf("got %d records, want %d", w.Records(), len(records))
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteRecord(nil); err == nil {
+				t.Fatal("expected error writing to closed writer")
+			}
+			t.Logf("%d records, %d blocks, %d bytes", len(records), blocks, buf.Len())
+
+			// Read sequentially.
+			r := s2.NewRecordReader(bytes.NewReader(buf.Bytes()))
+			for i, want := range records {
+				if r.Record() != int64(i) {
+					t.Fatalf("got record number %d, want %d", r.Record(), i)
+				}
+				got, err := r.Next()
+				if err != nil {
+					t.Fatal(i, err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("record %d mismatch", i)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Fatalf("want io.EOF, got %v", err)
+			}
+			n, err := r.Records()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(records)) {
+				t.Fatalf("got %d records, want %d", n, len(records))
+			}
+
+			// Seek to random records.
+			seekRecords := func(t *testing.T, r *s2.RecordReader) {
+				for i := 0; i < 1000; i++ {
+					idx := int64(rng.Intn(len(records)))
+					seek := idx
+					if i%4 == 0 {
+						seek = idx - int64(len(records))
+					}
+					if err := r.SeekRecord(seek); err != nil {
+						t.Fatal(err)
+					}
+					for j := idx; j < idx+3 && j < int64(len(records)); j++ {
+						got, err := r.Next()
+						if err != nil {
+							t.Fatal(err)
+						}
+						if !bytes.Equal(got, records[j]) {
+							t.Fatalf("record %d mismatch after seeking to %d", j, seek)
+						}
+					}
+				}
+				if err := r.SeekRecord(int64(len(records))); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := r.Next(); err != io.EOF {
+					t.Fatalf("want io.EOF, got %v", err)
+				}
+				if err := r.SeekRecord(int64(len(records)) + 1); err == nil {
+					t.Fatal("expected error seeking past end")
+				}
+			}
+			seekRecords(t, s2.NewRecordReader(bytes.NewReader(buf.Bytes())))
+			t.Run("read-ahead", func(t *testing.T) {
+				seekRecords(t, s2.NewRecordReader(bytes.NewReader(buf.Bytes()), s2.ReaderConcurrency(4)))
+			})
+
+			// The stream is a regular stream.
+			dec, err := io.ReadAll(s2.NewReader(bytes.NewReader(buf.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(dec)) != off {
+				t.Fatalf("got %d decoded bytes, want %d", len(dec), off)
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := s2.NewRecordWriter(&buf)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r := s2.NewRecordReader(bytes.NewReader(buf.Bytes()))
+		if n, err := r.Records(); err != nil || n != 0 {
+			t.Fatalf("got %d records, err: %v", n, err)
+		}
+		if err := r.SeekRecord(0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("want io.EOF, got %v", err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := s2.NewRecordWriter(&buf, s2.WriterBlockSize(4<<10))
+		if err := w.WriteRecord(make([]byte, 4<<10)); err == nil {
+			t.Fatal("expected error for record larger than block")
+		}
+		if err := w.WriteRecord([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Seeking requires an io.ReadSeeker.
+		r := s2.NewRecordReader(io.MultiReader(bytes.NewReader(buf.Bytes())))
+		if err := r.SeekRecord(0); err == nil {
+			t.Fatal("expected error seeking without io.ReadSeeker")
+		}
+		got, err := r.Next()
+		if err != nil || string(got) != "hello" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+		// Seeking requires a record index.
+		var plain bytes.Buffer
+		enc := s2.NewWriter(&plain)
+		enc.Write([]byte{5, 'h', 'e', 'l', 'l', 'o'})
+		enc.Close()
+		r = s2.NewRecordReader(bytes.NewReader(plain.Bytes()))
+		if err := r.SeekRecord(0); err != s2.ErrUnsupported {
+			t.Fatalf("want ErrUnsupported, got %v", err)
+		}
+		got, err = r.Next()
+		if err != nil || string(got) != "hello" {
+			t.Fatalf("got %q, %v", got, err)
+		}
+	})
+}
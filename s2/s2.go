@@ -103,6 +103,9 @@ const (
 	chunkTypeCompressedData   = 0x00
 	chunkTypeUncompressedData = 0x01
 	ChunkTypeIndex            = 0x99
+	// ChunkTypeRecordIndex is the skippable chunk containing the record index
+	// added by RecordWriter, starting with S2RecordIndexHeader.
+	ChunkTypeRecordIndex      = 0x98
 	chunkTypePadding          = 0xfe
 	chunkTypeStreamIdentifier = 0xff
 )
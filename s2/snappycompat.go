@@ -0,0 +1,274 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"errors"
+	"io"
+)
+
+// IsSnappyCompatible returns whether the block can be decoded by a Snappy decoder.
+// This is the case if the block is valid and doesn't use S2 extensions, like repeat offsets.
+// The structure of the block is checked, but the block is not decompressed.
+// Blocks produced by EncodeSnappy, EncodeSnappyBetter and EncodeSnappyBest are always compatible.
+func IsSnappyCompatible(block []byte) bool {
+	dLen, s, err := decodedLen(block)
+	if err != nil {
+		return false
+	}
+	src := block
+	// Number of bytes decoded so far.
+	d := 0
+	for s < len(src) {
+		var length, offset int
+		switch src[s] & 0x03 {
+		case tagLiteral:
+			x := int(src[s] >> 2)
+			s++
+			if x >= 60 {
+				// Literal length is stored in the following 1-4 bytes.
+				n := x - 59
+				if n > len(src)-s {
+					return false
+				}
+				x = 0
+				for i := n - 1; i >= 0; i-- {
+					x = x<<8 | int(src[s+i])
+				}
+				s += n
+			}
+			length = x + 1
+			if length <= 0 || length > len(src)-s || length > dLen-d {
+				return false
+			}
+			s += length
+			d += length
+			continue
+		case tagCopy1:
+			if len(src)-s < 2 {
+				return false
+			}
+			length = 4 + int(src[s]>>2&0x7)
+			// An offset of 0 is a repeat offset.
+			offset = int(src[s]&0xe0)<<3 | int(src[s+1])
+			s += 2
+		case tagCopy2:
+			if len(src)-s < 3 {
+				return false
+			}
+			length = 1 + int(src[s]>>2)
+			offset = int(src[s+1]) | int(src[s+2])<<8
+			s += 3
+		case tagCopy4:
+			if len(src)-s < 5 {
+				return false
+			}
+			length = 1 + int(src[s]>>2)
+			offset = int(uint32(src[s+1]) | uint32(src[s+2])<<8 | uint32(src[s+3])<<16 | uint32(src[s+4])<<24)
+			s += 5
+		}
+		if offset <= 0 || offset > d || length > dLen-d {
+			return false
+		}
+		d += length
+	}
+	return d == dLen
+}
+
+// IsSnappyCompatibleStream reads the stream in r and returns whether it can be decoded by a Snappy decoder.
+// This requires Snappy stream identifiers, blocks of at most 64KB
+// and that all compressed blocks are compatible as reported by IsSnappyCompatible.
+// Blocks are not decompressed and CRCs are not checked.
+// An error is returned if the stream cannot be read.
+func IsSnappyCompatibleStream(r io.Reader) (bool, error) {
+	var hdr [chunkHeaderSize]byte
+	var buf []byte
+	compatible := true
+	readHeader := false
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return compatible, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return false, err
+		}
+		chunkType := hdr[0]
+		chunkLen := int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16
+		if !readHeader && chunkType != chunkTypeStreamIdentifier {
+			return false, ErrCorrupt
+		}
+		if chunkType <= 0x7f && chunkType > chunkTypeUncompressedData {
+			return false, ErrUnsupported
+		}
+		if cap(buf) < chunkLen {
+			buf = make([]byte, chunkLen)
+		}
+		buf = buf[:chunkLen]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return false, err
+		}
+		switch chunkType {
+		case chunkTypeStreamIdentifier:
+			readHeader = true
+			switch string(buf) {
+			case magicBodySnappy:
+			case magicBody:
+				compatible = false
+			default:
+				return false, ErrCorrupt
+			}
+		case chunkTypeCompressedData:
+			if chunkLen < checksumSize {
+				return false, ErrCorrupt
+			}
+			n, err := DecodedLen(buf[checksumSize:])
+			if err != nil {
+				return false, err
+			}
+			if n > maxSnappyBlockSize || !IsSnappyCompatible(buf[checksumSize:]) {
+				compatible = false
+			}
+		case chunkTypeUncompressedData:
+			if chunkLen < checksumSize {
+				return false, ErrCorrupt
+			}
+			if chunkLen-checksumSize > maxSnappyBlockSize {
+				compatible = false
+			}
+		}
+	}
+}
+
+// CopySnappyCompatible reads an S2 or Snappy stream from r and writes the content to w.
+// Blocks that are Snappy compatible are copied without decompressing them.
+// Other blocks are decompressed and compressed again by the writer.
+// This can be used to make sure streams can be read by Snappy decoders,
+// while only re-encoding blocks when needed.
+//
+// The writer must have been created with WriterSnappyCompat.
+// Indexes and padding in the input are dropped, other skippable chunks are copied.
+// CRCs of copied blocks are not checked.
+// The number of uncompressed bytes is returned.
+func (w *Writer) CopySnappyCompatible(r io.Reader) (n int64, err error) {
+	if err := w.err(nil); err != nil {
+		return 0, err
+	}
+	if !w.snappy {
+		return 0, errors.New("s2: CopySnappyCompatible requires WriterSnappyCompat")
+	}
+	var hdr [chunkHeaderSize]byte
+	var buf, dec []byte
+	readHeader := false
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return n, err
+		}
+		chunkType := hdr[0]
+		chunkLen := int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16
+		if !readHeader && chunkType != chunkTypeStreamIdentifier {
+			return n, ErrCorrupt
+		}
+		if chunkType <= 0x7f && chunkType > chunkTypeUncompressedData {
+			return n, ErrUnsupported
+		}
+		if cap(buf) < chunkLen {
+			buf = make([]byte, chunkLen)
+		}
+		buf = buf[:chunkLen]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrCorrupt
+			}
+			return n, err
+		}
+
+		switch chunkType {
+		case chunkTypeStreamIdentifier:
+			if string(buf) != magicBody && string(buf) != magicBodySnappy {
+				return n, ErrCorrupt
+			}
+			readHeader = true
+			continue
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			if chunkLen < checksumSize {
+				return n, ErrCorrupt
+			}
+		case ChunkTypeIndex, ChunkTypeRecordIndex, chunkTypePadding:
+			// Offsets may change, so indexes are no longer valid.
+			continue
+		default:
+			if err := w.AddSkippableBlock(chunkType, buf); err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		checksum := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+		block := buf[checksumSize:]
+		if chunkType == chunkTypeCompressedData {
+			dLen, err := DecodedLen(block)
+			if err != nil {
+				return n, err
+			}
+			if dLen > maxBlockSize {
+				return n, ErrCorrupt
+			}
+			if dLen <= maxSnappyBlockSize && IsSnappyCompatible(block) {
+				if err := w.copyChunk(hdr[:], buf, dLen); err != nil {
+					return n, err
+				}
+				n += int64(dLen)
+				continue
+			}
+			if cap(dec) < dLen {
+				dec = make([]byte, dLen)
+			}
+			block, err = Decode(dec[:dLen], block)
+			if err != nil {
+				return n, err
+			}
+			if crc(block) != checksum {
+				return n, ErrCRC
+			}
+		} else if len(block) <= maxSnappyBlockSize {
+			if err := w.copyChunk(hdr[:], buf, len(block)); err != nil {
+				return n, err
+			}
+			n += int64(len(block))
+			continue
+		} else if crc(block) != checksum {
+			return n, ErrCRC
+		}
+		if _, err := w.Write(block); err != nil {
+			return n, err
+		}
+		n += int64(len(block))
+	}
+}
+
+// copyChunk writes a data chunk as-is, after flushing any buffered input.
+func (w *Writer) copyChunk(header, data []byte, uLen int) error {
+	if err := w.err(nil); err != nil {
+		return err
+	}
+	if len(w.ibuf) > 0 {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.writeRawChunk(header, data, uLen)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s2
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestIsSnappyCompatible(t *testing.T) {
+	for _, name := range []string{"Mark.Twain-Tom.Sawyer.txt", "html.txt", "pngdata.bin", "e.txt"} {
+		data, err := os.ReadFile("../testdata/" + name)
+		if err != nil {
+			t.Skip(err)
+		}
+		for _, enc := range []func(dst, src []byte) []byte{EncodeSnappy, EncodeSnappyBetter, EncodeSnappyBest} {
+			if b := enc(nil, data); !IsSnappyCompatible(b) {
+				t.Errorf("%s: Snappy block reported as incompatible", name)
+			}
+		}
+		// Truncated blocks are never compatible.
+		for _, enc := range []func(dst, src []byte) []byte{Encode, EncodeBetter, EncodeSnappy} {
+			b := enc(nil, data)
+			for _, n := range []int{1, 2, 10, len(b) / 2, len(b) - 1} {
+				if IsSnappyCompatible(b[:n]) {
+					t.Errorf("%s: truncated block at %d reported as compatible", name, n)
+				}
+			}
+		}
+	}
+	data := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789 "), 1000)
+	if IsSnappyCompatible(Encode(nil, data)) {
+		t.Error("expected S2 block with repeats to be incompatible")
+	}
+	if !IsSnappyCompatible(Encode(nil, []byte("hello"))) {
+		t.Error("expected literal block to be compatible")
+	}
+	if IsSnappyCompatible(nil) {
+		t.Error("expected empty input to be incompatible")
+	}
+}
+
+func TestCopySnappyCompatible(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	for len(data) < 1<<20 {
+		data = append(data, data...)
+	}
+	encode := func(opts ...WriterOption) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		if _, err := w.Write(data[:len(data)/2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddSkippableBlock(0x80, []byte("skip")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data[len(data)/2:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	s2Stream := encode(WriterAddIndex(), WriterPadding(4<<10))
+	snappyStream := encode(WriterSnappyCompat(), WriterConcurrency(1))
+	if ok, err := IsSnappyCompatibleStream(bytes.NewReader(s2Stream)); err != nil || ok {
+		t.Fatalf("S2 stream: got %v, %v", ok, err)
+	}
+	if ok, err := IsSnappyCompatibleStream(bytes.NewReader(snappyStream)); err != nil || !ok {
+		t.Fatalf("Snappy stream: got %v, %v", ok, err)
+	}
+	if _, err := IsSnappyCompatibleStream(bytes.NewReader(snappyStream[:len(snappyStream)-1])); err != ErrCorrupt {
+		t.Fatalf("truncated stream: want ErrCorrupt, got %v", err)
+	}
+
+	for _, conc := range []int{1, 4} {
+		for _, test := range []struct {
+			name  string
+			input []byte
+		}{{name: "s2", input: s2Stream}, {name: "snappy", input: snappyStream}} {
+			var out bytes.Buffer
+			w := NewWriter(&out, WriterSnappyCompat(), WriterConcurrency(conc), WriterAddIndex())
+			n, err := w.CopySnappyCompatible(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatal(test.name, err)
+			}
+			if n != int64(len(data)) {
+				t.Fatalf("%s: got %d bytes, want %d", test.name, n, len(data))
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			ok, err := IsSnappyCompatibleStream(bytes.NewReader(out.Bytes()))
+			if err != nil || !ok {
+				t.Fatalf("%s: output not compatible: %v", test.name, err)
+			}
+			var skipped []byte
+			r := NewReader(bytes.NewReader(out.Bytes()), ReaderSkippableCB(0x80, func(r io.Reader) (err error) {
+				skipped, err = io.ReadAll(r)
+				return err
+			}))
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s: output mismatch", test.name)
+			}
+			if string(skipped) != "skip" {
+				t.Fatalf("%s: skippable chunk got %q", test.name, skipped)
+			}
+			var index Index
+			if err := index.LoadStream(bytes.NewReader(out.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if index.TotalUncompressed != int64(len(data)) {
+				t.Fatalf("%s: index has %d bytes, want %d", test.name, index.TotalUncompressed, len(data))
+			}
+			// Compatible input is copied as-is, followed by the index.
+			if test.name == "snappy" && !bytes.HasPrefix(out.Bytes(), test.input) {
+				t.Errorf("%s: compatible blocks were not copied", test.name)
+			}
+			t.Logf("%s, concurrency %d: %d -> %d bytes", test.name, conc, len(test.input), out.Len())
+		}
+	}
+
+	// The writer must be Snappy compatible.
+	w := NewWriter(io.Discard)
+	if _, err := w.CopySnappyCompatible(bytes.NewReader(snappyStream)); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// hadoopBlockSize is the default maximum input size of a block written by the
+// Hadoop SnappyCodec, given the default buffer size of 256KB.
+// This ensures that compressed blocks fit within the buffer of Hadoop decompressors.
+const hadoopBlockSize = 256<<10 - (256<<10)/6 - 32
+
+// HadoopReader reads block streams written by the Hadoop SnappyCodec.
+//
+// Each block starts with a 4 byte big endian uncompressed length,
+// followed by one or more compressed chunks, each prefixed by a 4 byte big endian length,
+// until the uncompressed length has been decoded.
+type HadoopReader struct {
+	r       io.Reader
+	err     error
+	buf     []byte
+	decoded []byte
+	// decoded[i:] contains decoded bytes that have not yet been passed on.
+	i int
+	// remain is the number of uncompressed bytes left in the current block.
+	remain int
+}
+
+// NewHadoopReader returns a new HadoopReader that decompresses from r.
+func NewHadoopReader(r io.Reader) *HadoopReader {
+	return &HadoopReader{r: r}
+}
+
+// Reset discards any buffered data, resets all state, and switches the
+// reader to read from r.
+func (h *HadoopReader) Reset(r io.Reader) {
+	h.r = r
+	h.err = nil
+	h.decoded = h.decoded[:0]
+	h.i = 0
+	h.remain = 0
+}
+
+// Read satisfies the io.Reader interface.
+func (h *HadoopReader) Read(p []byte) (int, error) {
+	for h.i >= len(h.decoded) {
+		if h.err != nil {
+			return 0, h.err
+		}
+		h.err = h.nextChunk()
+	}
+	n := copy(p, h.decoded[h.i:])
+	h.i += n
+	return n, nil
+}
+
+// nextChunk reads and decodes the next compressed chunk.
+// io.EOF is returned at the end of the stream.
+func (h *HadoopReader) nextChunk() error {
+	var tmp [4]byte
+	h.decoded, h.i = h.decoded[:0], 0
+	if h.remain == 0 {
+		if _, err := io.ReadFull(h.r, tmp[:]); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return noEOF(err)
+		}
+		n := binary.BigEndian.Uint32(tmp[:])
+		if n > maxLengthPrefixedBlock {
+			return ErrTooLarge
+		}
+		// Empty blocks have no chunks.
+		h.remain = int(n)
+		return nil
+	}
+	if _, err := io.ReadFull(h.r, tmp[:]); err != nil {
+		return noEOF(err)
+	}
+	n := binary.BigEndian.Uint32(tmp[:])
+	if n > maxLengthPrefixedBlock {
+		return ErrTooLarge
+	}
+	var err error
+	h.buf, h.decoded, err = readBlock(h.r, h.buf, h.decoded, int(n))
+	if err != nil {
+		return err
+	}
+	if len(h.decoded) > h.remain {
+		return ErrCorrupt
+	}
+	h.remain -= len(h.decoded)
+	return nil
+}
+
+// HadoopWriter writes block streams compatible with the Hadoop SnappyCodec.
+// Data is buffered and each block is written as a single compressed chunk.
+// Close must be called to write the last block.
+type HadoopWriter struct {
+	w    io.Writer
+	err  error
+	ibuf []byte
+	obuf []byte
+}
+
+// NewHadoopWriter returns a new HadoopWriter that compresses to w.
+func NewHadoopWriter(w io.Writer) *HadoopWriter {
+	return &HadoopWriter{w: w}
+}
+
+// Reset discards the writer's state and switches the writer to write to w.
+func (h *HadoopWriter) Reset(w io.Writer) {
+	h.w = w
+	h.err = nil
+	h.ibuf = h.ibuf[:0]
+}
+
+// Write satisfies the io.Writer interface.
+func (h *HadoopWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if h.err != nil {
+			return n, h.err
+		}
+		if h.ibuf == nil {
+			h.ibuf = make([]byte, 0, hadoopBlockSize)
+		}
+		c := copy(h.ibuf[len(h.ibuf):cap(h.ibuf)], p)
+		h.ibuf = h.ibuf[:len(h.ibuf)+c]
+		p = p[c:]
+		n += c
+		if len(h.ibuf) == cap(h.ibuf) {
+			h.err = h.Flush()
+		}
+	}
+	return n, h.err
+}
+
+// Flush writes any buffered data to the underlying writer as a block.
+func (h *HadoopWriter) Flush() error {
+	if h.err != nil || len(h.ibuf) == 0 {
+		return h.err
+	}
+	h.obuf = writeBlock(h.obuf, h.ibuf, true)
+	h.ibuf = h.ibuf[:0]
+	if _, err := h.w.Write(h.obuf); err != nil {
+		h.err = err
+	}
+	return h.err
+}
+
+// Close writes any buffered data.
+// The underlying writer is not closed.
+func (h *HadoopWriter) Close() error {
+	err := h.Flush()
+	if h.err == nil {
+		h.err = errClosed
+	}
+	return err
+}
+
+// NewAutoReader returns a reader that decompresses r,
+// detecting the format from the first bytes of the stream.
+// The Snappy framing format and the xerial format are detected by their headers.
+// Other streams are read as Hadoop SnappyCodec streams.
+// The reader is buffered, so more bytes than needed may be read from r.
+//
+// NewReader only accepts the framing format.
+func NewAutoReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	b, err := br.Peek(len(xerialHeader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	const framingHeader = "\xff\x06\x00\x00sNaPpY"
+	switch {
+	case len(b) == 0:
+		return br, nil
+	case len(b) >= 4 && string(b) == framingHeader[:len(b)]:
+		return NewReader(br), nil
+	case string(b) == xerialHeader:
+		return NewXerialReader(br), nil
+	}
+	return NewHadoopReader(br), nil
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// xerialHeader is the magic of the header used by xerial snappy-java.
+	// It is followed by a 4 byte version and a 4 byte compatible version.
+	xerialHeader    = "\x82SNAPPY\x00"
+	xerialHeaderLen = len(xerialHeader) + 8
+	xerialVersion   = 1
+
+	// xerialBlockSize is the default block size used by snappy-java.
+	xerialBlockSize = 32 << 10
+
+	// maxLengthPrefixedBlock is the maximum compressed or uncompressed
+	// block size accepted when reading xerial and Hadoop streams.
+	maxLengthPrefixedBlock = 16 << 20
+)
+
+var errClosed = errors.New("snappy: Writer is closed")
+
+// XerialReader reads streams in the format written by xerial snappy-java,
+// as used by Kafka and others.
+//
+// The stream starts with a 16 byte header, followed by blocks
+// with a 4 byte big endian length of the compressed block.
+// Concatenated streams are supported.
+type XerialReader struct {
+	r       io.Reader
+	err     error
+	buf     []byte
+	decoded []byte
+	// decoded[i:] contains decoded bytes that have not yet been passed on.
+	i          int
+	readHeader bool
+}
+
+// NewXerialReader returns a new XerialReader that decompresses from r.
+func NewXerialReader(r io.Reader) *XerialReader {
+	return &XerialReader{r: r}
+}
+
+// Reset discards any buffered data, resets all state, and switches the
+// reader to read from r.
+func (x *XerialReader) Reset(r io.Reader) {
+	x.r = r
+	x.err = nil
+	x.decoded = x.decoded[:0]
+	x.i = 0
+	x.readHeader = false
+}
+
+// Read satisfies the io.Reader interface.
+func (x *XerialReader) Read(p []byte) (int, error) {
+	for x.i >= len(x.decoded) {
+		if x.err != nil {
+			return 0, x.err
+		}
+		x.err = x.nextBlock()
+	}
+	n := copy(p, x.decoded[x.i:])
+	x.i += n
+	return n, nil
+}
+
+// nextBlock reads and decodes the next block.
+// io.EOF is returned at the end of the stream.
+func (x *XerialReader) nextBlock() error {
+	var tmp [xerialHeaderLen]byte
+	if _, err := io.ReadFull(x.r, tmp[:4]); err != nil {
+		if err == io.EOF && x.readHeader {
+			return io.EOF
+		}
+		return noEOF(err)
+	}
+	if string(tmp[:4]) == xerialHeader[:4] {
+		// Header of a (concatenated) stream.
+		if _, err := io.ReadFull(x.r, tmp[4:]); err != nil {
+			return noEOF(err)
+		}
+		if string(tmp[:len(xerialHeader)]) != xerialHeader {
+			return ErrCorrupt
+		}
+		x.readHeader = true
+		x.decoded, x.i = x.decoded[:0], 0
+		return nil
+	}
+	if !x.readHeader {
+		return ErrCorrupt
+	}
+	n := binary.BigEndian.Uint32(tmp[:4])
+	if n > maxLengthPrefixedBlock {
+		return ErrTooLarge
+	}
+	var err error
+	x.buf, x.decoded, err = readBlock(x.r, x.buf, x.decoded, int(n))
+	x.i = 0
+	return err
+}
+
+// XerialWriter writes streams in the format used by xerial snappy-java.
+// Data is buffered and written in blocks of 32KB.
+// Close must be called to write the last block.
+type XerialWriter struct {
+	w           io.Writer
+	err         error
+	ibuf        []byte
+	obuf        []byte
+	wroteHeader bool
+}
+
+// NewXerialWriter returns a new XerialWriter that compresses to w.
+func NewXerialWriter(w io.Writer) *XerialWriter {
+	return &XerialWriter{w: w}
+}
+
+// Reset discards the writer's state and switches the writer to write to w.
+func (x *XerialWriter) Reset(w io.Writer) {
+	x.w = w
+	x.err = nil
+	x.ibuf = x.ibuf[:0]
+	x.wroteHeader = false
+}
+
+// Write satisfies the io.Writer interface.
+func (x *XerialWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if x.err != nil {
+			return n, x.err
+		}
+		if x.ibuf == nil {
+			x.ibuf = make([]byte, 0, xerialBlockSize)
+		}
+		c := copy(x.ibuf[len(x.ibuf):cap(x.ibuf)], p)
+		x.ibuf = x.ibuf[:len(x.ibuf)+c]
+		p = p[c:]
+		n += c
+		if len(x.ibuf) == cap(x.ibuf) {
+			x.err = x.Flush()
+		}
+	}
+	return n, x.err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (x *XerialWriter) Flush() error {
+	if x.err != nil {
+		return x.err
+	}
+	if !x.wroteHeader {
+		var hdr [xerialHeaderLen]byte
+		copy(hdr[:], xerialHeader)
+		binary.BigEndian.PutUint32(hdr[8:], xerialVersion)
+		binary.BigEndian.PutUint32(hdr[12:], xerialVersion)
+		if _, err := x.w.Write(hdr[:]); err != nil {
+			x.err = err
+			return err
+		}
+		x.wroteHeader = true
+	}
+	if len(x.ibuf) == 0 {
+		return nil
+	}
+	x.obuf = writeBlock(x.obuf, x.ibuf, false)
+	x.ibuf = x.ibuf[:0]
+	if _, err := x.w.Write(x.obuf); err != nil {
+		x.err = err
+	}
+	return x.err
+}
+
+// Close writes any buffered data and the header if nothing has been written.
+// The underlying writer is not closed.
+func (x *XerialWriter) Close() error {
+	err := x.Flush()
+	if x.err == nil {
+		x.err = errClosed
+	}
+	return err
+}
+
+// readBlock reads a compressed block of n bytes from r and decodes it.
+// The buffers are returned for reuse.
+func readBlock(r io.Reader, buf, dst []byte, n int) ([]byte, []byte, error) {
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return buf, dst[:0], noEOF(err)
+	}
+	dLen, err := DecodedLen(buf)
+	if err != nil {
+		return buf, dst[:0], err
+	}
+	if dLen > maxLengthPrefixedBlock {
+		return buf, dst[:0], ErrTooLarge
+	}
+	if cap(dst) < dLen {
+		dst = make([]byte, dLen)
+	}
+	dst, err = Decode(dst[:dLen], buf)
+	return buf, dst, err
+}
+
+// writeBlock compresses src and appends it to dst[:0], prefixed by a 4 byte big endian length.
+// If hadoop is set, the uncompressed length is written before the compressed length.
+func writeBlock(dst, src []byte, hadoop bool) []byte {
+	hdr := 4
+	if hadoop {
+		hdr = 8
+	}
+	if n := hdr + MaxEncodedLen(len(src)); cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:cap(dst)]
+	b := Encode(dst[hdr:], src)
+	if hadoop {
+		binary.BigEndian.PutUint32(dst, uint32(len(src)))
+	}
+	binary.BigEndian.PutUint32(dst[hdr-4:], uint32(len(b)))
+	return dst[:hdr+len(b)]
+}
+
+// noEOF converts io.EOF and io.ErrUnexpectedEOF to ErrCorrupt.
+func noEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
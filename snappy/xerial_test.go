@@ -0,0 +1,149 @@
+// Copyright (c) 2022+ Klaus Post. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestXerialHadoop(t *testing.T) {
+	data, err := os.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+	data = append(data, data...)
+	formats := []struct {
+		name      string
+		newWriter func(w io.Writer) io.WriteCloser
+		newReader func(r io.Reader) io.Reader
+	}{
+		{
+			name:      "xerial",
+			newWriter: func(w io.Writer) io.WriteCloser { return NewXerialWriter(w) },
+			newReader: func(r io.Reader) io.Reader { return NewXerialReader(r) },
+		},
+		{
+			name:      "hadoop",
+			newWriter: func(w io.Writer) io.WriteCloser { return NewHadoopWriter(w) },
+			newReader: func(r io.Reader) io.Reader { return NewHadoopReader(r) },
+		},
+		{
+			name:      "framing",
+			newWriter: func(w io.Writer) io.WriteCloser { return NewBufferedWriter(w) },
+			newReader: func(r io.Reader) io.Reader { return NewReader(r) },
+		},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := f.newWriter(&buf)
+			// Write in uneven sizes.
+			for in := data; len(in) > 0; {
+				n := 10000
+				if n > len(in) {
+					n = len(in)
+				}
+				if _, err := w.Write(in[:n]); err != nil {
+					t.Fatal(err)
+				}
+				in = in[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("x")); err == nil {
+				t.Fatal("expected error writing to closed writer")
+			}
+			stream := buf.Bytes()
+			t.Logf("%d -> %d bytes", len(data), len(stream))
+
+			got, err := io.ReadAll(f.newReader(bytes.NewReader(stream)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("output mismatch")
+			}
+
+			// Concatenated streams.
+			twice := append(append([]byte{}, stream...), stream...)
+			got, err = io.ReadAll(f.newReader(bytes.NewReader(twice)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, append(append([]byte{}, data...), data...)) {
+				t.Fatal("concatenated output mismatch")
+			}
+
+			ar, err := NewAutoReader(bytes.NewReader(stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = io.ReadAll(ar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("auto detected output mismatch")
+			}
+
+			// Truncated streams.
+			for _, n := range []int{1, 11, len(stream) / 2, len(stream) - 1} {
+				_, err := io.ReadAll(f.newReader(bytes.NewReader(stream[:n])))
+				if err == nil {
+					t.Errorf("truncated at %d: expected error", n)
+				}
+			}
+		})
+	}
+}
+
+func TestXerialHeader(t *testing.T) {
+	// Stream as written by snappy-java.
+	want := []byte("hello, hello, hello")
+	stream := []byte("\x82SNAPPY\x00\x00\x00\x00\x01\x00\x00\x00\x01")
+	var buf bytes.Buffer
+	w := NewXerialWriter(&buf)
+	if _, err := w.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), stream) {
+		t.Fatalf("unexpected header: %x", buf.Bytes())
+	}
+	block := Encode(nil, want)
+	stream = append(stream, 0, 0, 0, byte(len(block)))
+	stream = append(stream, block...)
+	if !bytes.Equal(buf.Bytes(), stream) {
+		t.Fatalf("got %x, want %x", buf.Bytes(), stream)
+	}
+	got, err := io.ReadAll(NewXerialReader(bytes.NewReader(stream)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Empty stream only has a header.
+	buf.Reset()
+	w.Reset(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != xerialHeaderLen {
+		t.Fatalf("got %d bytes, want %d", buf.Len(), xerialHeaderLen)
+	}
+
+	// Missing header.
+	if _, err := io.ReadAll(NewXerialReader(bytes.NewReader(stream[xerialHeaderLen:]))); err != ErrCorrupt {
+		t.Fatalf("want ErrCorrupt, got %v", err)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/klauspost/compress/flate"
 )
 
 var (
@@ -32,6 +34,7 @@ type Reader struct {
 	File          []*File
 	Comment       string
 	decompressors map[uint16]Decompressor
+	limits        flate.ReaderLimits
 
 	// Some JAR files are zip files with a prefix that is a bash script.
 	// The baseOffset field is the start of the zip file proper.
@@ -164,6 +167,14 @@ func (z *Reader) RegisterDecompressor(method uint16, dcomp Decompressor) {
 	z.decompressors[method] = dcomp
 }
 
+// SetLimits limits the output of each file opened by File.Open.
+// Reading past a limit returns a *flate.LimitError.
+// The ratio is checked against the compressed size read so far.
+// flate.ReaderLimits.MaxMembers is ignored.
+func (z *Reader) SetLimits(limits flate.ReaderLimits) {
+	z.limits = limits
+}
+
 func (z *Reader) decompressor(method uint16) Decompressor {
 	dcomp := z.decompressors[method]
 	if dcomp == nil {
@@ -198,11 +209,16 @@ func (f *File) Open() (io.ReadCloser, error) {
 		return nil, err
 	}
 	size := int64(f.CompressedSize64)
-	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
+	var r io.Reader = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
 	dcomp := f.zip.decompressor(f.Method)
 	if dcomp == nil {
 		return nil, ErrAlgorithm
 	}
+	var in *countReader
+	if f.zip.limits != (flate.ReaderLimits{}) {
+		in = &countReader{r: r}
+		r = in
+	}
 	var rc io.ReadCloser = dcomp(r)
 	var desr io.Reader
 	if f.hasDataDescriptor() {
@@ -213,6 +229,7 @@ func (f *File) Open() (io.ReadCloser, error) {
 		hash: crc32.NewIEEE(),
 		f:    f,
 		desr: desr,
+		in:   in,
 	}
 	return rc, nil
 }
@@ -233,8 +250,21 @@ type checksumReader struct {
 	hash  hash.Hash32
 	nread uint64 // number of bytes read so far
 	f     *File
-	desr  io.Reader // if non-nil, where to read the data descriptor
-	err   error     // sticky error
+	desr  io.Reader    // if non-nil, where to read the data descriptor
+	err   error        // sticky error
+	in    *countReader // if non-nil, compressed input counted for limits
+}
+
+// countReader counts the bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 func (r *checksumReader) Stat() (fs.FileInfo, error) {
@@ -246,6 +276,12 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 		return 0, r.err
 	}
 	n, err = r.rc.Read(b)
+	if r.in != nil {
+		var lerr error
+		if n, lerr = r.f.zip.limits.Allow(r.in.n, int64(r.nread), n); lerr != nil {
+			err = lerr
+		}
+	}
 	r.hash.Write(b[:n])
 	r.nread += uint64(n)
 	if r.nread > r.f.UncompressedSize64 {
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"os"
@@ -19,6 +21,7 @@ import (
 	"testing/fstest"
 	"time"
 
+	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/zip/internal/obscuretestdata"
 )
 
@@ -1555,3 +1558,103 @@ func TestUnderSize(t *testing.T) {
 		})
 	}
 }
+
+func TestDeflate64(t *testing.T) {
+	// Deflate64 stream with a literal 'a' followed by a copy of length 1000 at distance 1,
+	// using length code 285 with 16 extra bits.
+	compressed := []byte("\x4b\x1c\x2d\x1f\x00\x00")
+	want := bytes.Repeat([]byte("a"), 1001)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	fw, err := w.CreateRaw(&FileHeader{
+		Name:               "a.txt",
+		Method:             Deflate64,
+		CRC32:              crc32.ChecksumIEEE(want),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(want)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(compressed); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		rc, err := r.File[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("got %d bytes, want %d", len(got), len(want))
+		}
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	data := bytes.Repeat([]byte("limits "), 1<<20)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, name := range []string{"small", "large"} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "small" {
+			fw.Write(data[:1000])
+		} else {
+			fw.Write(data)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		limits flate.ReaderLimits
+		limit  string
+	}{
+		{flate.ReaderLimits{MaxSize: 10000}, flate.LimitSize},
+		{flate.ReaderLimits{MaxRatio: 10}, flate.LimitRatio},
+	} {
+		zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr.SetLimits(tc.limits)
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if !bytes.Equal(got, data[:len(got)]) {
+				t.Fatalf("%s: %s: output mismatch", tc.limit, f.Name)
+			}
+			var lerr *flate.LimitError
+			if f.Name == "small" {
+				if err != nil || len(got) != 1000 {
+					t.Errorf("%s: %s: got %d bytes, err %v", tc.limit, f.Name, len(got), err)
+				}
+			} else if !errors.As(err, &lerr) || lerr.Limit != tc.limit {
+				t.Errorf("%s: %s: got error %v, want %s limit", tc.limit, f.Name, err, tc.limit)
+			}
+		}
+	}
+}
@@ -26,6 +26,7 @@ package zlib
 import (
 	"bufio"
 	"compress/zlib"
+	"fmt"
 	"hash"
 	"hash/adler32"
 	"io"
@@ -50,6 +51,8 @@ type reader struct {
 	digest       hash.Hash32
 	err          error
 	scratch      [4]byte
+	limits       flate.ReaderLimits
+	windowBits   int
 }
 
 // Resetter resets a ReadCloser returned by NewReader or NewReaderDict to
@@ -86,6 +89,42 @@ func NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
 	return z, nil
 }
 
+// NewReaderLimits is like NewReaderDict,
+// but returns a *flate.LimitError when the output exceeds limits.
+// flate.ReaderLimits.MaxMembers is ignored.
+//
+// The ReadCloser returned by NewReaderLimits also implements Resetter.
+// The limits are kept when it is reset.
+func NewReaderLimits(r io.Reader, limits flate.ReaderLimits, dict []byte) (io.ReadCloser, error) {
+	z := &reader{limits: limits}
+	err := z.Reset(r, dict)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// NewReaderWindow is like NewReaderDict,
+// but only accepts streams with a window of at most 1<<windowBits bytes.
+// ErrHeader is returned if the window size in the header is larger,
+// and the decompressor returns a flate.CorruptInputError on matches
+// further back than the window.
+// windowBits must be between 8 and 15.
+//
+// The ReadCloser returned by NewReaderWindow also implements Resetter.
+// The window size is kept when it is reset.
+func NewReaderWindow(r io.Reader, windowBits int, dict []byte) (io.ReadCloser, error) {
+	if windowBits < flate.MinWindowBits || windowBits > flate.MaxWindowBits {
+		return nil, fmt.Errorf("zlib: invalid window bits: %d", windowBits)
+	}
+	z := &reader{windowBits: windowBits}
+	err := z.Reset(r, dict)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
 func (z *reader) Read(p []byte) (int, error) {
 	if z.err != nil {
 		return 0, z.err
@@ -128,7 +167,7 @@ func (z *reader) Close() error {
 }
 
 func (z *reader) Reset(r io.Reader, dict []byte) error {
-	*z = reader{decompressor: z.decompressor, digest: z.digest}
+	*z = reader{decompressor: z.decompressor, digest: z.digest, limits: z.limits, windowBits: z.windowBits}
 	if fr, ok := r.(flate.Reader); ok {
 		z.r = fr
 	} else {
@@ -148,6 +187,11 @@ func (z *reader) Reset(r io.Reader, dict []byte) error {
 		z.err = ErrHeader
 		return z.err
 	}
+	// CINFO is the base-2 logarithm of the window size, minus 8.
+	if z.windowBits > 0 && int(z.scratch[0]>>4)+8 > z.windowBits {
+		z.err = ErrHeader
+		return z.err
+	}
 	haveDict := z.scratch[1]&0x20 != 0
 	if haveDict {
 		_, z.err = io.ReadFull(z.r, z.scratch[0:4])
@@ -165,7 +209,17 @@ func (z *reader) Reset(r io.Reader, dict []byte) error {
 	}
 
 	if z.decompressor == nil {
-		if haveDict {
+		if z.limits != (flate.ReaderLimits{}) {
+			if !haveDict {
+				dict = nil
+			}
+			z.decompressor = flate.NewReaderLimits(z.r, z.limits, dict)
+		} else if z.windowBits > 0 {
+			if !haveDict {
+				dict = nil
+			}
+			z.decompressor = flate.NewReaderWindow(z.r, z.windowBits, dict)
+		} else if haveDict {
 			z.decompressor = flate.NewReaderDict(z.r, dict)
 		} else {
 			z.decompressor = flate.NewReader(z.r)
@@ -6,8 +6,11 @@ package zlib
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"testing"
+
+	"github.com/klauspost/compress/flate"
 )
 
 type zlibTest struct {
@@ -177,3 +180,84 @@ func TestDecompressor(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderLimits(t *testing.T) {
+	data := bytes.Repeat([]byte("limits "), 10000)
+	dict := []byte("limits")
+	var buf bytes.Buffer
+	w, _ := NewWriterLevelDict(&buf, 5, dict)
+	w.Write(data)
+	w.Close()
+
+	r, err := NewReaderLimits(bytes.NewReader(buf.Bytes()), flate.ReaderLimits{MaxSize: int64(len(data))}, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, err %v", len(got), err)
+	}
+
+	r, err = NewReaderLimits(bytes.NewReader(buf.Bytes()), flate.ReaderLimits{MaxSize: 1000}, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err = io.ReadAll(r)
+		var lerr *flate.LimitError
+		if !errors.As(err, &lerr) || lerr.Limit != flate.LimitSize || !bytes.Equal(got, data[:1000]) {
+			t.Fatalf("got %d bytes, err %v", len(got), err)
+		}
+		// Limits are kept when resetting.
+		r.(Resetter).Reset(bytes.NewReader(buf.Bytes()), dict)
+	}
+}
+
+func TestReaderWindow(t *testing.T) {
+	data := bytes.Repeat([]byte("window "), 10000)
+	for _, bits := range []int{9, 12, 15} {
+		var buf bytes.Buffer
+		w, err := NewWriterWindow(&buf, 5, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+		for limit := 8; limit <= 15; limit++ {
+			r, err := NewReaderWindow(bytes.NewReader(buf.Bytes()), limit, nil)
+			if limit < bits {
+				if err != ErrHeader {
+					t.Errorf("bits %d, limit %d: got error %v, want %v", bits, limit, err, ErrHeader)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				got, err := io.ReadAll(r)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("bits %d, limit %d: got %d bytes, err %v", bits, limit, len(got), err)
+				}
+				// The window is kept when resetting.
+				if err := r.(Resetter).Reset(bytes.NewReader(buf.Bytes()), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if limit != bits || bits == flate.MaxWindowBits {
+				continue
+			}
+			// A header with a larger window is rejected on reset.
+			var big bytes.Buffer
+			w, _ := NewWriterWindow(&big, 5, bits+1)
+			w.Write(data)
+			w.Close()
+			if err := r.(Resetter).Reset(&big, nil); err != ErrHeader {
+				t.Errorf("bits %d: reset got error %v, want %v", bits, err, ErrHeader)
+			}
+		}
+	}
+	if _, err := NewReaderWindow(bytes.NewReader(nil), 16, nil); err == nil {
+		t.Error("expected error with window bits 16")
+	}
+}
@@ -29,6 +29,7 @@ const (
 type Writer struct {
 	w           io.Writer
 	level       int
+	windowBits  int
 	dict        []byte
 	compressor  *flate.Writer
 	digest      hash.Hash32
@@ -67,18 +68,35 @@ func NewWriterLevelDict(w io.Writer, level int, dict []byte) (*Writer, error) {
 		return nil, fmt.Errorf("zlib: invalid compression level: %d", level)
 	}
 	return &Writer{
-		w:     w,
-		level: level,
-		dict:  dict,
+		w:          w,
+		level:      level,
+		windowBits: flate.MaxWindowBits,
+		dict:       dict,
 	}, nil
 }
 
+// NewWriterWindow is like NewWriterLevel but limits the window size to 1<<windowBits bytes,
+// for decompressors with a smaller window.
+// The window size is stored in the header.
+// windowBits must be between 8 and 15. 15 is the default window size.
+func NewWriterWindow(w io.Writer, level, windowBits int) (*Writer, error) {
+	if windowBits < flate.MinWindowBits || windowBits > flate.MaxWindowBits {
+		return nil, fmt.Errorf("zlib: invalid window bits: %d", windowBits)
+	}
+	z, err := NewWriterLevelDict(w, level, nil)
+	if err != nil {
+		return nil, err
+	}
+	z.windowBits = windowBits
+	return z, nil
+}
+
 // Reset clears the state of the Writer z such that it is equivalent to its
 // initial state from NewWriterLevel or NewWriterLevelDict, but instead writing
 // to w.
 func (z *Writer) Reset(w io.Writer) {
 	z.w = w
-	// z.level and z.dict left unchanged.
+	// z.level, z.windowBits and z.dict left unchanged.
 	if z.compressor != nil {
 		z.compressor.Reset(w)
 	}
@@ -94,9 +112,10 @@ func (z *Writer) Reset(w io.Writer) {
 func (z *Writer) writeHeader() (err error) {
 	z.wroteHeader = true
 	// ZLIB has a two-byte header (as documented in RFC 1950).
-	// The first four bits is the CINFO (compression info), which is 7 for the default deflate window size.
+	// The first four bits is the CINFO (compression info), which is the base-2 logarithm of the window size minus 8,
+	// so 7 for the default deflate window size.
 	// The next four bits is the CM (compression method), which is 8 for deflate.
-	z.scratch[0] = 0x78
+	z.scratch[0] = uint8(z.windowBits-8)<<4 | zlibDeflate
 	// The next two bits is the FLEVEL (compression level). The four values are:
 	// 0=fastest, 1=fast, 2=default, 3=best.
 	// The next bit, FDICT, is set if a dictionary is given.
@@ -134,7 +153,14 @@ func (z *Writer) writeHeader() (err error) {
 	if z.compressor == nil {
 		// Initialize deflater unless the Writer is being reused
 		// after a Reset call.
-		z.compressor, err = flate.NewWriterDict(z.w, z.level, z.dict)
+		if z.windowBits < flate.MaxWindowBits {
+			z.compressor, err = flate.NewWriterWindow(z.w, z.level, z.windowBits)
+			if err == nil && z.dict != nil {
+				z.compressor.ResetDict(z.w, z.dict)
+			}
+		} else {
+			z.compressor, err = flate.NewWriterDict(z.w, z.level, z.dict)
+		}
 		if err != nil {
 			return err
 		}
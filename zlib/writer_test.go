@@ -209,3 +209,37 @@ func TestWriterDictIsUsed(t *testing.T) {
 		t.Errorf("result too large (got %d, want <= %d bytes). Is the dictionary being used?", len(output), expectedMaxSize)
 	}
 }
+
+func TestWriterWindow(t *testing.T) {
+	input, err := os.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for bits := 8; bits <= 15; bits++ {
+		var buf bytes.Buffer
+		w, err := NewWriterWindow(&buf, BestCompression, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(input)
+		w.Close()
+		b := buf.Bytes()
+		if cinfo := int(b[0] >> 4); cinfo != bits-8 {
+			t.Errorf("bits %d: CINFO is %d", bits, cinfo)
+		}
+		r, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, input) {
+			t.Errorf("bits %d: output mismatch", bits)
+		}
+	}
+	if _, err := NewWriterWindow(io.Discard, DefaultCompression, 16); err == nil {
+		t.Error("expected error with window bits 16")
+	}
+}